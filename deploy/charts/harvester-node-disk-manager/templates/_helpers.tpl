@@ -60,3 +60,53 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Environment variables of the exclude filters, shared by NDM and the webhook
+*/}}
+{{- define "harvester-node-disk-manager.excludeFilterEnv" -}}
+{{- with .Values.vendorFilter }}
+- name: NDM_VENDOR_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.pathFilter }}
+- name: NDM_PATH_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.labelFilter }}
+- name: NDM_LABEL_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.partTypeFilter }}
+- name: NDM_PART_TYPE_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.sizeFilter }}
+- name: NDM_SIZE_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.modelFilter }}
+- name: NDM_MODEL_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.serialFilter }}
+- name: NDM_SERIAL_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.wwnFilter }}
+- name: NDM_WWN_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.busPathFilter }}
+- name: NDM_BUS_PATH_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.storageControllerFilter }}
+- name: NDM_STORAGE_CONTROLLER_FILTER
+  value: {{ . | join "," | quote }}
+{{- end }}
+{{- with .Values.excludeExpression }}
+- name: NDM_EXCLUDE_EXPRESSION
+  value: {{ . | quote }}
+{{- end }}
+{{- end }}
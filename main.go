@@ -7,12 +7,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,17 +24,29 @@ import (
 	"github.com/rancher/wrangler/pkg/start"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
 
 	"github.com/harvester/node-disk-manager/pkg/block"
 	blockdevicev1 "github.com/harvester/node-disk-manager/pkg/controller/blockdevice"
+	"github.com/harvester/node-disk-manager/pkg/controller/filterconfig"
 	nodev1 "github.com/harvester/node-disk-manager/pkg/controller/node"
+	"github.com/harvester/node-disk-manager/pkg/events"
 	"github.com/harvester/node-disk-manager/pkg/filter"
+	diskclientset "github.com/harvester/node-disk-manager/pkg/generated/clientset/versioned"
+	diskscheme "github.com/harvester/node-disk-manager/pkg/generated/clientset/versioned/scheme"
 	ctldisk "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io"
 	ctllonghorn "github.com/harvester/node-disk-manager/pkg/generated/controllers/longhorn.io"
+	"github.com/harvester/node-disk-manager/pkg/metrics"
 	"github.com/harvester/node-disk-manager/pkg/option"
 	"github.com/harvester/node-disk-manager/pkg/udev"
 	"github.com/harvester/node-disk-manager/pkg/utils"
 	"github.com/harvester/node-disk-manager/pkg/version"
+	"github.com/harvester/node-disk-manager/pkg/webhook"
 )
 
 func main() {
@@ -73,6 +87,13 @@ func main() {
 			Usage:       "Address to listen on for profiling, e.g. `:6060`",
 			Destination: &opt.ProfilerAddress,
 		},
+		&cli.StringFlag{
+			Name:        "metrics-listen-address",
+			EnvVars:     []string{"NDM_METRICS_LISTEN_ADDRESS"},
+			Value:       "",
+			Usage:       "Address to listen on for serving Prometheus metrics at `/metrics`, e.g. `:9090`",
+			Destination: &opt.MetricsAddress,
+		},
 		&cli.BoolFlag{
 			Name:        "trace",
 			EnvVars:     []string{"NDM_TRACE"},
@@ -113,18 +134,102 @@ func main() {
 			Usage:       "A string of comma-separated glob patterns that you want to exclude for block device filesystem label filter",
 			Destination: &opt.LabelFilter,
 		},
+		&cli.StringFlag{
+			Name:        "part-type-filter",
+			EnvVars:     []string{"NDM_PART_TYPE_FILTER"},
+			Usage:       "A string of comma-separated partition type GUIDs that you want to exclude for block device part type filter, besides the BIOS boot partition",
+			Destination: &opt.PartTypeFilter,
+		},
+		&cli.StringFlag{
+			Name:        "size-filter",
+			EnvVars:     []string{"NDM_SIZE_FILTER"},
+			Usage:       "A string of comma-separated size ranges, e.g. \"-64Gi\" or \"1Ti-2Ti\", that you want to exclude for block device size filter",
+			Destination: &opt.SizeFilter,
+		},
+		&cli.StringFlag{
+			Name:        "model-filter",
+			EnvVars:     []string{"NDM_MODEL_FILTER"},
+			Usage:       "A string of comma-separated glob patterns, or regular expressions prefixed with \"regex:\", that you want to exclude for block device model filter",
+			Destination: &opt.ModelFilter,
+		},
+		&cli.StringFlag{
+			Name:        "serial-filter",
+			EnvVars:     []string{"NDM_SERIAL_FILTER"},
+			Usage:       "A string of comma-separated glob patterns, or regular expressions prefixed with \"regex:\", that you want to exclude for block device serial number filter",
+			Destination: &opt.SerialFilter,
+		},
+		&cli.StringFlag{
+			Name:        "wwn-filter",
+			EnvVars:     []string{"NDM_WWN_FILTER"},
+			Usage:       "A string of comma-separated glob patterns, or regular expressions prefixed with \"regex:\", that you want to exclude for block device WWN filter",
+			Destination: &opt.WWNFilter,
+		},
+		&cli.StringFlag{
+			Name:        "bus-path-filter",
+			EnvVars:     []string{"NDM_BUS_PATH_FILTER"},
+			Usage:       "A string of comma-separated glob patterns, or regular expressions prefixed with \"regex:\", that you want to exclude for block device bus path filter, e.g. \"*-usb-*\"",
+			Destination: &opt.BusPathFilter,
+		},
+		&cli.StringFlag{
+			Name:        "storage-controller-filter",
+			EnvVars:     []string{"NDM_STORAGE_CONTROLLER_FILTER"},
+			Usage:       "A string of comma-separated storage controllers, i.e. IDE, SCSI, NVMe, virtio or MMC, that you want to exclude for block device storage controller filter",
+			Destination: &opt.StorageControllerFilter,
+		},
+		&cli.StringFlag{
+			Name:        "exclude-expression",
+			EnvVars:     []string{"NDM_EXCLUDE_EXPRESSION"},
+			Usage:       "A filter expression, e.g. 'driveType == \"HDD\" && size < 500Gi', that you want to exclude block devices matching it",
+			Destination: &opt.ExcludeExpression,
+		},
 		&cli.Int64Flag{
 			Name:        "rescan-interval",
 			EnvVars:     []string{"NDM_RESCAN_INTERVAL"},
-			Usage:       "Specify the interval of device rescanning of the node (in seconds)",
+			Usage:       "Specify the interval of device rescanning of the node (in seconds), 0 to disable periodic rescanning",
 			Destination: &opt.RescanInterval,
 		},
+		&cli.Int64Flag{
+			Name:        "health-check-interval",
+			EnvVars:     []string{"NDM_HEALTH_CHECK_INTERVAL"},
+			Usage:       "Specify the interval of checking the SMART health of disks (in seconds) with smartctl on the host, 0 to disable health checking",
+			Value:       0,
+			DefaultText: "0",
+			Destination: &opt.HealthCheckInterval,
+		},
+		&cli.Int64Flag{
+			Name:        "inactive-device-ttl",
+			EnvVars:     []string{"NDM_INACTIVE_DEVICE_TTL"},
+			Usage:       "Specify how long an inactive and unprovisioned block device is kept before it is deleted (in seconds), 0 to keep it",
+			Value:       0,
+			DefaultText: "0",
+			Destination: &opt.InactiveDeviceTTL,
+		},
+		&cli.Int64Flag{
+			Name:        "inactive-provisioned-ttl",
+			EnvVars:     []string{"NDM_INACTIVE_PROVISIONED_TTL"},
+			Usage:       "Specify how long an inactive and provisioned block device is kept in the Longhorn node before it is removed if no replicas are on it (in seconds), 0 to keep it",
+			Value:       0,
+			DefaultText: "0",
+			Destination: &opt.InactiveProvisionedTTL,
+		},
 		&cli.StringFlag{
 			Name:        "auto-provision-filter",
 			EnvVars:     []string{"NDM_AUTO_PROVISION_FILTER"},
 			Usage:       "A string of comma-separated glob patterns that auto-provisions devices matching provided device path",
 			Destination: &opt.AutoProvisionFilter,
 		},
+		&cli.StringFlag{
+			Name:        "auto-provision-expression",
+			EnvVars:     []string{"NDM_AUTO_PROVISION_EXPRESSION"},
+			Usage:       "A filter expression, e.g. 'driveType == \"SSD\" && busPath.matches(\"*-nvme-*\")', that auto-provisions disks matching it",
+			Destination: &opt.AutoProvisionExpression,
+		},
+		&cli.StringFlag{
+			Name:        "filter-configmap",
+			EnvVars:     []string{"NDM_FILTER_CONFIGMAP"},
+			Usage:       "Specify the ConfigMap in the namespace to reload the exclude and auto-provision filters from, the filters of the flags are used if it is empty or not found",
+			Destination: &opt.FilterConfigMap,
+		},
 		&cli.UintFlag{
 			Name:        "max-concurrent-ops",
 			EnvVars:     []string{"NDM_MAX_CONCURRENT_OPS"},
@@ -133,6 +238,28 @@ func main() {
 			DefaultText: "5",
 			Destination: &opt.MaxConcurrentOps,
 		},
+		&cli.StringFlag{
+			Name:        "mount-path-template",
+			EnvVars:     []string{"NDM_MOUNT_PATH_TEMPLATE"},
+			Usage:       "Specify the template of the path to mount provisioned devices, `{{.Name}}` is replaced with the block device name",
+			Value:       blockdevicev1.DefaultMountPathTemplate,
+			DefaultText: blockdevicev1.DefaultMountPathTemplate,
+			Destination: &opt.MountPathTemplate,
+		},
+		&cli.BoolFlag{
+			Name:        "auto-evict-unhealthy-disk",
+			EnvVars:     []string{"NDM_AUTO_EVICT_UNHEALTHY_DISK"},
+			Usage:       "Disable scheduling and request eviction on the Longhorn disk of a provisioned device that turns unhealthy",
+			Value:       false,
+			Destination: &opt.AutoEvictUnhealthyDisk,
+		},
+		&cli.BoolFlag{
+			Name:        "auto-gpt-generate",
+			EnvVars:     []string{"NDM_AUTO_GPT_GENERATE"},
+			Usage:       "Generate a GPT partition table on blank disks which can not be globally identified, so that they get a PTUUID",
+			Value:       false,
+			Destination: &opt.AutoGPTGenerate,
+		},
 		&cli.BoolFlag{
 			Name:        "inject-udev-monitor-error",
 			EnvVars:     []string{"NDM_INJECT_UDEV_MONITOR_ERROR"},
@@ -144,10 +271,62 @@ func main() {
 
 	app.Action = func(c *cli.Context) error {
 		initProfiling(&opt)
+		initMetrics(&opt)
 		initLogs(&opt)
 		return run(&opt)
 	}
 
+	app.Commands = []*cli.Command{
+		{
+			Name:  "webhook",
+			Usage: "Run the admission webhook validating blockdevices",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "listen-address",
+					EnvVars:     []string{"NDM_WEBHOOK_LISTEN_ADDRESS"},
+					Usage:       "Address to listen on for serving the webhook",
+					Value:       ":8443",
+					DefaultText: ":8443",
+					Destination: &opt.WebhookListenAddress,
+				},
+				&cli.StringFlag{
+					Name:        "tls-cert-file",
+					EnvVars:     []string{"NDM_WEBHOOK_TLS_CERT_FILE"},
+					Usage:       "File containing the x509 certificate for serving the webhook",
+					Destination: &opt.WebhookTLSCertFile,
+				},
+				&cli.StringFlag{
+					Name:        "tls-private-key-file",
+					EnvVars:     []string{"NDM_WEBHOOK_TLS_PRIVATE_KEY_FILE"},
+					Usage:       "File containing the x509 private key matching --tls-cert-file",
+					Destination: &opt.WebhookTLSKeyFile,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				initProfiling(&opt)
+				initLogs(&opt)
+				return runWebhook(&opt)
+			},
+		},
+		{
+			Name:  "explain",
+			Usage: "Explain which filter or provision policy applies to each device of the node, without writing anything",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "output",
+					Aliases:     []string{"o"},
+					Usage:       "Output format of the explanations, yaml or json",
+					Value:       "yaml",
+					DefaultText: "yaml",
+					Destination: &opt.ExplainOutput,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return runExplain(&opt)
+			},
+		},
+	}
+
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
 	}
@@ -166,6 +345,21 @@ func initProfiling(opt *option.Option) {
 	}
 }
 
+func initMetrics(opt *option.Option) {
+	if opt.MetricsAddress != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			metricsServer := &http.Server{
+				Addr:              opt.MetricsAddress,
+				Handler:           mux,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			log.Println(metricsServer.ListenAndServe())
+		}()
+	}
+}
+
 func initLogs(opt *option.Option) {
 	switch opt.LogFormat {
 	case "simple":
@@ -178,8 +372,8 @@ func initLogs(opt *option.Option) {
 	logrus.SetOutput(os.Stdout)
 	logrus.Infof("Node Disk Manager %s is starting", version.FriendlyVersion())
 	logrus.Infof("Notable parameters are following:")
-	logrus.Infof("Namespace: %s, ConcurrentOps: %d, RescanInterval: %d, InjectUdevMonitorError: %v",
-		opt.Namespace, opt.MaxConcurrentOps, opt.RescanInterval, opt.InjectUdevMonitorError)
+	logrus.Infof("Namespace: %s, ConcurrentOps: %d, RescanInterval: %d, HealthCheckInterval: %d, MountPathTemplate: %s, AutoEvictUnhealthyDisk: %v, InjectUdevMonitorError: %v",
+		opt.Namespace, opt.MaxConcurrentOps, opt.RescanInterval, opt.HealthCheckInterval, opt.MountPathTemplate, opt.AutoEvictUnhealthyDisk, opt.InjectUdevMonitorError)
 	if opt.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 		logrus.Debugf("Loglevel set to [%v]", logrus.DebugLevel)
@@ -190,6 +384,136 @@ func initLogs(opt *option.Option) {
 	}
 }
 
+func runWebhook(opt *option.Option) error {
+	logrus.Info("Starting node disk manager webhook")
+	if opt.Namespace == "" {
+		return errors.New("namespace is empty")
+	}
+	if opt.WebhookTLSCertFile == "" || opt.WebhookTLSKeyFile == "" {
+		return errors.New("either TLS cert file or private key file is empty")
+	}
+
+	ctx := signals.SetupSignalContext()
+
+	kubeConfig, err := kubeconfig.GetNonInteractiveClientConfig(opt.KubeConfig).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to find kubeconfig: %v", err)
+	}
+
+	disks, err := ctldisk.NewFactoryFromConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building node-disk-manager controllers: %s", err.Error())
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building kubernetes clientset: %s", err.Error())
+	}
+
+	// the filters are resolved for the node of each blockdevice, as its
+	// scanner does
+	filters, err := filterconfig.NewResolver(newFilterConfig(opt))
+	if err != nil {
+		return err
+	}
+	if err := filterconfig.RegisterResolver(ctx, clientset, opt, filters); err != nil {
+		return err
+	}
+	bds := disks.Harvesterhci().V1beta1().BlockDevice()
+	server := webhook.NewServer(opt.WebhookListenAddress, opt.WebhookTLSCertFile, opt.WebhookTLSKeyFile, bds.Cache(), filters)
+
+	if err := start.All(ctx, opt.Threadiness, disks); err != nil {
+		return fmt.Errorf("error starting, %s", err.Error())
+	}
+
+	return server.ListenAndServe(ctx)
+}
+
+// runExplain prints the decisions of the scanner on the devices of the node.
+// The filters of the ConfigMap and the provision policies are applied if the
+// cluster is reachable.
+func runExplain(opt *option.Option) error {
+	// keep the stdout for the explanations only
+	logrus.SetOutput(os.Stderr)
+	logrus.SetLevel(logrus.WarnLevel)
+	if opt.NodeName == "" {
+		return errors.New("node name is empty")
+	}
+	if opt.ExplainOutput != "yaml" && opt.ExplainOutput != "json" {
+		return fmt.Errorf("unsupported output format %s", opt.ExplainOutput)
+	}
+
+	blockInfo, err := block.New()
+	if err != nil {
+		return err
+	}
+
+	filterConfig := newFilterConfig(opt)
+	var policyMatcher *blockdevicev1.ProvisionPolicyMatcher
+	if kubeConfig, err := kubeconfig.GetNonInteractiveClientConfig(opt.KubeConfig).ClientConfig(); err != nil {
+		logrus.Warnf("Explain without the filter ConfigMap and provision policies, failed to find kubeconfig: %v", err)
+	} else {
+		clientset, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			return fmt.Errorf("error building kubernetes clientset: %s", err.Error())
+		}
+		diskClientset, err := diskclientset.NewForConfig(kubeConfig)
+		if err != nil {
+			return fmt.Errorf("error building node-disk-manager clientset: %s", err.Error())
+		}
+		if filterConfig, err = getFilterConfig(clientset, opt, filterConfig); err != nil {
+			return err
+		}
+		policyMatcher = blockdevicev1.NewProvisionPolicyMatcher(opt.NodeName,
+			blockdevicev1.NewProvisionPolicyClientLister(diskClientset.HarvesterhciV1beta1().DiskProvisionPolicies()),
+			blockdevicev1.NewNodeClientLister(clientset.CoreV1().Nodes()))
+	}
+
+	excludeFilters, err := filterConfig.ExcludeFilters()
+	if err != nil {
+		return err
+	}
+	autoProvisionFilters, err := filterConfig.AutoProvisionFilters()
+	if err != nil {
+		return err
+	}
+	var gptGenerator block.GPTGenerator
+	if opt.AutoGPTGenerate {
+		// only to explain the disks a GPT partition table would be generated for
+		gptGenerator = block.NewGPTGenerator()
+	}
+	scanner := blockdevicev1.NewScanner(opt.NodeName, opt.Namespace, nil, blockInfo, excludeFilters, autoProvisionFilters,
+		gptGenerator, policyMatcher, nil, 0, sync.NewCond(&sync.Mutex{}), false, nil)
+
+	var out []byte
+	explanations := scanner.ExplainDevices()
+	if opt.ExplainOutput == "json" {
+		out, err = json.MarshalIndent(explanations, "", "  ")
+	} else {
+		out, err = yaml.Marshal(explanations)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(string(out)))
+	return nil
+}
+
+// getFilterConfig overrides the filter config of the flags with the filter
+// ConfigMap, if any.
+func getFilterConfig(clientset kubernetes.Interface, opt *option.Option, config filter.Config) (filter.Config, error) {
+	if opt.FilterConfigMap == "" {
+		return config, nil
+	}
+	cm, err := clientset.CoreV1().ConfigMaps(opt.Namespace).Get(context.TODO(), opt.FilterConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return config, nil
+	} else if err != nil {
+		return config, fmt.Errorf("failed to get filter ConfigMap %s/%s: %w", opt.Namespace, opt.FilterConfigMap, err)
+	}
+	return filter.ParseConfigData(cm.Data, opt.NodeName, config)
+}
+
 func run(opt *option.Option) error {
 	logrus.Info("Starting node disk manager controller")
 	if opt.NodeName == "" || opt.Namespace == "" {
@@ -198,6 +522,11 @@ func run(opt *option.Option) error {
 
 	ctx := signals.SetupSignalContext()
 
+	var gptGenerator block.GPTGenerator
+	if opt.AutoGPTGenerate {
+		gptGenerator = block.NewGPTGenerator()
+	}
+
 	// register block device detector
 	block, err := block.New()
 	if err != nil {
@@ -219,13 +548,35 @@ func run(opt *option.Option) error {
 		return fmt.Errorf("error building node-disk-manager controllers: %s", err.Error())
 	}
 
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building kubernetes clientset: %s", err.Error())
+	}
+
 	terminatedChannel := make(chan bool, 1)
-	excludeFilters := filter.SetExcludeFilters(opt.VendorFilter, opt.PathFilter, opt.LabelFilter)
-	autoProvisionFilters := filter.SetAutoProvisionFilters(opt.AutoProvisionFilter)
+	filterConfig := newFilterConfig(opt)
+	excludeFilters, err := filterConfig.ExcludeFilters()
+	if err != nil {
+		return err
+	}
+	autoProvisionFilters, err := filterConfig.AutoProvisionFilters()
+	if err != nil {
+		return err
+	}
 	locker := &sync.Mutex{}
 	cond := sync.NewCond(locker)
 	bds := disks.Harvesterhci().V1beta1().BlockDevice()
+	policies := disks.Harvesterhci().V1beta1().DiskProvisionPolicy()
 	nodes := lhs.Longhorn().V1beta2().Node()
+	// only the node of NDM is cached, whose labels the policies select
+	nodeInformerFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opt.NodeName).String()
+		}),
+	)
+	kubeNodes := nodeInformerFactory.Core().V1().Nodes()
+	policyMatcher := blockdevicev1.NewProvisionPolicyMatcher(opt.NodeName, policies.Cache(), kubeNodes.Lister())
+	recorder := events.NewRecorder(ctx, clientset.CoreV1(), diskscheme.Scheme, "harvester-node-disk-manager", opt.NodeName)
 	scanner := blockdevicev1.NewScanner(
 		opt.NodeName,
 		opt.Namespace,
@@ -233,27 +584,47 @@ func run(opt *option.Option) error {
 		block,
 		excludeFilters,
 		autoProvisionFilters,
+		gptGenerator,
+		policyMatcher,
+		recorder,
+		time.Duration(opt.RescanInterval)*time.Second,
 		cond,
 		false,
 		&terminatedChannel,
 	)
 
 	start := func(ctx context.Context) {
+		// the node is cached before the scanner starts to apply the policies
+		blockdevicev1.RegisterNodeLabelsHandler(kubeNodes.Informer(), scanner)
+		nodeInformerFactory.Start(ctx.Done())
+		nodeInformerFactory.WaitForCacheSync(ctx.Done())
+
 		if err := blockdevicev1.Register(
 			ctx,
 			nodes,
 			bds,
+			policies,
 			block,
 			opt,
 			scanner,
+			recorder,
+			clientset.CoreV1().Secrets(opt.Namespace),
 		); err != nil {
 			logrus.Fatalf("failed to register block device controller, %s", err.Error())
 		}
 
+		if err := filterconfig.Register(ctx, clientset, opt, filterConfig, scanner); err != nil {
+			logrus.Fatalf("failed to register filter config controller, %s", err.Error())
+		}
+
 		if err := nodev1.Register(ctx, nodes, bds, opt); err != nil {
 			logrus.Fatalf("failed to register ndm node controller, %s", err.Error())
 		}
 
+		if err := metrics.RegisterBlockDeviceCollector(opt.NodeName, opt.Namespace, bds.Cache()); err != nil {
+			logrus.Fatalf("failed to register block device metrics, %s", err.Error())
+		}
+
 		if err := start.All(ctx, opt.Threadiness, disks, lhs); err != nil {
 			logrus.Fatalf("error starting, %s", err.Error())
 		}
@@ -278,3 +649,22 @@ func run(opt *option.Option) error {
 	<-terminatedChannel
 	return nil
 }
+
+// newFilterConfig returns the filter config of the flags
+func newFilterConfig(opt *option.Option) filter.Config {
+	return filter.Config{
+		VendorFilter:            opt.VendorFilter,
+		PathFilter:              opt.PathFilter,
+		LabelFilter:             opt.LabelFilter,
+		PartTypeFilter:          opt.PartTypeFilter,
+		AutoProvisionFilter:     opt.AutoProvisionFilter,
+		SizeFilter:              opt.SizeFilter,
+		ModelFilter:             opt.ModelFilter,
+		SerialFilter:            opt.SerialFilter,
+		WWNFilter:               opt.WWNFilter,
+		BusPathFilter:           opt.BusPathFilter,
+		StorageControllerFilter: opt.StorageControllerFilter,
+		ExcludeExpression:       opt.ExcludeExpression,
+		AutoProvisionExpression: opt.AutoProvisionExpression,
+	}
+}
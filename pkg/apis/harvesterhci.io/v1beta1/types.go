@@ -7,9 +7,15 @@ import (
 )
 
 var (
-	DeviceMounted    condition.Cond = "Mounted"
-	DeviceFormatting condition.Cond = "Formatting"
-	DiskAddedToNode  condition.Cond = "AddedToNode"
+	DeviceMounted         condition.Cond = "Mounted"
+	DeviceFormatting      condition.Cond = "Formatting"
+	DiskAddedToNode       condition.Cond = "AddedToNode"
+	DeviceHealthy         condition.Cond = "Healthy"
+	DiskEvictionRequested condition.Cond = "EvictionRequested"
+	DeviceAddedToVG       condition.Cond = "AddedToVolumeGroup"
+	DeviceReplaced        condition.Cond = "Replaced"
+	DiskPartitioned       condition.Cond = "Partitioned"
+	DeviceExpanded        condition.Cond = "Expanded"
 )
 
 // +genclient
@@ -42,6 +48,86 @@ type BlockDeviceSpec struct {
 
 	// a string list with device tag for provisioner, e.g. ["default", "small", "ssd"]
 	Tags []string `json:"tags,omitempty"`
+
+	// the provisioner of the device when spec.fileSystem.provisioned is true, the device is
+	// provisioned as a Longhorn disk if not set
+	// +optional
+	Provisioner *ProvisionerInfo `json:"provisioner,omitempty"`
+
+	// the name of an inactive block device of the same node replaced by this device, the tags and
+	// the provisioning of it are moved to this device, and it is deleted once the replicas are
+	// evicted from it
+	// +optional
+	Replaces string `json:"replaces,omitempty"`
+
+	// wipe the data of the device, only allowed when the device is unprovisioned. The wipe runs
+	// once, remove it and set it again to wipe the device again
+	// +optional
+	Wipe *WipeInfo `json:"wipe,omitempty"`
+
+	// the GPT partitions to carve the disk into, only allowed for unprovisioned disks. The
+	// partitions are created once and discovered as block devices of type "part", remove it and
+	// set it again to partition the disk again
+	// +optional
+	Partitions []PartitionInfo `json:"partitions,omitempty"`
+}
+
+type PartitionInfo struct {
+	// a string with the name of the partition in the GPT partition table, e.g. "longhorn"
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:MaxLength:=36
+	Name string `json:"name"`
+
+	// a string with the size of the partition, a quantity like "500Gi", a percentage of the disk
+	// like "30%", or "rest" for the rest of the disk, which is only allowed for the last partition
+	// +kubebuilder:validation:Required
+	Size string `json:"size"`
+
+	// a string with the GPT partition type GUID, the Linux filesystem data type by default
+	// +optional
+	TypeGUID string `json:"typeGUID,omitempty"`
+
+	// a string with the filesystem type to format the partition with, options are "ext4" or
+	// "xfs". The partition is not formatted if not set
+	// +kubebuilder:validation:Enum:=ext4;xfs
+	// +optional
+	FileSystem string `json:"fileSystem,omitempty"`
+}
+
+type WipeInfo struct {
+	// a string with the mode of wiping the device, options are "wipefs" to wipe the signatures only,
+	// "discard" to discard all blocks, "zero" to overwrite all blocks with zeros, "nvmeFormat" and
+	// "nvmeSanitize" to erase the user data of NVMe disks, or "ataSecureErase" for ATA disks
+	// +kubebuilder:validation:Enum:=wipefs;discard;zero;nvmeFormat;nvmeSanitize;ataSecureErase
+	// +kubebuilder:validation:Required
+	Mode WipeMode `json:"mode"`
+}
+
+type ProvisionerInfo struct {
+	// provision the device as a Longhorn disk, which is the default
+	// +optional
+	Longhorn *LonghornProvisionerInfo `json:"longhorn,omitempty"`
+
+	// provision the device as a LVM physical volume of a volume group
+	// +optional
+	LVM *LVMProvisionerInfo `json:"lvm,omitempty"`
+}
+
+type LonghornProvisionerInfo struct {
+	// a string with the type of the Longhorn disk, options are "filesystem" for the V1 data engine
+	// or "block" for the V2 data engine. A block disk is used raw, without formatting and mounting
+	// +kubebuilder:validation:Enum:=filesystem;block
+	// +kubebuilder:default:=filesystem
+	// +optional
+	DiskType string `json:"diskType,omitempty"`
+}
+
+type LVMProvisionerInfo struct {
+	// the name of the LVM volume group to add the device to, it is created if not exists
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	VgName string `json:"vgName"`
 }
 
 type BlockDeviceStatus struct {
@@ -49,6 +135,10 @@ type BlockDeviceStatus struct {
 	// +kubebuilder:validation:Enum:=Active;Inactive;Unknown
 	State BlockDeviceState `json:"state"`
 
+	// the time the block device became inactive, it is unset once the device is active again
+	// +optional
+	InactiveSince *metav1.Time `json:"inactiveSince,omitempty"`
+
 	// The current phase of the block device being provisioned.
 	// +kubebuilder:validation:Enum:=Provisioned;Unprovisioned;Unprovisioning
 	// +kubebuilder:default:=Unprovisioned
@@ -62,6 +152,53 @@ type BlockDeviceStatus struct {
 
 	// The current Tags of the blockdevice
 	Tags []string `json:"tags,omitempty"`
+
+	// the LVM volume group the device is added to as a physical volume
+	// +optional
+	VolumeGroup *VolumeGroupStatus `json:"volumeGroup,omitempty"`
+
+	// the name of the DiskProvisionPolicy applied to the device when it was discovered
+	// +optional
+	ProvisionPolicy string `json:"provisionPolicy,omitempty"`
+
+	// the progress of the wipe requested in spec.wipe
+	// +optional
+	Wipe *WipeStatus `json:"wipe,omitempty"`
+}
+
+type WipeStatus struct {
+	// the mode of the wipe
+	Mode WipeMode `json:"mode"`
+
+	// the current phase of the wipe, options are "Wiping", "Wiped" or "Failed"
+	// +kubebuilder:validation:Enum:=Wiping;Wiped;Failed
+	Phase WipePhase `json:"phase"`
+
+	// the estimated progress of the wipe, in percentage
+	Progress int32 `json:"progress,omitempty"`
+
+	// a human-readable message of why the wipe failed
+	Message string `json:"message,omitempty"`
+
+	// the time the wipe started
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+
+	// the time the wipe completed
+	LastWipedAt *metav1.Time `json:"lastWipedAt,omitempty"`
+}
+
+type VolumeGroupStatus struct {
+	// the name of the volume group
+	Name string `json:"name"`
+
+	// the total size of the volume group, in bytes
+	SizeBytes uint64 `json:"sizeBytes"`
+
+	// the size of the volume group not allocated to logical volumes, in bytes
+	FreeBytes uint64 `json:"freeBytes"`
+
+	// the size of the volume group allocated to logical volumes, in bytes
+	UsedBytes uint64 `json:"usedBytes"`
 }
 
 type FilesystemInfo struct {
@@ -77,6 +214,38 @@ type FilesystemInfo struct {
 
 	// a bool indicating whether the filesystem is manually repaired of not
 	Repaired bool `json:"repaired,omitempty"`
+
+	// a string with the mode to check the unmounted filesystem in, options are "auto" to repair the errors found
+	// or "readonly-check" to only report them, the filesystem is checked once until it is removed
+	// +kubebuilder:validation:Enum:=auto;readonly-check
+	// +optional
+	Repair FilesystemRepairMode `json:"repair,omitempty"`
+
+	// a bool indicating whether the mounted filesystem is expanded online once the device grows
+	// +optional
+	AutoExpand bool `json:"autoExpand,omitempty"`
+
+	// a string with the filesystem type used to format and mount the device, options are "ext4" or "xfs"
+	// +kubebuilder:validation:Enum:=ext4;xfs
+	// +kubebuilder:default:=ext4
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// a string list with extra options to mount the filesystem with, e.g. ["noatime", "discard"]
+	// only options allowed for the filesystem type are accepted
+	// +optional
+	MountOptions []string `json:"mountOptions,omitempty"`
+
+	// an object referencing the Secret with the key to encrypt the device with LUKS when it is formatted
+	// +optional
+	Encryption *EncryptionInfo `json:"encryption,omitempty"`
+}
+
+type EncryptionInfo struct {
+	// a string with the name of the Secret in the namespace of the block device, which holds
+	// either a "passphrase" or a "keyfile" to encrypt the device with
+	// +kubebuilder:validation:MinLength:=1
+	SecretName string `json:"secretName"`
 }
 
 type DeviceStatus struct {
@@ -97,6 +266,38 @@ type DeviceStatus struct {
 	DevPath string `json:"devPath"`
 
 	FileSystem *FilesystemStatus `json:"fileSystem"`
+
+	// a string list with the device paths underlying a multipath device, e.g. ["/dev/sdb", "/dev/sdc"]
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+
+	// a object describe the disk health reported by SMART or the NVMe health log
+	// +optional
+	Health *DeviceHealth `json:"health,omitempty"`
+}
+
+type DeviceHealth struct {
+	// the overall health self-assessment of the disk, options are "Passed", "Failed" or "Unknown"
+	// +kubebuilder:validation:Enum:=Passed;Failed;Unknown
+	OverallStatus DeviceHealthStatus `json:"overallStatus"`
+
+	// the current temperature of the disk in Celsius
+	Temperature int64 `json:"temperature,omitempty"`
+
+	// the count of reallocated sectors, or the grown defects of SCSI disks
+	ReallocatedSectors int64 `json:"reallocatedSectors,omitempty"`
+
+	// the estimate of the used life of NVMe disks, in percentage
+	PercentageUsed int64 `json:"percentageUsed,omitempty"`
+
+	// the count of unrecovered data integrity errors of NVMe disks
+	MediaErrors int64 `json:"mediaErrors,omitempty"`
+
+	// the count of hours the disk is powered on
+	PowerOnHours int64 `json:"powerOnHours,omitempty"`
+
+	// the last time the health of the disk was checked
+	LastCheckedAt *metav1.Time `json:"lastCheckedAt,omitempty"`
 }
 
 type DeviceCapcity struct {
@@ -120,6 +321,9 @@ type DeviceDetails struct {
 	// PartUUID is a partition-table-level UUID for the partition, a standard feature for all partitions on GPT-partitioned disks
 	PartUUID string `json:"partUUID,omitempty"`
 
+	// PartType is the partition type GUID of the partition on GPT-partitioned disks
+	PartType string `json:"partType,omitempty"`
+
 	// UUID is a filesystem-level UUID, which is retrieved from the filesystem metadata inside the partition
 	// This would be volume UUID on macOS, PartUUID on linux, empty on Windows
 	UUID string `json:"uuid,omitempty"`
@@ -127,6 +331,9 @@ type DeviceDetails struct {
 	// PtUUID is the UUID of the partition table itself, a unique identifier for the entire disk assigned at the time the disk was partitioned
 	PtUUID string `json:"ptUUID,omitempty"`
 
+	// DMUUID is the device-mapper UUID of the device, e.g. "mpath-<wwid>" for a multipath device
+	DMUUID string `json:"dmUUID,omitempty"`
+
 	// contains a boolean indicating if the disk drive is removable
 	IsRemovable bool `json:"isRemovable,omitempty"`
 
@@ -171,6 +378,37 @@ type FilesystemStatus struct {
 
 	// indicating whether the filesystem is corrupted or not
 	Corrupted bool `json:"corrupted,omitempty"`
+
+	// indicating whether the filesystem is on a LUKS device, which is opened as /dev/mapper/ndm-<name>
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// the result of the filesystem check requested by spec.fileSystem.repair
+	// +optional
+	Check *FilesystemCheckStatus `json:"check,omitempty"`
+}
+
+type FilesystemCheckStatus struct {
+	// the mode the filesystem is checked in
+	Mode FilesystemRepairMode `json:"mode"`
+
+	// a bool indicating whether the filesystem is clean or repaired
+	Passed bool `json:"passed"`
+
+	// the exit code of e2fsck or xfs_repair, unset if the check could not run
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// the last lines of the output of the check
+	// +optional
+	Summary string `json:"summary,omitempty"`
+
+	// the error if the checker failed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// the time the check finished
+	// +optional
+	CheckedAt *metav1.Time `json:"checkedAt,omitempty"`
 }
 
 type StorageController string
@@ -201,6 +439,50 @@ const (
 	DriveTypeSSD DriveType = "SSD"
 )
 
+const (
+	// LonghornDiskTypeFilesystem is the Longhorn disk type of a formatted and mounted device
+	LonghornDiskTypeFilesystem = "filesystem"
+	// LonghornDiskTypeBlock is the Longhorn disk type of a raw device for the V2 data engine
+	LonghornDiskTypeBlock = "block"
+)
+
+type WipeMode string
+
+const (
+	// WipeModeWipefs wipes the filesystem, RAID and partition table signatures with wipefs
+	WipeModeWipefs WipeMode = "wipefs"
+	// WipeModeDiscard discards all blocks with blkdiscard
+	WipeModeDiscard WipeMode = "discard"
+	// WipeModeZero overwrites all blocks with zeros
+	WipeModeZero WipeMode = "zero"
+	// WipeModeNVMeFormat formats the NVMe namespace with the user data erase
+	WipeModeNVMeFormat WipeMode = "nvmeFormat"
+	// WipeModeNVMeSanitize sanitizes the NVMe disk with the block erase
+	WipeModeNVMeSanitize WipeMode = "nvmeSanitize"
+	// WipeModeATASecureErase erases the ATA disk with the security erase
+	WipeModeATASecureErase WipeMode = "ataSecureErase"
+)
+
+type FilesystemRepairMode string
+
+const (
+	// FilesystemRepairAuto checks the filesystem and repairs the errors found
+	FilesystemRepairAuto FilesystemRepairMode = "auto"
+	// FilesystemRepairReadOnlyCheck checks the filesystem without modifying it
+	FilesystemRepairReadOnlyCheck FilesystemRepairMode = "readonly-check"
+)
+
+type WipePhase string
+
+const (
+	// WipePhaseWiping indicates the device is being wiped
+	WipePhaseWiping WipePhase = "Wiping"
+	// WipePhaseWiped indicates the wipe completed
+	WipePhaseWiped WipePhase = "Wiped"
+	// WipePhaseFailed indicates the wipe failed
+	WipePhaseFailed WipePhase = "Failed"
+)
+
 type BlockDeviceState string
 
 const (
@@ -214,6 +496,19 @@ const (
 	BlockDeviceUnknown BlockDeviceState = "Unknown"
 )
 
+type DeviceHealthStatus string
+
+const (
+	// DeviceHealthPassed indicates the disk passed the health self-assessment
+	DeviceHealthPassed DeviceHealthStatus = "Passed"
+
+	// DeviceHealthFailed indicates the disk failed the health self-assessment
+	DeviceHealthFailed DeviceHealthStatus = "Failed"
+
+	// DeviceHealthUnknown indicates the health of the disk could not be determined
+	DeviceHealthUnknown DeviceHealthStatus = "Unknown"
+)
+
 type BlockDeviceType string
 
 const (
@@ -254,3 +549,89 @@ type Condition struct {
 	// Human-readable message indicating details about last transition
 	Message string `json:"message,omitempty"`
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:shortName=dpp;dpps,scope=Cluster
+// +kubebuilder:printcolumn:name="Provision",type="boolean",JSONPath=`.spec.action.provision`
+// +kubebuilder:printcolumn:name="Priority",type="integer",JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
+
+type DiskProvisionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DiskProvisionPolicySpec `json:"spec"`
+}
+
+type DiskProvisionPolicySpec struct {
+	// the label selector of the nodes the policy applies to, the policy applies to all nodes if not set
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// the disks the policy applies to, a disk matches if it meets all the criteria set
+	// +optional
+	DiskSelector DiskSelector `json:"diskSelector,omitempty"`
+
+	// the action to take on the newly discovered disks matching the policy
+	// +kubebuilder:validation:Required
+	Action DiskProvisionAction `json:"action"`
+
+	// the priority of the policy, the one with the highest priority is applied if multiple policies
+	// match a disk, and the one with the smallest name if they have the same priority
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+}
+
+type DiskSelector struct {
+	// the minimum size of the disk, in bytes
+	// +optional
+	MinSizeBytes uint64 `json:"minSizeBytes,omitempty"`
+
+	// the maximum size of the disk, in bytes
+	// +optional
+	MaxSizeBytes uint64 `json:"maxSizeBytes,omitempty"`
+
+	// a string list with the drive types of the disk, e.g. ["SSD"]
+	// +optional
+	DriveTypes []string `json:"driveTypes,omitempty"`
+
+	// a string list with the storage controllers of the disk, e.g. ["NVMe", "SCSI"]
+	// +optional
+	StorageControllers []string `json:"storageControllers,omitempty"`
+
+	// a regular expression the vendor of the disk matches
+	// +optional
+	VendorRegex string `json:"vendorRegex,omitempty"`
+
+	// a regular expression the model of the disk matches
+	// +optional
+	ModelRegex string `json:"modelRegex,omitempty"`
+
+	// a string list with the World Wide Names of the disk
+	// +optional
+	WWNs []string `json:"wwns,omitempty"`
+
+	// a string list with the glob patterns the bus path of the disk matches, e.g. ["pci-0000:00:1f.2-ata-*"]
+	// +optional
+	BusPaths []string `json:"busPaths,omitempty"`
+}
+
+type DiskProvisionAction struct {
+	// a bool indicating whether the disk is provisioned
+	// +optional
+	Provision bool `json:"provision,omitempty"`
+
+	// a bool indicating whether the disk is force formatted, even if it is not provisioned
+	// +optional
+	ForceFormatted bool `json:"forceFormatted,omitempty"`
+
+	// a string with the filesystem type used to format the disk, options are "ext4" or "xfs"
+	// +kubebuilder:validation:Enum:=ext4;xfs
+	// +optional
+	FileSystemType string `json:"fileSystemType,omitempty"`
+
+	// a string list with the Longhorn disk tags of the disk, e.g. ["default", "ssd"]
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+}
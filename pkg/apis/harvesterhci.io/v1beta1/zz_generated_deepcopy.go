@@ -22,6 +22,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -92,13 +93,28 @@ func (in *BlockDeviceSpec) DeepCopyInto(out *BlockDeviceSpec) {
 	if in.FileSystem != nil {
 		in, out := &in.FileSystem, &out.FileSystem
 		*out = new(FilesystemInfo)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Tags != nil {
 		in, out := &in.Tags, &out.Tags
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Provisioner != nil {
+		in, out := &in.Provisioner, &out.Provisioner
+		*out = new(ProvisionerInfo)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Wipe != nil {
+		in, out := &in.Wipe, &out.Wipe
+		*out = new(WipeInfo)
+		**out = **in
+	}
+	if in.Partitions != nil {
+		in, out := &in.Partitions, &out.Partitions
+		*out = make([]PartitionInfo, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -115,6 +131,10 @@ func (in *BlockDeviceSpec) DeepCopy() *BlockDeviceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BlockDeviceStatus) DeepCopyInto(out *BlockDeviceStatus) {
 	*out = *in
+	if in.InactiveSince != nil {
+		in, out := &in.InactiveSince, &out.InactiveSince
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]Condition, len(*in))
@@ -126,6 +146,16 @@ func (in *BlockDeviceStatus) DeepCopyInto(out *BlockDeviceStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.VolumeGroup != nil {
+		in, out := &in.VolumeGroup, &out.VolumeGroup
+		*out = new(VolumeGroupStatus)
+		**out = **in
+	}
+	if in.Wipe != nil {
+		in, out := &in.Wipe, &out.Wipe
+		*out = new(WipeStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -187,6 +217,26 @@ func (in *DeviceDetails) DeepCopy() *DeviceDetails {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceHealth) DeepCopyInto(out *DeviceHealth) {
+	*out = *in
+	if in.LastCheckedAt != nil {
+		in, out := &in.LastCheckedAt, &out.LastCheckedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceHealth.
+func (in *DeviceHealth) DeepCopy() *DeviceHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DeviceStatus) DeepCopyInto(out *DeviceStatus) {
 	*out = *in
@@ -197,6 +247,16 @@ func (in *DeviceStatus) DeepCopyInto(out *DeviceStatus) {
 		*out = new(FilesystemStatus)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(DeviceHealth)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -210,9 +270,200 @@ func (in *DeviceStatus) DeepCopy() *DeviceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskProvisionAction) DeepCopyInto(out *DiskProvisionAction) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskProvisionAction.
+func (in *DiskProvisionAction) DeepCopy() *DiskProvisionAction {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskProvisionAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskProvisionPolicy) DeepCopyInto(out *DiskProvisionPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskProvisionPolicy.
+func (in *DiskProvisionPolicy) DeepCopy() *DiskProvisionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskProvisionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DiskProvisionPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskProvisionPolicyList) DeepCopyInto(out *DiskProvisionPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DiskProvisionPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskProvisionPolicyList.
+func (in *DiskProvisionPolicyList) DeepCopy() *DiskProvisionPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskProvisionPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DiskProvisionPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskProvisionPolicySpec) DeepCopyInto(out *DiskProvisionPolicySpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.DiskSelector.DeepCopyInto(&out.DiskSelector)
+	in.Action.DeepCopyInto(&out.Action)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskProvisionPolicySpec.
+func (in *DiskProvisionPolicySpec) DeepCopy() *DiskProvisionPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskProvisionPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskSelector) DeepCopyInto(out *DiskSelector) {
+	*out = *in
+	if in.DriveTypes != nil {
+		in, out := &in.DriveTypes, &out.DriveTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StorageControllers != nil {
+		in, out := &in.StorageControllers, &out.StorageControllers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.WWNs != nil {
+		in, out := &in.WWNs, &out.WWNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BusPaths != nil {
+		in, out := &in.BusPaths, &out.BusPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskSelector.
+func (in *DiskSelector) DeepCopy() *DiskSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EncryptionInfo) DeepCopyInto(out *EncryptionInfo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EncryptionInfo.
+func (in *EncryptionInfo) DeepCopy() *EncryptionInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(EncryptionInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilesystemCheckStatus) DeepCopyInto(out *FilesystemCheckStatus) {
+	*out = *in
+	if in.ExitCode != nil {
+		in, out := &in.ExitCode, &out.ExitCode
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CheckedAt != nil {
+		in, out := &in.CheckedAt, &out.CheckedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilesystemCheckStatus.
+func (in *FilesystemCheckStatus) DeepCopy() *FilesystemCheckStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FilesystemCheckStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FilesystemInfo) DeepCopyInto(out *FilesystemInfo) {
 	*out = *in
+	if in.MountOptions != nil {
+		in, out := &in.MountOptions, &out.MountOptions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(EncryptionInfo)
+		**out = **in
+	}
 	return
 }
 
@@ -233,6 +484,11 @@ func (in *FilesystemStatus) DeepCopyInto(out *FilesystemStatus) {
 		in, out := &in.LastFormattedAt, &out.LastFormattedAt
 		*out = (*in).DeepCopy()
 	}
+	if in.Check != nil {
+		in, out := &in.Check, &out.Check
+		*out = new(FilesystemCheckStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -245,3 +501,133 @@ func (in *FilesystemStatus) DeepCopy() *FilesystemStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LVMProvisionerInfo) DeepCopyInto(out *LVMProvisionerInfo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LVMProvisionerInfo.
+func (in *LVMProvisionerInfo) DeepCopy() *LVMProvisionerInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(LVMProvisionerInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LonghornProvisionerInfo) DeepCopyInto(out *LonghornProvisionerInfo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LonghornProvisionerInfo.
+func (in *LonghornProvisionerInfo) DeepCopy() *LonghornProvisionerInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(LonghornProvisionerInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PartitionInfo) DeepCopyInto(out *PartitionInfo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PartitionInfo.
+func (in *PartitionInfo) DeepCopy() *PartitionInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(PartitionInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProvisionerInfo) DeepCopyInto(out *ProvisionerInfo) {
+	*out = *in
+	if in.Longhorn != nil {
+		in, out := &in.Longhorn, &out.Longhorn
+		*out = new(LonghornProvisionerInfo)
+		**out = **in
+	}
+	if in.LVM != nil {
+		in, out := &in.LVM, &out.LVM
+		*out = new(LVMProvisionerInfo)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProvisionerInfo.
+func (in *ProvisionerInfo) DeepCopy() *ProvisionerInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(ProvisionerInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeGroupStatus) DeepCopyInto(out *VolumeGroupStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeGroupStatus.
+func (in *VolumeGroupStatus) DeepCopy() *VolumeGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WipeInfo) DeepCopyInto(out *WipeInfo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WipeInfo.
+func (in *WipeInfo) DeepCopy() *WipeInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(WipeInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WipeStatus) DeepCopyInto(out *WipeStatus) {
+	*out = *in
+	if in.StartedAt != nil {
+		in, out := &in.StartedAt, &out.StartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastWipedAt != nil {
+		in, out := &in.LastWipedAt, &out.LastWipedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WipeStatus.
+func (in *WipeStatus) DeepCopy() *WipeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WipeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -40,3 +40,20 @@ func NewBlockDevice(namespace, name string, obj BlockDevice) *BlockDevice {
 	obj.Namespace = namespace
 	return &obj
 }
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DiskProvisionPolicyList is a list of DiskProvisionPolicy resources
+type DiskProvisionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []DiskProvisionPolicy `json:"items"`
+}
+
+func NewDiskProvisionPolicy(namespace, name string, obj DiskProvisionPolicy) *DiskProvisionPolicy {
+	obj.APIVersion, obj.Kind = SchemeGroupVersion.WithKind("DiskProvisionPolicy").ToAPIVersionAndKind()
+	obj.Name = name
+	obj.Namespace = namespace
+	return &obj
+}
@@ -28,7 +28,8 @@ import (
 )
 
 var (
-	BlockDeviceResourceName = "blockdevices"
+	BlockDeviceResourceName         = "blockdevices"
+	DiskProvisionPolicyResourceName = "diskprovisionpolicies"
 )
 
 // SchemeGroupVersion is group version used to register these objects
@@ -54,6 +55,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&BlockDevice{},
 		&BlockDeviceList{},
+		&DiskProvisionPolicy{},
+		&DiskProvisionPolicyList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
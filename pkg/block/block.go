@@ -1,9 +1,19 @@
 package block
 
 import (
+	"strings"
+
 	"github.com/jaypipes/ghw/pkg/block"
 )
 
+const (
+	// multipathDMUUIDPrefix is the prefix of the DM UUID of dm-multipath devices
+	multipathDMUUIDPrefix = "mpath-"
+	// cryptDMUUIDPrefix is the prefix of the DM UUID of dm-crypt devices, e.g.
+	// CRYPT-LUKS2-<uuid>-<name> for the opened LUKS devices
+	cryptDMUUIDPrefix = "CRYPT-"
+)
+
 // borrowed from https://github.com/jaypipes/ghw/blob/master/pkg/block/block.go
 
 // Disk describes a single disk drive on the host system. Disk drives provide
@@ -26,6 +36,38 @@ type Disk struct {
 	SerialNumber           string                  `json:"serial_number"`
 	WWN                    string                  `json:"wwn"`
 	Partitions             []*Partition            `json:"partitions"`
+	// DMUUID is the device-mapper UUID, e.g. mpath-<wwid> for multipath devices
+	DMUUID string `json:"dm_uuid"`
+	// Paths are the names of the underlying devices of a multipath device
+	Paths []string `json:"paths"`
+	// MultipathHolder is the name of the multipath device which the disk is a path of
+	MultipathHolder string `json:"multipath_holder"`
+}
+
+// IsMultipath returns true if the disk is a dm-multipath device
+func (d *Disk) IsMultipath() bool {
+	return isMultipathDMUUID(d.DMUUID)
+}
+
+// IsMultipathPath returns true if the disk is one of the paths of a dm-multipath device
+func (d *Disk) IsMultipathPath() bool {
+	return d.MultipathHolder != ""
+}
+
+// IsMultipathPartition returns true if the disk is a partition of a dm-multipath
+// device mapped by kpartx, which has a DM UUID like part1-mpath-<wwid>
+func (d *Disk) IsMultipathPartition() bool {
+	return strings.HasPrefix(d.DMUUID, "part") && strings.Contains(d.DMUUID, "-"+multipathDMUUIDPrefix)
+}
+
+// IsCrypt returns true if the disk is a dm-crypt device, e.g. an opened LUKS
+// device, which is the same disk as the encrypted one
+func (d *Disk) IsCrypt() bool {
+	return strings.HasPrefix(d.DMUUID, cryptDMUUIDPrefix)
+}
+
+func isMultipathDMUUID(dmUUID string) bool {
+	return strings.HasPrefix(dmUUID, multipathDMUUIDPrefix)
 }
 
 // Partition describes a logical division of a Disk.
@@ -43,7 +85,8 @@ type Partition struct {
 }
 
 type FileSystemInfo struct {
-	Type       string `json:"type"`
-	IsReadOnly bool   `json:"read_only"`
-	MountPoint string `json:"mount_point"`
+	Type         string   `json:"type"`
+	IsReadOnly   bool     `json:"read_only"`
+	MountPoint   string   `json:"mount_point"`
+	MountOptions []string `json:"mount_options"`
 }
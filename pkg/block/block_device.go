@@ -44,6 +44,7 @@ type Info interface {
 	GetDiskByDevPath(name string) *Disk
 	GetPartitionByDevPath(disk, part string) *Partition
 	GetFileSystemInfoByDevPath(dname string) *FileSystemInfo
+	GetDiskIOErrorCount(name string) uint64
 }
 
 type infoImpl struct {
@@ -96,12 +97,38 @@ func (i *infoImpl) GetPartitionByDevPath(disk, part string) *Partition {
 
 func (i *infoImpl) GetFileSystemInfoByDevPath(dname string) *FileSystemInfo {
 	paths := linuxpath.New(i.ctx)
-	mp, pt, ro := partitionInfo(i.ctx, paths, dname)
+	entry := partitionMountEntry(i.ctx, paths, dname)
+	if entry == nil {
+		return &FileSystemInfo{IsReadOnly: true}
+	}
 	return &FileSystemInfo{
-		MountPoint: mp,
-		Type:       pt,
-		IsReadOnly: ro,
+		MountPoint:   entry.Mountpoint,
+		Type:         entry.FilesystemType,
+		IsReadOnly:   entry.isReadOnly(),
+		MountOptions: entry.Options,
+	}
+}
+
+func (i *infoImpl) GetDiskIOErrorCount(name string) uint64 {
+	name = strings.TrimPrefix(name, "/dev/")
+	paths := linuxpath.New(i.ctx)
+	return diskIOErrorCount(paths, name)
+}
+
+func diskIOErrorCount(paths *linuxpath.Paths, disk string) uint64 {
+	// The count of commands completed with an error is found in the
+	// /sys/block/$DEVICE/device/ioerr_cnt file in sysfs, in hex.
+	// It is only available for SCSI disks.
+	path := filepath.Join(paths.SysBlock, disk, "device", "ioerr_cnt")
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	count, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(contents)), "0x"), 16, 64)
+	if err != nil {
+		return 0
 	}
+	return count
 }
 
 func diskPhysicalBlockSizeBytes(paths *linuxpath.Paths, disk string) uint64 {
@@ -245,6 +272,91 @@ func diskWWN(paths *linuxpath.Paths, disk string) string {
 	return util.UNKNOWN
 }
 
+func diskDMUUID(paths *linuxpath.Paths, disk string) string {
+	if !strings.HasPrefix(disk, "dm-") {
+		return ""
+	}
+	info, err := udevInfo(paths, disk)
+	if err != nil {
+		return ""
+	}
+	return info["DM_UUID"]
+}
+
+// diskSlaves returns the names of the devices underlying a device-mapper
+// device, found in /sys/block/$DEVICE/slaves
+func diskSlaves(paths *linuxpath.Paths, disk string) []string {
+	entries, err := os.ReadDir(filepath.Join(paths.SysBlock, disk, "slaves"))
+	if err != nil {
+		return nil
+	}
+	slaves := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		slaves = append(slaves, entry.Name())
+	}
+	return slaves
+}
+
+// diskMultipathHolder returns the name of the multipath device holding the
+// disk as one of its paths, found in /sys/block/$DEVICE/holders
+func diskMultipathHolder(paths *linuxpath.Paths, disk string) string {
+	entries, err := os.ReadDir(filepath.Join(paths.SysBlock, disk, "holders"))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if isMultipathDMUUID(diskDMUUID(paths, entry.Name())) {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+// GetMultipathHolderDevPath returns the path of the multipath device holding
+// the device as one of its paths, or an empty string if there is none.
+func GetMultipathHolderDevPath(devPath string) string {
+	paths := linuxpath.New(context.New())
+	if holder := diskMultipathHolder(paths, strings.TrimPrefix(devPath, "/dev/")); holder != "" {
+		return ndmutils.GetFullDevPath(holder)
+	}
+	return ""
+}
+
+// deviceHolders returns the names of the devices holding the device or any
+// of its partitions, e.g. the device-mapper devices of LVM, LUKS or
+// multipath, found in /sys/block/$DEVICE/holders for a disk, or
+// /sys/block/$DISK/$PARTITION/holders for a partition.
+func deviceHolders(paths *linuxpath.Paths, name string) []string {
+	var holders []string
+	seen := map[string]bool{}
+	for _, pattern := range []string{
+		filepath.Join(paths.SysBlock, name, "holders"),
+		filepath.Join(paths.SysBlock, name, name+"*", "holders"),
+		filepath.Join(paths.SysBlock, "*", name, "holders"),
+	} {
+		dirs, _ := filepath.Glob(pattern)
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if !seen[entry.Name()] {
+					seen[entry.Name()] = true
+					holders = append(holders, entry.Name())
+				}
+			}
+		}
+	}
+	return holders
+}
+
+// GetHolders returns the names of the devices holding the device or any of
+// its partitions, so it is in use even if nothing is mounted.
+func GetHolders(devPath string) []string {
+	return deviceHolders(linuxpath.New(context.New()), strings.TrimPrefix(devPath, "/dev/"))
+}
+
 // diskPartitions takes the name of a disk (note: *not* the path of the disk,
 // but just the name. In other words, "sda", not "/dev/sda" and "nvme0n1" not
 // "/dev/nvme0n1") and returns a slice of pointers to Partition structs
@@ -307,7 +419,19 @@ func diskIsRemovable(paths *linuxpath.Paths, disk string) bool {
 }
 
 func getDisk(ctx *context.Context, paths *linuxpath.Paths, dname string) *Disk {
-	driveType, storageController := diskTypes(dname)
+	// A multipath device is the same disk as its paths, so it takes the
+	// identity of its first path, i.e. WWN, vendor, model and serial number.
+	dmUUID := diskDMUUID(paths, dname)
+	var mpathPaths []string
+	identityName := dname
+	if isMultipathDMUUID(dmUUID) {
+		mpathPaths = diskSlaves(paths, dname)
+		if len(mpathPaths) > 0 {
+			identityName = mpathPaths[0]
+		}
+	}
+
+	driveType, storageController := diskTypes(identityName)
 	// TODO(jaypipes): Move this into diskTypes() once abstracting
 	// diskIsRotational for ease of unit testing
 	if !diskIsRotational(ctx, paths, dname) {
@@ -315,12 +439,12 @@ func getDisk(ctx *context.Context, paths *linuxpath.Paths, dname string) *Disk {
 	}
 	size := diskSizeBytes(paths, dname)
 	pbs := diskPhysicalBlockSizeBytes(paths, dname)
-	busPath := diskBusPath(paths, dname)
+	busPath := diskBusPath(paths, identityName)
 	node := diskNUMANodeID(paths, dname)
-	vendor := diskVendor(paths, dname)
-	model := diskModel(paths, dname)
-	serialNo := diskSerialNumber(paths, dname)
-	wwn := diskWWN(paths, dname)
+	vendor := diskVendor(paths, identityName)
+	model := diskModel(paths, identityName)
+	serialNo := diskSerialNumber(paths, identityName)
+	wwn := diskWWN(paths, identityName)
 	removable := diskIsRemovable(paths, dname)
 	uuid := GetDiskUUID(dname, string(UUID))
 	ptuuid := GetDiskUUID(dname, string(PTUUID))
@@ -358,6 +482,9 @@ func getDisk(ctx *context.Context, paths *linuxpath.Paths, dname string) *Disk {
 		SerialNumber:           serialNo,
 		WWN:                    wwn,
 		FileSystemInfo:         fs,
+		DMUUID:                 dmUUID,
+		Paths:                  mpathPaths,
+		MultipathHolder:        diskMultipathHolder(paths, dname),
 	}
 
 	parts := diskPartitions(ctx, paths, dname)
@@ -454,6 +581,16 @@ func partitionSizeBytes(paths *linuxpath.Paths, disk string, part string) uint64
 // Given a full or short partition name, returns the mount point, the type of
 // the partition and whether it's readonly
 func partitionInfo(ctx *context.Context, paths *linuxpath.Paths, part string) (string, string, bool) {
+	entry := partitionMountEntry(ctx, paths, part)
+	if entry == nil {
+		return "", "", true
+	}
+	return entry.Mountpoint, entry.FilesystemType, entry.isReadOnly()
+}
+
+// Given a full or short partition name, returns its mount entry, or nil if
+// it is not mounted
+func partitionMountEntry(ctx *context.Context, paths *linuxpath.Paths, part string) *mountEntry {
 	// Allow calling PartitionInfo with either the full partition name
 	// "/dev/sda1" or just "sda1"
 	if !strings.HasPrefix(part, "/dev") {
@@ -465,7 +602,7 @@ func partitionInfo(ctx *context.Context, paths *linuxpath.Paths, part string) (s
 	var filer io.ReadCloser
 	filer, err := openProcMounts(ctx, paths)
 	if err != nil {
-		return "", "", true
+		return nil
 	}
 	defer util.SafeClose(filer)
 
@@ -476,17 +613,9 @@ func partitionInfo(ctx *context.Context, paths *linuxpath.Paths, part string) (s
 		if entry == nil || entry.Partition != part {
 			continue
 		}
-		ro := true
-		for _, opt := range entry.Options {
-			if opt == "rw" {
-				ro = false
-				break
-			}
-		}
-
-		return entry.Mountpoint, entry.FilesystemType, ro
+		return entry
 	}
-	return "", "", true
+	return nil
 }
 
 func openProcMounts(ctx *context.Context, paths *linuxpath.Paths) (*os.File, error) {
@@ -505,6 +634,15 @@ type mountEntry struct {
 	Options        []string
 }
 
+func (e *mountEntry) isReadOnly() bool {
+	for _, opt := range e.Options {
+		if opt == "rw" {
+			return false
+		}
+	}
+	return true
+}
+
 func parseMountEntry(line string) *mountEntry {
 	// mount entries for mounted partitions look like this:
 	// /dev/sda6 / ext4 rw,relatime,errors=remount-ro,data=ordered 0 0
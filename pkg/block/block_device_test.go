@@ -0,0 +1,80 @@
+package block
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaypipes/ghw/pkg/context"
+	"github.com/jaypipes/ghw/pkg/linuxpath"
+	"github.com/jaypipes/ghw/pkg/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMultipathPaths fakes the sysfs and udev database of a multipath
+// device dm-3 over the paths sdb and sdc, its partition dm-4, a plain sdd, and
+// sde whose partition sde1 is held by an LVM logical volume dm-5.
+func newTestMultipathPaths(t *testing.T) *linuxpath.Paths {
+	root := t.TempDir()
+	files := map[string]string{
+		"sys/block/dm-3/dev":                 "253:3\n",
+		"sys/block/dm-4/dev":                 "253:4\n",
+		"sys/block/sdb/dev":                  "8:16\n",
+		"sys/block/sdc/dev":                  "8:32\n",
+		"sys/block/sdd/dev":                  "8:48\n",
+		"run/udev/data/b253:3":               "E:DM_NAME=mpatha\nE:DM_UUID=mpath-36001405e3c2d5a8f1e4b4c1b8e9f0a12\n",
+		"run/udev/data/b253:4":               "E:DM_NAME=mpatha1\nE:DM_UUID=part1-mpath-36001405e3c2d5a8f1e4b4c1b8e9f0a12\n",
+		"run/udev/data/b8:16":                "E:ID_WWN=0x6001405e3c2d5a8f\n",
+		"sys/block/dm-3/slaves/sdb/dev":      "8:16\n",
+		"sys/block/dm-3/slaves/sdc/dev":      "8:32\n",
+		"sys/block/dm-3/holders/dm-4/.x":     "",
+		"sys/block/dm-4/slaves/dm-3/.x":      "",
+		"sys/block/sdb/holders/dm-3/.x":      "",
+		"sys/block/sdc/holders/dm-3/.x":      "",
+		"sys/block/sde/sde1/holders/dm-5/.x": "",
+		"sys/block/sde/sde2/dev":             "8:66\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return linuxpath.New(context.New(option.WithChroot(root)))
+}
+
+func Test_multipath(t *testing.T) {
+	paths := newTestMultipathPaths(t)
+
+	assert.Equal(t, "mpath-36001405e3c2d5a8f1e4b4c1b8e9f0a12", diskDMUUID(paths, "dm-3"))
+	assert.Equal(t, "", diskDMUUID(paths, "sdb"))
+	assert.Equal(t, []string{"sdb", "sdc"}, diskSlaves(paths, "dm-3"))
+	assert.Empty(t, diskSlaves(paths, "sdd"))
+
+	assert.Equal(t, "dm-3", diskMultipathHolder(paths, "sdb"))
+	assert.Equal(t, "dm-3", diskMultipathHolder(paths, "sdc"))
+	assert.Equal(t, "", diskMultipathHolder(paths, "sdd"))
+	// the partition is not a path of the multipath device
+	assert.Equal(t, "", diskMultipathHolder(paths, "dm-3"))
+
+	mpath := &Disk{Name: "dm-3", DMUUID: diskDMUUID(paths, "dm-3")}
+	assert.True(t, mpath.IsMultipath())
+	assert.False(t, mpath.IsMultipathPartition())
+	part := &Disk{Name: "dm-4", DMUUID: diskDMUUID(paths, "dm-4")}
+	assert.False(t, part.IsMultipath())
+	assert.True(t, part.IsMultipathPartition())
+	path := &Disk{Name: "sdb", MultipathHolder: diskMultipathHolder(paths, "sdb")}
+	assert.True(t, path.IsMultipathPath())
+}
+
+func Test_deviceHolders(t *testing.T) {
+	paths := newTestMultipathPaths(t)
+
+	assert.Equal(t, []string{"dm-3"}, deviceHolders(paths, "sdb"))
+	assert.Equal(t, []string{"dm-4"}, deviceHolders(paths, "dm-3"))
+	assert.Empty(t, deviceHolders(paths, "sdd"))
+	// the holders of the partitions are the ones of the disk too
+	assert.Equal(t, []string{"dm-5"}, deviceHolders(paths, "sde"))
+	assert.Equal(t, []string{"dm-5"}, deviceHolders(paths, "sde1"))
+	assert.Empty(t, deviceHolders(paths, "sde2"))
+}
@@ -0,0 +1,47 @@
+package block
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	WIPEFSCMD = "wipefs"
+	SFDISKCMD = "sfdisk"
+)
+
+// GPTGenerator writes a GPT partition table to blank disks which can not be
+// globally identified, so that they get a PTUUID.
+type GPTGenerator interface {
+	// HasSignatures returns true if wipefs finds any filesystem, RAID or
+	// partition table signature on the device
+	HasSignatures(devPath string) (bool, error)
+	// GenerateGPT writes an empty GPT partition table to the device
+	GenerateGPT(devPath string) error
+}
+
+type gptGenerator struct{}
+
+// NewGPTGenerator returns a GPTGenerator running wipefs and sfdisk
+func NewGPTGenerator() GPTGenerator {
+	return &gptGenerator{}
+}
+
+func (g *gptGenerator) HasSignatures(devPath string) (bool, error) {
+	// -n to never write the device, the signatures are only listed
+	out, err := exec.Command(WIPEFSCMD, "-n", "--noheadings", devPath).Output() // #nosec G204
+	if err != nil {
+		return false, fmt.Errorf("failed to probe signatures of %s: %w", devPath, err)
+	}
+	return strings.TrimSpace(string(out)) != "", nil
+}
+
+func (g *gptGenerator) GenerateGPT(devPath string) error {
+	cmd := exec.Command(SFDISKCMD, "--quiet", "--wipe", "never", devPath) // #nosec G204
+	cmd.Stdin = strings.NewReader("label: gpt\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to generate GPT partition table on %s: %w, output: %s", devPath, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -3,16 +3,32 @@ package block
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/utils/strings/slices"
 )
 
 const (
 	LSBLKCMD = "lsblk"
+
+	diskByIDDir = "/dev/disk/by-id"
+
+	// osPartitionLabelPrefix is the label prefix of the OS partitions, e.g.
+	// COS_STATE and COS_PERSISTENT of Harvester
+	osPartitionLabelPrefix = "COS_"
+	// the part types of the boot partitions, which are never mounted
+	partTypeEFISystem = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	partTypeBIOSBoot  = "21686148-6449-6E6F-744E-656564454649"
 )
 
+// osMountPoints are the mount points of the OS partitions, the disk holding
+// any of them is the root disk.
+var osMountPoints = []string{"/", "/boot", "/boot/efi", "/oem", "/usr/local", "/run/initramfs/cos-state"}
+
 func GetParentDevName(devPath string) (string, error) {
 	return lsblk(devPath, "pkname")
 }
@@ -21,6 +37,32 @@ func HasPartitions(disk *Disk) bool {
 	return len(disk.Partitions) > 0
 }
 
+// IsRootDisk returns true if the disk holds the OS, i.e. the disk or any of its
+// partitions is an OS partition.
+func IsRootDisk(disk *Disk) bool {
+	if slices.Contains(osMountPoints, disk.FileSystemInfo.MountPoint) {
+		return true
+	}
+	for _, part := range disk.Partitions {
+		if IsOSPartition(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOSPartition returns true if the partition is mounted at an OS mount point,
+// labeled as an OS partition, or is a boot partition.
+func IsOSPartition(part *Partition) bool {
+	if slices.Contains(osMountPoints, part.FileSystemInfo.MountPoint) {
+		return true
+	}
+	if strings.HasPrefix(part.Label, osPartitionLabelPrefix) {
+		return true
+	}
+	return strings.EqualFold(part.PartType, partTypeEFISystem) || strings.EqualFold(part.PartType, partTypeBIOSBoot)
+}
+
 func GetFileSystemLabel(devPath string) string {
 	result, err := lsblk(devPath, "label")
 	if err != nil {
@@ -63,6 +105,34 @@ func GetDevPathByPTUUID(ptUUID string) (string, error) {
 	return "", nil
 }
 
+// GetDevPathByID returns the persistent /dev/disk/by-id link of the device,
+// preferring the WWN one, or an empty string if there is none.
+func GetDevPathByID(devPath string) (string, error) {
+	return devPathByID(diskByIDDir, devPath)
+}
+
+func devPathByID(dir, devPath string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var result string
+	for _, entry := range entries {
+		link := filepath.Join(dir, entry.Name())
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil || target != devPath {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), "wwn-") {
+			return link, nil
+		}
+		if result == "" {
+			result = link
+		}
+	}
+	return result, nil
+}
+
 func lsblk(devPath, output string) (string, error) {
 	if !strings.HasPrefix(devPath, "/dev") {
 		devPath = "/dev/" + devPath
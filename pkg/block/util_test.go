@@ -0,0 +1,80 @@
+package block
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_devPathByID(t *testing.T) {
+	dir := t.TempDir()
+	byID := filepath.Join(dir, "by-id")
+	require.NoError(t, os.Mkdir(byID, 0755))
+	for _, name := range []string{"sda", "sdb", "sdc"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	for link, target := range map[string]string{
+		"ata-QEMU_HARDDISK_QM00001":  "sda",
+		"scsi-0QEMU_QEMU_HARDDISK_1": "sdb",
+		"wwn-0x5000c50015ac3bd9":     "sdb",
+	} {
+		require.NoError(t, os.Symlink(filepath.Join("..", target), filepath.Join(byID, link)))
+	}
+
+	path, err := devPathByID(byID, filepath.Join(dir, "sda"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(byID, "ata-QEMU_HARDDISK_QM00001"), path)
+
+	path, err = devPathByID(byID, filepath.Join(dir, "sdb"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(byID, "wwn-0x5000c50015ac3bd9"), path)
+
+	path, err = devPathByID(byID, filepath.Join(dir, "sdc"))
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	_, err = devPathByID(filepath.Join(dir, "missing"), filepath.Join(dir, "sda"))
+	assert.Error(t, err)
+}
+
+func Test_isRootDisk(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		part     *Partition
+		osPart   bool
+		rootDisk bool
+	}{
+		{
+			name:     "root partition",
+			part:     &Partition{FileSystemInfo: FileSystemInfo{MountPoint: "/"}},
+			osPart:   true,
+			rootDisk: true,
+		},
+		{
+			name:     "Harvester state partition",
+			part:     &Partition{Label: "COS_STATE"},
+			osPart:   true,
+			rootDisk: true,
+		},
+		{
+			name:     "EFI system partition",
+			part:     &Partition{PartType: "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"},
+			osPart:   true,
+			rootDisk: true,
+		},
+		{
+			name: "data partition",
+			part: &Partition{Label: "data", FileSystemInfo: FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/abc"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disk := &Disk{Partitions: []*Partition{tc.part}}
+			assert.Equal(t, tc.osPart, IsOSPartition(tc.part))
+			assert.Equal(t, tc.rootDisk, IsRootDisk(disk))
+		})
+	}
+}
@@ -40,17 +40,22 @@ func GetDiskBlockDevice(disk *block.Disk, nodeName, namespace string) *diskv1.Bl
 				StorageController: disk.StorageController.String(),
 				UUID:              disk.UUID,
 				PtUUID:            disk.PtUUID,
+				DMUUID:            disk.DMUUID,
 				BusPath:           disk.BusPath,
 				Model:             disk.Model,
 				Vendor:            disk.Vendor,
 				SerialNumber:      disk.SerialNumber,
 				NUMANodeID:        disk.NUMANodeID,
 				WWN:               disk.WWN,
+				Label:             disk.Label,
 			},
 			DevPath:    devPath,
 			FileSystem: fileSystemInfo,
 		},
 	}
+	for _, path := range disk.Paths {
+		status.DeviceStatus.Paths = append(status.DeviceStatus.Paths, utils.GetFullDevPath(path))
+	}
 
 	bd := &diskv1.BlockDevice{
 		ObjectMeta: metav1.ObjectMeta{
@@ -96,6 +101,7 @@ func GetPartitionBlockDevice(part *block.Partition, nodeName, namespace string)
 				DeviceType:        diskv1.DeviceTypePart,
 				Label:             part.Label,
 				PartUUID:          part.UUID,
+				PartType:          part.PartType,
 				UUID:              part.FsUUID,
 				DriveType:         part.DriveType.String(),
 				StorageController: part.StorageController.String(),
@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	gocommon "github.com/harvester/go-common"
@@ -19,17 +21,34 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/flowcontrol"
 
 	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
 	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/encrypt"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/fsck"
 	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
 	ctllonghornv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/longhorn.io/v1beta2"
+	"github.com/harvester/node-disk-manager/pkg/health"
+	"github.com/harvester/node-disk-manager/pkg/lvm"
+	"github.com/harvester/node-disk-manager/pkg/metrics"
 	"github.com/harvester/node-disk-manager/pkg/option"
+	"github.com/harvester/node-disk-manager/pkg/partition"
+	"github.com/harvester/node-disk-manager/pkg/resize"
 	"github.com/harvester/node-disk-manager/pkg/utils"
+	"github.com/harvester/node-disk-manager/pkg/wipe"
 )
 
 const (
-	blockDeviceHandlerName = "harvester-block-device-handler"
+	blockDeviceHandlerName     = "harvester-block-device-handler"
+	provisionPolicyHandlerName = "harvester-disk-provision-policy-handler"
+
+	// DefaultMountPathTemplate is the default template of the path to mount provisioned devices
+	DefaultMountPathTemplate = "/var/lib/harvester/extra-disks/{{.Name}}"
+
+	// ioErrorThreshold is the count of I/O errors that a disk is considered unhealthy at
+	ioErrorThreshold = 10
 )
 
 // semaphore is a simple semaphore implementation in channel
@@ -56,6 +75,16 @@ func (s *semaphore) acquire() bool {
 	}
 }
 
+// tryAcquire acquires the semaphore for a disk operation, and counts the
+// operation requeued in the metrics if it is full
+func (s *semaphore) tryAcquire() bool {
+	if s.acquire() {
+		return true
+	}
+	metrics.IncSemaphoreSaturated()
+	return false
+}
+
 // release the semaphore
 func (s *semaphore) release() bool {
 	select {
@@ -84,8 +113,38 @@ type Controller struct {
 	BlockdeviceCache ctldiskv1.BlockDeviceCache
 	BlockInfo        block.Info
 
-	scanner   *Scanner
-	semaphore *semaphore
+	scanner             *Scanner
+	semaphore           *semaphore
+	mountPathTemplate   *template.Template
+	healthChecker       health.Checker
+	healthCheckInterval time.Duration
+	autoEvictUnhealthy  bool
+	lvmManager          lvm.Manager
+	recorder            events.Recorder
+	// the TTLs of inactive devices, 0 to keep them
+	inactiveDeviceTTL      time.Duration
+	inactiveProvisionedTTL time.Duration
+
+	wiper wipe.Wiper
+	// partitioner creates the partitions in spec.partitions
+	partitioner partition.Partitioner
+	// resizer expands the filesystems of the grown devices
+	resizer resize.Resizer
+	// expandBackoff delays the retries of the failed expansions by device name
+	expandBackoff *flowcontrol.Backoff
+	// encryptor sets up the LUKS devices with the keys in the secrets
+	encryptor encrypt.Encryptor
+	secrets   secretGetter
+	// fsChecker checks and repairs the filesystems on request
+	fsChecker fsck.Checker
+	// wipeJobs are the wipes running in background by device name
+	wipeJobs sync.Map
+}
+
+// mountPathTemplateData is the data to render the mount path template with
+type mountPathTemplateData struct {
+	Name     string
+	NodeName string
 }
 
 type NeedMountUpdateOP int8
@@ -152,25 +211,66 @@ func Register(
 	ctx context.Context,
 	nodes ctllonghornv1.NodeController,
 	bds ctldiskv1.BlockDeviceController,
+	policies ctldiskv1.DiskProvisionPolicyController,
 	block block.Info,
 	opt *option.Option,
 	scanner *Scanner,
+	recorder events.Recorder,
+	secrets secretGetter,
 ) error {
+	mountPathTemplate, err := newMountPathTemplate(opt.MountPathTemplate)
+	if err != nil {
+		return err
+	}
 	CacheDiskTags = &DiskTags{
 		diskTags:    make(map[string][]string),
 		lock:        &sync.RWMutex{},
 		initialized: false,
 	}
 	controller := &Controller{
-		Namespace:        opt.Namespace,
-		NodeName:         opt.NodeName,
-		NodeCache:        nodes.Cache(),
-		Nodes:            nodes,
-		Blockdevices:     bds,
-		BlockdeviceCache: bds.Cache(),
-		BlockInfo:        block,
-		scanner:          scanner,
-		semaphore:        newSemaphore(opt.MaxConcurrentOps),
+		Namespace:          opt.Namespace,
+		NodeName:           opt.NodeName,
+		NodeCache:          nodes.Cache(),
+		Nodes:              nodes,
+		Blockdevices:       bds,
+		BlockdeviceCache:   bds.Cache(),
+		BlockInfo:          block,
+		scanner:            scanner,
+		semaphore:          newSemaphore(opt.MaxConcurrentOps),
+		mountPathTemplate:  mountPathTemplate,
+		autoEvictUnhealthy: opt.AutoEvictUnhealthyDisk,
+		recorder:           recorder,
+		secrets:            secrets,
+		expandBackoff:      flowcontrol.NewBackOff(expandBackoffInitial, expandBackoffMax),
+
+		inactiveDeviceTTL:      time.Duration(opt.InactiveDeviceTTL) * time.Second,
+		inactiveProvisionedTTL: time.Duration(opt.InactiveProvisionedTTL) * time.Second,
+	}
+	if controller.lvmManager, err = lvm.NewManager(); err != nil {
+		return fmt.Errorf("failed to create LVM manager: %w", err)
+	}
+	if controller.wiper, err = wipe.NewWiper(); err != nil {
+		return fmt.Errorf("failed to create device wiper: %w", err)
+	}
+	if controller.partitioner, err = partition.NewPartitioner(); err != nil {
+		return fmt.Errorf("failed to create device partitioner: %w", err)
+	}
+	if controller.resizer, err = resize.NewResizer(); err != nil {
+		return fmt.Errorf("failed to create filesystem resizer: %w", err)
+	}
+	if controller.encryptor, err = encrypt.NewEncryptor(); err != nil {
+		return fmt.Errorf("failed to create device encryptor: %w", err)
+	}
+	if controller.fsChecker, err = fsck.NewChecker(); err != nil {
+		return fmt.Errorf("failed to create filesystem checker: %w", err)
+	}
+	if opt.HealthCheckInterval > 0 {
+		checker, err := health.NewSmartctlChecker()
+		if err != nil {
+			return fmt.Errorf("failed to create disk health checker: %w", err)
+		}
+		controller.healthChecker = checker
+		controller.healthCheckInterval = time.Duration(opt.HealthCheckInterval) * time.Second
 	}
 
 	if err := scanner.Start(); err != nil {
@@ -185,18 +285,53 @@ func Register(
 
 	bds.OnChange(ctx, blockDeviceHandlerName, controller.OnBlockDeviceChange)
 	bds.OnRemove(ctx, blockDeviceHandlerName, controller.OnBlockDeviceDelete)
+	policies.OnChange(ctx, provisionPolicyHandlerName, controller.OnProvisionPolicyChange)
 	return nil
 }
 
+// OnProvisionPolicyChange wakes up the scanner to apply the changed
+// DiskProvisionPolicy to the disks of the node.
+func (c *Controller) OnProvisionPolicyChange(_ string, policy *diskv1.DiskProvisionPolicy) (*diskv1.DiskProvisionPolicy, error) {
+	if policy == nil || policy.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	utils.CallerWithCondLock(c.scanner.Cond, func() any {
+		logrus.Infof("Wake up scanner for disk provision policy %s", policy.Name)
+		c.scanner.Cond.Signal()
+		return nil
+	})
+	return nil, nil
+}
+
 // OnBlockDeviceChange watch the block device CR on change and performing disk operations
-// like mounting the disks to a desired path via ext4
+// like mounting the disks to a desired path via ext4 or xfs
 func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (*diskv1.BlockDevice, error) {
-	if device == nil || device.DeletionTimestamp != nil || device.Spec.NodeName != c.NodeName || device.Status.State == diskv1.BlockDeviceInactive {
+	if device == nil || device.DeletionTimestamp != nil || device.Spec.NodeName != c.NodeName {
 		return nil, nil
 	}
+	if device.Status.State == diskv1.BlockDeviceInactive {
+		return c.onInactiveDeviceChange(device)
+	}
+
+	// the filesystem is checked on request, even if it is corrupted
+	if needCheckFileSystem(device) {
+		if bd, handled, err := c.onFileSystemCheck(device); handled || err != nil {
+			return bd, err
+		}
+	}
 
 	// corrupted device could be skipped if we do not set ForceFormatted or Repaired
 	if device.Status.DeviceStatus.FileSystem.Corrupted && !device.Spec.FileSystem.ForceFormatted && !device.Spec.FileSystem.Repaired {
+		if !c.autoEvictUnhealthy || device.Status.ProvisionPhase != diskv1.ProvisionPhaseProvisioned {
+			return nil, nil
+		}
+		deviceCpy := device.DeepCopy()
+		if err := c.evictUnhealthyDevice(deviceCpy, "filesystem is corrupted"); err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(device, deviceCpy) {
+			return c.Blockdevices.Update(deviceCpy)
+		}
 		return nil, nil
 	}
 
@@ -204,6 +339,15 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 		return nil, errors.New(errorCacheDiskTagsNotInitialized)
 	}
 
+	if needTakeOver(device) {
+		deviceCpy := device.DeepCopy()
+		if err := c.takeOverReplacedDevice(deviceCpy); err != nil {
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonReplacing, err.Error())
+			return nil, err
+		}
+		return c.Blockdevices.Update(deviceCpy)
+	}
+
 	deviceCpy := device.DeepCopy()
 	devPath, err := resolvePersistentDevPath(device)
 	if err != nil {
@@ -212,17 +356,52 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 	if devPath == "" {
 		return nil, fmt.Errorf("failed to resolve persistent dev path for block device %s", device.Name)
 	}
-	filesystem := c.BlockInfo.GetFileSystemInfoByDevPath(devPath)
+	filesystem := c.BlockInfo.GetFileSystemInfoByDevPath(fileSystemDevPath(device, devPath))
 	devPathStatus := convertFSInfoToString(filesystem)
 	logrus.Debugf("Get filesystem info from device %s, %s", devPath, devPathStatus)
 
-	needFormat := deviceCpy.Spec.FileSystem.ForceFormatted && (deviceCpy.Status.DeviceStatus.FileSystem.Corrupted || deviceCpy.Status.DeviceStatus.FileSystem.LastFormattedAt == nil)
+	if c.reconcileWipe(deviceCpy, devPath, filesystem) {
+		if !reflect.DeepEqual(device, deviceCpy) {
+			logrus.Debugf("Update block device %s for new wipe state", device.Name)
+			return c.Blockdevices.Update(deviceCpy)
+		}
+		return nil, nil
+	}
+
+	if needPartition(deviceCpy) {
+		err := c.partitionDevice(deviceCpy, devPath, filesystem)
+		if err != nil {
+			err := fmt.Errorf("failed to partition device %s: %w", device.Name, err)
+			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonPartitionFailed, err.Error())
+			diskv1.DiskPartitioned.SetError(deviceCpy, "", err)
+			diskv1.DiskPartitioned.SetStatusBool(deviceCpy, false)
+		}
+		if !reflect.DeepEqual(device, deviceCpy) {
+			logrus.Debugf("Update block device %s for new partitioning state", device.Name)
+			return c.Blockdevices.Update(deviceCpy)
+		}
+		return device, err
+	}
+	if len(deviceCpy.Spec.Partitions) == 0 && diskv1.DiskPartitioned.IsTrue(deviceCpy) {
+		// the partitions are kept, and the disk could be partitioned again
+		diskv1.DiskPartitioned.SetStatusBool(deviceCpy, false)
+		diskv1.DiskPartitioned.Message(deviceCpy, "Partitions are no longer managed since spec.partitions is removed")
+	}
+
+	if isLVMDevice(deviceCpy) {
+		return c.onLVMDeviceChange(device, deviceCpy, devPath, filesystem)
+	}
+
+	// a Longhorn block disk is used raw, it is never formatted
+	needFormat := deviceCpy.Spec.FileSystem.ForceFormatted && !isLonghornBlockDisk(deviceCpy) && (deviceCpy.Status.DeviceStatus.FileSystem.Corrupted || deviceCpy.Status.DeviceStatus.FileSystem.LastFormattedAt == nil)
 	if needFormat {
 		logrus.Infof("Prepare to force format device %s", device.Name)
 		err := c.forceFormat(deviceCpy, devPath, filesystem)
 		if err != nil {
 			err := fmt.Errorf("failed to force format device %s: %s", device.Name, err.Error())
 			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonFormatFailed, err.Error())
 			diskv1.DeviceFormatting.SetError(deviceCpy, "", err)
 			diskv1.DeviceFormatting.SetStatusBool(deviceCpy, false)
 		}
@@ -233,11 +412,12 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 		return device, err
 	}
 
-	if needMountUpdate := needUpdateMountPoint(deviceCpy, filesystem); needMountUpdate != NeedMountUpdateNoOp {
+	if needMountUpdate := c.needUpdateMountPoint(deviceCpy, filesystem); needMountUpdate != NeedMountUpdateNoOp {
 		err := c.updateDeviceMount(deviceCpy, devPath, filesystem, needMountUpdate)
 		if err != nil {
 			err := fmt.Errorf("failed to update device mount %s: %s", device.Name, err.Error())
 			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonMountFailed, err.Error())
 			diskv1.DeviceMounted.SetError(deviceCpy, "", err)
 			diskv1.DeviceMounted.SetStatusBool(deviceCpy, false)
 		}
@@ -279,7 +459,7 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 		}
 		if !DiskTagsSynced || (DiskTagsSynced && DiskTagsOnNodeMissed()) {
 			logrus.Debugf("Prepare to update device %s because the Tags changed, Spec: %v, CacheDiskTags: %v", deviceCpy.Name, deviceCpy.Spec.Tags, CacheDiskTags.GetDiskTags(device.Name))
-			if err := c.provisionDeviceToNode(deviceCpy); err != nil {
+			if err := c.provisionDeviceToNode(deviceCpy, devPath); err != nil {
 				err := fmt.Errorf("failed to update tags %v with device %s to node %s: %w", deviceCpy.Spec.Tags, device.Name, c.NodeName, err)
 				logrus.Error(err)
 				c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
@@ -287,9 +467,10 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 		}
 	case needProvision && device.Status.ProvisionPhase == diskv1.ProvisionPhaseUnprovisioned:
 		logrus.Infof("Prepare to provision device %s to node %s", device.Name, c.NodeName)
-		if err := c.provisionDeviceToNode(deviceCpy); err != nil {
+		if err := c.provisionDeviceToNode(deviceCpy, devPath); err != nil {
 			err := fmt.Errorf("failed to provision device %s to node %s: %w", device.Name, c.NodeName, err)
 			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonProvisionFailed, err.Error())
 			diskv1.DiskAddedToNode.SetError(deviceCpy, "", err)
 			diskv1.DiskAddedToNode.SetStatusBool(deviceCpy, false)
 			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
@@ -299,12 +480,31 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 		if err := c.unprovisionDeviceFromNode(deviceCpy); err != nil {
 			err := fmt.Errorf("failed to stop provisioning device %s to node %s: %w", device.Name, c.NodeName, err)
 			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonUnprovisionFailed, err.Error())
 			diskv1.DiskAddedToNode.SetError(deviceCpy, "", err)
 			diskv1.DiskAddedToNode.SetStatusBool(deviceCpy, false)
 			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
 		}
 	}
 
+	if needRemoveReplaced(deviceCpy) {
+		if err := c.removeReplacedDevice(deviceCpy); err != nil {
+			err := fmt.Errorf("failed to remove block device %s replaced by device %s: %w", deviceCpy.Spec.Replaces, device.Name, err)
+			logrus.Error(err)
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		}
+	}
+
+	if c.autoEvictUnhealthy && deviceCpy.Status.ProvisionPhase == diskv1.ProvisionPhaseProvisioned {
+		if reason := c.unhealthyReason(deviceCpy, devPath, filesystem); reason != "" {
+			if err := c.evictUnhealthyDevice(deviceCpy, reason); err != nil {
+				err := fmt.Errorf("failed to evict unhealthy device %s from node %s: %w", device.Name, c.NodeName, err)
+				logrus.Error(err)
+				c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+			}
+		}
+	}
+
 	if !reflect.DeepEqual(device, deviceCpy) {
 		logrus.Debugf("Update block device %s for new provision state", device.Name)
 		return c.Blockdevices.Update(deviceCpy)
@@ -312,9 +512,21 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 
 	// None of the above operations have resulted in an update to the device.
 	// We therefore try to update the latest device status from the OS
+	lastSizeBytes := deviceCpy.Status.DeviceStatus.Capacity.SizeBytes
 	if err := c.updateDeviceStatus(deviceCpy, devPath); err != nil {
 		return nil, err
 	}
+	c.updateDeviceHealth(deviceCpy, devPath)
+
+	markDeviceGrown(deviceCpy, lastSizeBytes)
+	if c.needExpand(deviceCpy, filesystem) {
+		c.onFileSystemExpand(device, deviceCpy, devPath, filesystem)
+	}
+	if !deviceCpy.Spec.FileSystem.AutoExpand && diskv1.DeviceExpanded.IsTrue(deviceCpy) {
+		// the filesystem is checked again once autoExpand is enabled again
+		diskv1.DeviceExpanded.SetStatusBool(deviceCpy, false)
+		diskv1.DeviceExpanded.Message(deviceCpy, "Filesystem is no longer expanded since spec.fileSystem.autoExpand is disabled")
+	}
 
 	if !reflect.DeepEqual(device, deviceCpy) {
 		logrus.Debugf("Update block device %s for new device status", device.Name)
@@ -327,22 +539,53 @@ func (c *Controller) OnBlockDeviceChange(_ string, device *diskv1.BlockDevice) (
 func (c *Controller) updateDeviceMount(device *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo, needMountUpdate NeedMountUpdateOP) error {
 	logrus.Infof("Prepare to try %s", convertMountStr(needMountUpdate))
 	if device.Status.DeviceStatus.Partitioned {
-		return fmt.Errorf("partitioned device is not supported, please use raw block device instead")
+		return fmt.Errorf("partitioned device is not supported, please format it or provision its partitions instead")
+	}
+	if err := c.checkRootDisk(device, devPath); err != nil {
+		return err
+	}
+	if needMountUpdate.Has(NeedMountUpdateMount) {
+		// validate before unmounting, so an invalid option does not leave the device unmounted
+		fsType := mountFileSystemType(device, block.GetFileSystemType(fileSystemDevPath(device, devPath)))
+		if err := utils.ValidateMountOptions(fsType, device.Spec.FileSystem.MountOptions); err != nil {
+			return err
+		}
 	}
 	if needMountUpdate.Has(NeedMountUpdateUnmount) {
 		logrus.Infof("Unmount device %s from path %s", device.Name, filesystem.MountPoint)
-		if err := utils.UmountDisk(filesystem.MountPoint); err != nil {
+		err := utils.UmountDisk(filesystem.MountPoint)
+		metrics.ObserveUnmount(device.Name, err)
+		if err != nil {
 			return err
 		}
 		diskv1.DeviceMounted.SetError(device, "", nil)
 		diskv1.DeviceMounted.SetStatusBool(device, false)
+		c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonUnmounted, "Unmounted device from %s", filesystem.MountPoint)
+		if device.Status.DeviceStatus.FileSystem.Encrypted && !needMountUpdate.Has(NeedMountUpdateMount) {
+			if err := c.closeEncryptedDevice(device); err != nil {
+				return err
+			}
+		}
 	}
 	if needMountUpdate.Has(NeedMountUpdateMount) {
-		expectedMountPoint := extraDiskMountPoint(device)
-		logrus.Infof("Mount deivce %s to %s", device.Name, expectedMountPoint)
-		if err := utils.MountDisk(devPath, expectedMountPoint); err != nil {
+		if device.Status.DeviceStatus.FileSystem.Encrypted {
+			if err := c.openEncryptedDevice(device, devPath); err != nil {
+				return err
+			}
+		}
+		expectedMountPoint := c.extraDiskMountPoint(device)
+		fsDevPath := fileSystemDevPath(device, devPath)
+		fsType := mountFileSystemType(device, block.GetFileSystemType(fsDevPath))
+		logrus.Infof("Mount deivce %s to %s as %s", device.Name, expectedMountPoint, fsType)
+		mountStart := time.Now()
+		err := utils.MountDisk(fsDevPath, expectedMountPoint, fsType, device.Spec.FileSystem.MountOptions)
+		metrics.ObserveMount(device.Name, mountStart, err)
+		if err != nil {
 			if utils.IsFSCorrupted(err) {
 				logrus.Errorf("Target device may be corrupted, update FS info.")
+				if !device.Status.DeviceStatus.FileSystem.Corrupted {
+					c.recorder.Eventf(device, corev1.EventTypeWarning, events.ReasonCorrupted, "Filesystem of device %s is corrupted: %s", devPath, err.Error())
+				}
 				device.Status.DeviceStatus.FileSystem.Corrupted = true
 				device.Spec.FileSystem.Repaired = false
 			}
@@ -350,9 +593,10 @@ func (c *Controller) updateDeviceMount(device *diskv1.BlockDevice, devPath strin
 		}
 		diskv1.DeviceMounted.SetError(device, "", nil)
 		diskv1.DeviceMounted.SetStatusBool(device, true)
+		c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonMounted, "Mounted device to %s", expectedMountPoint)
 	}
 	device.Status.DeviceStatus.FileSystem.Corrupted = false
-	return c.updateDeviceFileSystem(device, devPath)
+	return c.updateDeviceFileSystem(device, fileSystemDevPath(device, devPath))
 }
 
 func (c *Controller) updateDeviceFileSystem(device *diskv1.BlockDevice, devPath string) error {
@@ -378,12 +622,16 @@ func valueExists(value string) bool {
 	return value != "" && value != ghwutil.UNKNOWN
 }
 
-// forceFormat simply formats the device to ext4 filesystem
+// forceFormat simply formats the device to the filesystem in spec, ext4 by default
 //
 // - umount the block device if it is mounted
-// - create ext4 filesystem on the block device
+// - create ext4 or xfs filesystem on the block device
 func (c *Controller) forceFormat(device *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) error {
-	if !c.semaphore.acquire() {
+	if err := c.checkRootDisk(device, devPath); err != nil {
+		return err
+	}
+
+	if !c.semaphore.tryAcquire() {
 		logrus.Infof("Hit maximum concurrent count. Requeue device %s", device.Name)
 		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
 		return nil
@@ -394,13 +642,23 @@ func (c *Controller) forceFormat(device *diskv1.BlockDevice, devPath string, fil
 	// umount the disk if it is mounted
 	if filesystem != nil && filesystem.MountPoint != "" {
 		logrus.Infof("unmount %s for %s", filesystem.MountPoint, device.Name)
-		if err := utils.UmountDisk(filesystem.MountPoint); err != nil {
+		err := utils.UmountDisk(filesystem.MountPoint)
+		metrics.ObserveUnmount(device.Name, err)
+		if err != nil {
 			return err
 		}
 	}
+	// the LUKS device is replaced along with the filesystem on it
+	if device.Status.DeviceStatus.FileSystem.Encrypted {
+		if err := c.closeEncryptedDevice(device); err != nil {
+			return err
+		}
+		device.Status.DeviceStatus.FileSystem.Encrypted = false
+	}
 
-	// make ext4 filesystem format of the partition disk
-	logrus.Debugf("make ext4 filesystem format of device %s", device.Name)
+	fsType := fileSystemType(device)
+	logrus.Debugf("make %s filesystem format of device %s", fsType, device.Name)
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonFormatting, "Formatting device %s with %s filesystem", devPath, fsType)
 	// Reuse UUID if possible to make the filesystem UUID more stable.
 	//
 	// The reason filesystem UUID needs to be stable is that if a disk
@@ -422,14 +680,28 @@ func (c *Controller) forceFormat(device *diskv1.BlockDevice, devPath string, fil
 			uuid = ""
 		}
 	}
-	if err := utils.MakeExt4DiskFormatting(devPath, uuid); err != nil {
+	fsDevPath, fsUUID := devPath, uuid
+	if device.Spec.FileSystem.Encryption != nil {
+		// the LUKS header takes the UUID instead, so the device is still
+		// found by resolvePersistentDevPath
+		var err error
+		if fsDevPath, err = c.encryptDevice(device, devPath, uuid); err != nil {
+			return err
+		}
+		device.Status.DeviceStatus.FileSystem.Encrypted = true
+		fsUUID = ""
+	}
+	formatStart := time.Now()
+	err := utils.MakeDiskFormatting(fsDevPath, fsType, fsUUID)
+	metrics.ObserveFormat(device.Name, fsType, formatStart, err)
+	if err != nil {
 		return err
 	}
 
 	// HACK: Update the UUID if it is reused.
 	//
 	// This makes the controller able to find then device after
-	// a PtUUID is reused in `mkfs.ext4` as filesystem UUID.
+	// a PtUUID is reused in `mkfs.ext4` or `mkfs.xfs` as filesystem UUID.
 	//
 	// If the UUID is not updated within one-stop, the next
 	// `OnBlockDeviceChange` is not able to find the device
@@ -438,12 +710,13 @@ func (c *Controller) forceFormat(device *diskv1.BlockDevice, devPath string, fil
 		device.Status.DeviceStatus.Details.UUID = uuid
 	}
 
-	if err := c.updateDeviceFileSystem(device, devPath); err != nil {
+	if err := c.updateDeviceFileSystem(device, fsDevPath); err != nil {
 		return err
 	}
 	diskv1.DeviceFormatting.SetError(device, "", nil)
 	diskv1.DeviceFormatting.SetStatusBool(device, false)
-	diskv1.DeviceFormatting.Message(device, "Done device ext4 filesystem formatting")
+	diskv1.DeviceFormatting.Message(device, fmt.Sprintf("Done device %s filesystem formatting", fsType))
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonFormatted, "Formatted device %s with %s filesystem", devPath, fsType)
 	device.Status.DeviceStatus.FileSystem.LastFormattedAt = &metav1.Time{Time: time.Now()}
 	device.Status.DeviceStatus.Partitioned = false
 	device.Status.DeviceStatus.FileSystem.Corrupted = false
@@ -451,7 +724,7 @@ func (c *Controller) forceFormat(device *diskv1.BlockDevice, devPath string, fil
 }
 
 // provisionDeviceToNode adds a device to longhorn node as an additional disk.
-func (c *Controller) provisionDeviceToNode(device *diskv1.BlockDevice) error {
+func (c *Controller) provisionDeviceToNode(device *diskv1.BlockDevice, devPath string) error {
 	node, err := c.NodeCache.Get(c.Namespace, c.NodeName)
 	if apierrors.IsNotFound(err) {
 		node, err = c.Nodes.Get(c.Namespace, c.NodeName, metav1.GetOptions{})
@@ -462,12 +735,24 @@ func (c *Controller) provisionDeviceToNode(device *diskv1.BlockDevice) error {
 
 	nodeCpy := node.DeepCopy()
 	diskSpec := longhornv1.DiskSpec{
-		Path:              extraDiskMountPoint(device),
+		Type:              longhornv1.DiskTypeFilesystem,
+		Path:              c.extraDiskMountPoint(device),
 		AllowScheduling:   true,
 		EvictionRequested: false,
 		StorageReserved:   0,
 		Tags:              device.Spec.Tags,
 	}
+	if isLonghornBlockDisk(device) {
+		if diskSpec.Path, err = longhornBlockDiskPath(device, devPath); err != nil {
+			return err
+		}
+		diskSpec.Type = longhornv1.DiskTypeBlock
+	}
+	// keep draining an unhealthy disk, only unprovisioning could reset it
+	if diskv1.DiskEvictionRequested.IsTrue(device) {
+		diskSpec.AllowScheduling = false
+		diskSpec.EvictionRequested = true
+	}
 
 	updated := false
 	if disk, found := node.Spec.Disks[device.Name]; found {
@@ -507,6 +792,8 @@ func (c *Controller) provisionDeviceToNode(device *diskv1.BlockDevice) error {
 			diskv1.DiskAddedToNode.SetError(device, "", nil)
 			diskv1.DiskAddedToNode.SetStatusBool(device, true)
 			diskv1.DiskAddedToNode.Message(device, msg)
+			c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonProvisioned, msg)
+			c.recorder.Eventf(node, corev1.EventTypeNormal, events.ReasonProvisioned, "Added disk %s of block device %s", diskSpec.Path, device.Name)
 		}
 	}
 
@@ -533,6 +820,10 @@ func (c *Controller) unprovisionDeviceFromNode(device *diskv1.BlockDevice) error
 		diskv1.DiskAddedToNode.SetError(device, "", nil)
 		diskv1.DiskAddedToNode.SetStatusBool(device, false)
 		diskv1.DiskAddedToNode.Message(device, msg)
+		if diskv1.DiskEvictionRequested.IsTrue(device) {
+			diskv1.DiskEvictionRequested.SetStatusBool(device, false)
+			diskv1.DiskEvictionRequested.Message(device, msg)
+		}
 	}
 
 	diskToRemove, ok := node.Spec.Disks[device.Name]
@@ -560,6 +851,8 @@ func (c *Controller) unprovisionDeviceFromNode(device *diskv1.BlockDevice) error
 			}
 			updateProvisionPhaseUnprovisioned()
 			logrus.Debugf("device %s is unprovisioned", device.Name)
+			c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonUnprovisioned, "Removed disk %s from longhorn node `%s`", device.Name, c.NodeName)
+			c.recorder.Eventf(node, corev1.EventTypeNormal, events.ReasonUnprovisioned, "Removed disk of block device %s", device.Name)
 		} else {
 			// Still unprovisioning
 			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
@@ -581,22 +874,82 @@ func (c *Controller) unprovisionDeviceFromNode(device *diskv1.BlockDevice) error
 		diskv1.DiskAddedToNode.SetError(device, "", nil)
 		diskv1.DiskAddedToNode.SetStatusBool(device, false)
 		diskv1.DiskAddedToNode.Message(device, msg)
+		c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonUnprovisioning, msg)
+		c.recorder.Eventf(node, corev1.EventTypeNormal, events.ReasonUnprovisioning, "Requested eviction of the disk of block device %s to remove it", device.Name)
+	}
+
+	return nil
+}
+
+// unhealthyReason returns why a provisioned device is considered dying, or an
+// empty string if it looks fine.
+func (c *Controller) unhealthyReason(device *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) string {
+	if device.Status.DeviceStatus.FileSystem.Corrupted {
+		return "filesystem is corrupted"
+	}
+	if filesystem != nil && filesystem.MountPoint != "" && filesystem.IsReadOnly {
+		return fmt.Sprintf("filesystem is remounted read-only at %s", filesystem.MountPoint)
+	}
+	if health := device.Status.DeviceStatus.Health; health != nil && health.OverallStatus == diskv1.DeviceHealthFailed {
+		return "device failed the health self-assessment"
+	}
+	if device.Status.DeviceStatus.Details.DeviceType == diskv1.DeviceTypeDisk {
+		if count := c.BlockInfo.GetDiskIOErrorCount(devPath); count >= ioErrorThreshold {
+			return fmt.Sprintf("device reported %d I/O errors", count)
+		}
+	}
+	return ""
+}
+
+// evictUnhealthyDevice disables scheduling and requests eviction on the
+// longhorn disk of an unhealthy device, so the replicas are drained off it.
+func (c *Controller) evictUnhealthyDevice(device *diskv1.BlockDevice, reason string) error {
+	if diskv1.DiskEvictionRequested.IsTrue(device) {
+		return nil
+	}
+	node, err := c.Nodes.Get(c.Namespace, c.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	disk, ok := node.Spec.Disks[device.Name]
+	if !ok {
+		logrus.Debugf("disk %s not in disks of longhorn node %s/%s, skip eviction", device.Name, c.Namespace, c.NodeName)
+		return nil
 	}
 
+	logrus.Warnf("Request eviction of unhealthy device %s from longhorn node %s: %s", device.Name, c.NodeName, reason)
+	if disk.AllowScheduling || !disk.EvictionRequested {
+		disk.AllowScheduling = false
+		disk.EvictionRequested = true
+		nodeCpy := node.DeepCopy()
+		nodeCpy.Spec.Disks[device.Name] = disk
+		if _, err := c.Nodes.Update(nodeCpy); err != nil {
+			return err
+		}
+	}
+	diskv1.DiskEvictionRequested.SetError(device, "", nil)
+	diskv1.DiskEvictionRequested.SetStatusBool(device, true)
+	diskv1.DiskEvictionRequested.Message(device, fmt.Sprintf("Requested eviction from longhorn node `%s`, %s", c.NodeName, reason))
+	c.recorder.Eventf(device, corev1.EventTypeWarning, events.ReasonEvictionRequested, "Requested eviction from longhorn node `%s`, %s", c.NodeName, reason)
+	c.recorder.Eventf(node, corev1.EventTypeWarning, events.ReasonEvictionRequested, "Requested eviction of the disk of unhealthy block device %s, %s", device.Name, reason)
 	return nil
 }
 
 func (c *Controller) updateDeviceStatus(device *diskv1.BlockDevice, devPath string) error {
 	var newStatus diskv1.DeviceStatus
 	var needAutoProvision bool
+	var policy *diskv1.DiskProvisionPolicy
 
 	switch device.Status.DeviceStatus.Details.DeviceType {
 	case diskv1.DeviceTypeDisk:
 		disk := c.BlockInfo.GetDiskByDevPath(devPath)
 		bd := GetDiskBlockDevice(disk, c.NodeName, c.Namespace)
 		newStatus = bd.Status.DeviceStatus
-		autoProvisioned := c.scanner.ApplyAutoProvisionFiltersForDisk(disk)
-		// Only disk can be auto-provisioned.
+		// Only disk can be auto-provisioned, and a matching policy takes precedence over the filters.
+		if device.Status.ProvisionPolicy == "" {
+			policy = c.scanner.MatchProvisionPolicy(disk)
+		}
+		autoProvisioned := policy == nil && device.Status.ProvisionPolicy == "" && c.scanner.ApplyAutoProvisionFiltersForDisk(disk)
 		needAutoProvision = c.scanner.NeedsAutoProvision(device, autoProvisioned)
 	case diskv1.DeviceTypePart:
 		parentDevPath, err := block.GetParentDevName(devPath)
@@ -615,6 +968,17 @@ func (c *Controller) updateDeviceStatus(device *diskv1.BlockDevice, devPath stri
 	if lastFormatted != nil && newStatus.FileSystem.LastFormattedAt == nil {
 		newStatus.FileSystem.LastFormattedAt = lastFormatted
 	}
+	// health is not part of the scan, keep the last checked one
+	newStatus.Health = oldStatus.Health
+	// the filesystem of an encrypted device is found on its LUKS device
+	if oldStatus.FileSystem != nil && oldStatus.FileSystem.Encrypted {
+		newStatus.FileSystem.Encrypted = true
+		if filesystem := c.BlockInfo.GetFileSystemInfoByDevPath(encrypt.MapperPath(device.Name)); filesystem != nil {
+			newStatus.FileSystem.MountPoint = filesystem.MountPoint
+			newStatus.FileSystem.Type = filesystem.Type
+			newStatus.FileSystem.IsReadOnly = filesystem.IsReadOnly
+		}
+	}
 
 	// Update device path
 	newStatus.DevPath = devPath
@@ -623,6 +987,10 @@ func (c *Controller) updateDeviceStatus(device *diskv1.BlockDevice, devPath stri
 		logrus.Infof("Update existing block device status %s", device.Name)
 		device.Status.DeviceStatus = newStatus
 	}
+	if NeedsProvisionPolicy(device, policy) {
+		logrus.Infof("Apply disk provision policy %s to block device %s", policy.Name, device.Name)
+		ApplyProvisionPolicy(device, policy)
+	}
 	// Only disk hasn't yet been formatted can be auto-provisioned.
 	if needAutoProvision {
 		logrus.Infof("Auto provisioning block device %s", device.Name)
@@ -632,6 +1000,46 @@ func (c *Controller) updateDeviceStatus(device *diskv1.BlockDevice, devPath stri
 	return nil
 }
 
+// updateDeviceHealth checks the health of a disk once the health check interval
+// has passed since the last check, and requeues the device for the next one.
+func (c *Controller) updateDeviceHealth(device *diskv1.BlockDevice, devPath string) {
+	if c.healthChecker == nil || device.Status.DeviceStatus.Details.DeviceType != diskv1.DeviceTypeDisk {
+		return
+	}
+	if lastHealth := device.Status.DeviceStatus.Health; lastHealth != nil && lastHealth.LastCheckedAt != nil {
+		if elapsed := time.Since(lastHealth.LastCheckedAt.Time); elapsed < c.healthCheckInterval {
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, c.healthCheckInterval-elapsed)
+			return
+		}
+	}
+	defer c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, c.healthCheckInterval)
+
+	logrus.Debugf("Check health of device %s", device.Name)
+	newHealth, err := c.healthChecker.Check(devPath)
+	if err != nil {
+		logrus.Warnf("failed to check health of device %s: %s", device.Name, err.Error())
+		newHealth = &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthUnknown}
+		diskv1.DeviceHealthy.Message(device, fmt.Sprintf("Failed to check device health: %s", err.Error()))
+	}
+	newHealth.LastCheckedAt = &metav1.Time{Time: time.Now()}
+	device.Status.DeviceStatus.Health = newHealth
+
+	switch newHealth.OverallStatus {
+	case diskv1.DeviceHealthPassed:
+		diskv1.DeviceHealthy.SetStatusBool(device, true)
+		diskv1.DeviceHealthy.Message(device, "Device passed the health self-assessment")
+	case diskv1.DeviceHealthFailed:
+		logrus.Warnf("Device %s failed the health self-assessment", device.Name)
+		diskv1.DeviceHealthy.SetStatusBool(device, false)
+		diskv1.DeviceHealthy.Message(device, "Device failed the health self-assessment")
+	default:
+		diskv1.DeviceHealthy.SetStatus(device, string(corev1.ConditionUnknown))
+		if err == nil {
+			diskv1.DeviceHealthy.Message(device, "Device does not report its health")
+		}
+	}
+}
+
 // OnBlockDeviceDelete will delete the block devices that belongs to the same parent device
 func (c *Controller) OnBlockDeviceDelete(_ string, device *diskv1.BlockDevice) (*diskv1.BlockDevice, error) {
 
@@ -679,10 +1087,17 @@ func (c *Controller) OnBlockDeviceDelete(_ string, device *diskv1.BlockDevice) (
 		}
 		existingMount := bd.Status.DeviceStatus.FileSystem.MountPoint
 		if existingMount != "" {
-			if err := utils.UmountDisk(existingMount); err != nil {
+			err := utils.UmountDisk(existingMount)
+			metrics.ObserveUnmount(bd.Name, err)
+			if err != nil {
 				logrus.Warnf("cannot umount disk %s from mount point %s, err: %s", bd.Name, existingMount, err.Error())
 			}
 		}
+		if bd.Status.DeviceStatus.FileSystem.Encrypted {
+			if err := c.closeEncryptedDevice(bd); err != nil {
+				logrus.Warnf("cannot close LUKS device of disk %s, err: %s", bd.Name, err.Error())
+			}
+		}
 		delete(nodeCpy.Spec.Disks, bd.Name)
 	}
 	if _, err := c.Nodes.Update(nodeCpy); err != nil {
@@ -698,16 +1113,29 @@ func resolvePersistentDevPath(device *diskv1.BlockDevice) (string, error) {
 	switch device.Status.DeviceStatus.Details.DeviceType {
 	case diskv1.DeviceTypeDisk:
 		// Disk naming priority.
+		// #0 DM UUID of multipath devices
 		// #1 WWN
-		// #2 filesystem UUID (UUID)
+		// #2 filesystem UUID (UUID), or the LUKS UUID of an encrypted device
 		// #3 partition table UUID (PTUUID)
 		// #4 PtUUID as UUID to query disk info
 		//    (NDM might reuse PtUUID as UUID to format a disk)
+		if dmUUID := device.Status.DeviceStatus.Details.DMUUID; valueExists(dmUUID) {
+			return filepath.EvalSymlinks("/dev/disk/by-id/dm-uuid-" + dmUUID)
+		}
 		if wwn := device.Status.DeviceStatus.Details.WWN; valueExists(wwn) {
+			link := "/dev/disk/by-id/wwn-" + wwn
 			if device.Status.DeviceStatus.Details.StorageController == string(diskv1.StorageControllerNVMe) {
-				return filepath.EvalSymlinks("/dev/disk/by-id/nvme-" + wwn)
+				link = "/dev/disk/by-id/nvme-" + wwn
 			}
-			return filepath.EvalSymlinks("/dev/disk/by-id/wwn-" + wwn)
+			path, err := filepath.EvalSymlinks(link)
+			if err != nil {
+				return "", err
+			}
+			// the device found before multipath was set up, always use the multipath device
+			if holder := block.GetMultipathHolderDevPath(path); holder != "" {
+				return holder, nil
+			}
+			return path, nil
 		}
 		if fsUUID := device.Status.DeviceStatus.Details.UUID; valueExists(fsUUID) {
 			path, err := filepath.EvalSymlinks("/dev/disk/by-uuid/" + fsUUID)
@@ -741,33 +1169,125 @@ func resolvePersistentDevPath(device *diskv1.BlockDevice) (string, error) {
 	}
 }
 
-func extraDiskMountPoint(bd *diskv1.BlockDevice) string {
+// newMountPathTemplate parses the mount path template and makes sure it renders
+// a distinct absolute path for each device.
+func newMountPathTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultMountPathTemplate
+	}
+	tmpl, err := template.New("mountPath").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mount path template %s: %w", text, err)
+	}
+	sample := mountPathTemplateData{Name: "ndm-sample-device", NodeName: "ndm-sample-node"}
+	var path strings.Builder
+	if err := tmpl.Execute(&path, sample); err != nil {
+		return nil, fmt.Errorf("failed to render mount path template %s: %w", text, err)
+	}
+	if !filepath.IsAbs(path.String()) || !strings.Contains(path.String(), sample.Name) {
+		return nil, fmt.Errorf("mount path template %s must render an absolute path containing {{.Name}}", text)
+	}
+	return tmpl, nil
+}
+
+func (c *Controller) extraDiskMountPoint(bd *diskv1.BlockDevice) string {
 	// DEPRECATED: only for backward compatibility
 	if bd.Spec.FileSystem.MountPoint != "" {
 		return bd.Spec.FileSystem.MountPoint
 	}
 
-	return fmt.Sprintf("/var/lib/harvester/extra-disks/%s", bd.Name)
+	var path strings.Builder
+	if err := c.mountPathTemplate.Execute(&path, mountPathTemplateData{Name: bd.Name, NodeName: c.NodeName}); err != nil {
+		// should not happen since the template is validated on startup
+		logrus.Errorf("failed to render mount path of device %s: %v", bd.Name, err)
+	}
+	return filepath.Clean(path.String())
+}
+
+// isLonghornBlockDisk returns true if the device is provisioned as a Longhorn
+// block disk for the V2 data engine.
+func isLonghornBlockDisk(bd *diskv1.BlockDevice) bool {
+	provisioner := bd.Spec.Provisioner
+	return provisioner != nil && provisioner.Longhorn != nil && provisioner.Longhorn.DiskType == diskv1.LonghornDiskTypeBlock
+}
+
+// longhornBlockDiskPath returns the persistent path of a Longhorn block disk.
+// Before it is added to Longhorn, the device must not hold any data.
+func longhornBlockDiskPath(bd *diskv1.BlockDevice, devPath string) (string, error) {
+	if bd.Status.ProvisionPhase == diskv1.ProvisionPhaseUnprovisioned {
+		if bd.Status.DeviceStatus.Partitioned {
+			return "", fmt.Errorf("partitioned device cannot be provisioned as a block disk")
+		}
+		if fs := bd.Status.DeviceStatus.FileSystem; fs != nil && (fs.Type != "" || fs.MountPoint != "") {
+			return "", fmt.Errorf("device with %s filesystem cannot be provisioned as a block disk, please wipe it first", fs.Type)
+		}
+	}
+	path, err := block.GetDevPathByID(devPath)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return devPath, nil
+	}
+	return path, nil
+}
+
+// fileSystemType returns the filesystem type in spec, ext4 if it is not set.
+func fileSystemType(bd *diskv1.BlockDevice) string {
+	if bd.Spec.FileSystem.Type == "" {
+		return utils.FileSystemTypeExt4
+	}
+	return bd.Spec.FileSystem.Type
 }
 
-func needUpdateMountPoint(bd *diskv1.BlockDevice, filesystem *block.FileSystemInfo) NeedMountUpdateOP {
+// mountFileSystemType returns the type of the filesystem found on the device,
+// so an existing filesystem is mounted as is even if spec.fileSystem.type
+// differs from it, or the type in spec if no supported one is found.
+func mountFileSystemType(bd *diskv1.BlockDevice, fsType string) string {
+	if utils.IsSupportedFileSystem(fsType) {
+		return fsType
+	}
+	return fileSystemType(bd)
+}
+
+// mountOptionsSynced returns true if the mounted filesystem is using the
+// allowed mount options exactly as requested in spec.
+func mountOptionsSynced(bd *diskv1.BlockDevice, filesystem *block.FileSystemInfo) bool {
+	for _, opt := range utils.AllowedMountOptions(mountFileSystemType(bd, filesystem.Type)) {
+		if slices.Contains(bd.Spec.FileSystem.MountOptions, opt) != slices.Contains(filesystem.MountOptions, opt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Controller) needUpdateMountPoint(bd *diskv1.BlockDevice, filesystem *block.FileSystemInfo) NeedMountUpdateOP {
 	if filesystem == nil {
 		logrus.Debugf("Filesystem is not ready, skip the mount operation")
 		return NeedMountUpdateNoOp
 	}
 
 	logrus.Debugf("Checking mount operation with FS.Provisioned %v, FS.Mountpoint %s", bd.Spec.FileSystem.Provisioned, filesystem.MountPoint)
-	if bd.Spec.FileSystem.Provisioned {
+	if bd.Spec.FileSystem.Provisioned && !isLonghornBlockDisk(bd) {
 		if filesystem.MountPoint == "" {
 			return NeedMountUpdateMount
 		}
-		if filesystem.MountPoint == extraDiskMountPoint(bd) {
+		if filesystem.MountPoint == c.extraDiskMountPoint(bd) {
+			if !mountOptionsSynced(bd, filesystem) {
+				logrus.Debugf("Mount options changed to %v, remount device %s", bd.Spec.FileSystem.MountOptions, bd.Name)
+				return NeedMountUpdateUnmount | NeedMountUpdateMount
+			}
 			logrus.Debugf("Already mounted, return no-op")
 			return NeedMountUpdateNoOp
 		}
 		return NeedMountUpdateUnmount | NeedMountUpdateMount
 	}
 	if filesystem.MountPoint != "" {
+		// a partition mounted elsewhere is left to the OS or the users
+		if bd.Status.DeviceStatus.Details.DeviceType == diskv1.DeviceTypePart && filesystem.MountPoint != c.extraDiskMountPoint(bd) {
+			logrus.Debugf("Partition %s is mounted at %s by others, skip unmounting it", bd.Name, filesystem.MountPoint)
+			return NeedMountUpdateNoOp
+		}
 		return NeedMountUpdateUnmount
 	}
 	return NeedMountUpdateNoOp
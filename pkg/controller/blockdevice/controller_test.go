@@ -0,0 +1,497 @@
+package blockdevice
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	longhornv1 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	ctllonghornv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/longhorn.io/v1beta2"
+)
+
+func Test_newMountPathTemplate(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		template  string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "empty template falls back to default",
+			template: "",
+			expected: "/var/lib/harvester/extra-disks/bd1",
+		},
+		{
+			name:     "custom root",
+			template: "/data/disks/{{.Name}}",
+			expected: "/data/disks/bd1",
+		},
+		{
+			name:     "with node name",
+			template: "/data/{{.NodeName}}/{{.Name}}",
+			expected: "/data/node1/bd1",
+		},
+		{
+			name:      "relative path",
+			template:  "data/{{.Name}}",
+			expectErr: true,
+		},
+		{
+			name:      "missing device name",
+			template:  "/data/disks",
+			expectErr: true,
+		},
+		{
+			name:      "unknown field",
+			template:  "/data/{{.Unknown}}/{{.Name}}",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := newMountPathTemplate(tc.template)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			c := &Controller{NodeName: "node1", mountPathTemplate: tmpl}
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+				Spec:       diskv1.BlockDeviceSpec{FileSystem: &diskv1.FilesystemInfo{}},
+			}
+			assert.Equal(t, tc.expected, c.extraDiskMountPoint(bd))
+		})
+	}
+}
+
+func Test_needUpdateMountPoint(t *testing.T) {
+	tmpl, err := newMountPathTemplate(DefaultMountPathTemplate)
+	require.NoError(t, err)
+	c := &Controller{mountPathTemplate: tmpl}
+
+	var testCases = []struct {
+		name        string
+		fsSpec      diskv1.FilesystemInfo
+		provisioner *diskv1.ProvisionerInfo
+		deviceType  diskv1.BlockDeviceType
+		filesystem  *block.FileSystemInfo
+		expectedOp  NeedMountUpdateOP
+	}{
+		{
+			name:       "not provisioned and not mounted",
+			fsSpec:     diskv1.FilesystemInfo{},
+			filesystem: &block.FileSystemInfo{},
+			expectedOp: NeedMountUpdateNoOp,
+		},
+		{
+			name:       "not provisioned but mounted",
+			fsSpec:     diskv1.FilesystemInfo{},
+			filesystem: &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1"},
+			expectedOp: NeedMountUpdateUnmount,
+		},
+		{
+			name:       "provisioned but not mounted",
+			fsSpec:     diskv1.FilesystemInfo{Provisioned: true},
+			filesystem: &block.FileSystemInfo{},
+			expectedOp: NeedMountUpdateMount,
+		},
+		{
+			name:   "provisioned and mounted",
+			fsSpec: diskv1.FilesystemInfo{Provisioned: true},
+			filesystem: &block.FileSystemInfo{
+				MountPoint:   "/var/lib/harvester/extra-disks/bd1",
+				MountOptions: []string{"rw", "relatime"},
+			},
+			expectedOp: NeedMountUpdateNoOp,
+		},
+		{
+			name:       "provisioned and mounted elsewhere",
+			fsSpec:     diskv1.FilesystemInfo{Provisioned: true},
+			filesystem: &block.FileSystemInfo{MountPoint: "/mnt/bd1"},
+			expectedOp: NeedMountUpdateUnmount | NeedMountUpdateMount,
+		},
+		{
+			name:   "mount option added",
+			fsSpec: diskv1.FilesystemInfo{Provisioned: true, MountOptions: []string{"noatime"}},
+			filesystem: &block.FileSystemInfo{
+				MountPoint:   "/var/lib/harvester/extra-disks/bd1",
+				MountOptions: []string{"rw", "relatime"},
+			},
+			expectedOp: NeedMountUpdateUnmount | NeedMountUpdateMount,
+		},
+		{
+			name:   "mount option removed",
+			fsSpec: diskv1.FilesystemInfo{Provisioned: true},
+			filesystem: &block.FileSystemInfo{
+				MountPoint:   "/var/lib/harvester/extra-disks/bd1",
+				MountOptions: []string{"rw", "noatime", "discard"},
+			},
+			expectedOp: NeedMountUpdateUnmount | NeedMountUpdateMount,
+		},
+		{
+			name:   "mount options synced",
+			fsSpec: diskv1.FilesystemInfo{Provisioned: true, MountOptions: []string{"discard", "noatime"}},
+			filesystem: &block.FileSystemInfo{
+				MountPoint:   "/var/lib/harvester/extra-disks/bd1",
+				MountOptions: []string{"rw", "noatime", "discard", "errors=remount-ro"},
+			},
+			expectedOp: NeedMountUpdateNoOp,
+		},
+		{
+			name:   "xfs mount options synced",
+			fsSpec: diskv1.FilesystemInfo{Provisioned: true, Type: "xfs", MountOptions: []string{"largeio"}},
+			filesystem: &block.FileSystemInfo{
+				MountPoint:   "/var/lib/harvester/extra-disks/bd1",
+				Type:         "xfs",
+				MountOptions: []string{"rw", "largeio", "inode64"},
+			},
+			expectedOp: NeedMountUpdateNoOp,
+		},
+		{
+			name:   "existing xfs filesystem with ext4 in spec",
+			fsSpec: diskv1.FilesystemInfo{Provisioned: true, MountOptions: []string{"noatime"}},
+			filesystem: &block.FileSystemInfo{
+				MountPoint:   "/var/lib/harvester/extra-disks/bd1",
+				Type:         "xfs",
+				MountOptions: []string{"rw", "noatime", "swalloc"},
+			},
+			expectedOp: NeedMountUpdateUnmount | NeedMountUpdateMount,
+		},
+		{
+			name:        "provisioned as block disk and not mounted",
+			fsSpec:      diskv1.FilesystemInfo{Provisioned: true},
+			provisioner: &diskv1.ProvisionerInfo{Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock}},
+			filesystem:  &block.FileSystemInfo{},
+			expectedOp:  NeedMountUpdateNoOp,
+		},
+		{
+			name:        "provisioned as block disk but mounted",
+			fsSpec:      diskv1.FilesystemInfo{Provisioned: true},
+			provisioner: &diskv1.ProvisionerInfo{Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock}},
+			filesystem:  &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1"},
+			expectedOp:  NeedMountUpdateUnmount,
+		},
+		{
+			name:       "not provisioned partition mounted by others",
+			fsSpec:     diskv1.FilesystemInfo{},
+			deviceType: diskv1.DeviceTypePart,
+			filesystem: &block.FileSystemInfo{MountPoint: "/boot"},
+			expectedOp: NeedMountUpdateNoOp,
+		},
+		{
+			name:       "not provisioned partition but mounted",
+			fsSpec:     diskv1.FilesystemInfo{},
+			deviceType: diskv1.DeviceTypePart,
+			filesystem: &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1"},
+			expectedOp: NeedMountUpdateUnmount,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fsSpec := tc.fsSpec
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+				Spec:       diskv1.BlockDeviceSpec{FileSystem: &fsSpec, Provisioner: tc.provisioner},
+			}
+			bd.Status.DeviceStatus.Details.DeviceType = tc.deviceType
+			assert.Equal(t, tc.expectedOp, c.needUpdateMountPoint(bd, tc.filesystem))
+		})
+	}
+}
+
+func Test_mountFileSystemType(t *testing.T) {
+	bd := &diskv1.BlockDevice{Spec: diskv1.BlockDeviceSpec{FileSystem: &diskv1.FilesystemInfo{}}}
+	// the filesystem found on the device wins over the type in spec
+	assert.Equal(t, "xfs", mountFileSystemType(bd, "xfs"))
+	assert.Equal(t, "ext4", mountFileSystemType(bd, ""))
+	assert.Equal(t, "ext4", mountFileSystemType(bd, "crypto_LUKS"))
+	bd.Spec.FileSystem.Type = "xfs"
+	assert.Equal(t, "ext4", mountFileSystemType(bd, "ext4"))
+	assert.Equal(t, "xfs", mountFileSystemType(bd, ""))
+}
+
+type fakeHealthChecker struct {
+	health *diskv1.DeviceHealth
+	err    error
+	checks int
+}
+
+func (f *fakeHealthChecker) Check(_ string) (*diskv1.DeviceHealth, error) {
+	f.checks++
+	if f.err != nil {
+		return nil, f.err
+	}
+	health := *f.health
+	return &health, nil
+}
+
+func Test_updateDeviceHealth(t *testing.T) {
+	interval := time.Hour
+	var testCases = []struct {
+		name            string
+		deviceType      diskv1.BlockDeviceType
+		lastHealth      *diskv1.DeviceHealth
+		checker         *fakeHealthChecker
+		expectChecked   bool
+		expectStatus    diskv1.DeviceHealthStatus
+		expectCondition corev1.ConditionStatus
+	}{
+		{
+			name:            "healthy disk",
+			deviceType:      diskv1.DeviceTypeDisk,
+			checker:         &fakeHealthChecker{health: &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthPassed, Temperature: 30}},
+			expectChecked:   true,
+			expectStatus:    diskv1.DeviceHealthPassed,
+			expectCondition: corev1.ConditionTrue,
+		},
+		{
+			name:            "failing disk",
+			deviceType:      diskv1.DeviceTypeDisk,
+			checker:         &fakeHealthChecker{health: &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthFailed}},
+			expectChecked:   true,
+			expectStatus:    diskv1.DeviceHealthFailed,
+			expectCondition: corev1.ConditionFalse,
+		},
+		{
+			name:            "check error",
+			deviceType:      diskv1.DeviceTypeDisk,
+			checker:         &fakeHealthChecker{err: errors.New("smartctl not found")},
+			expectChecked:   true,
+			expectStatus:    diskv1.DeviceHealthUnknown,
+			expectCondition: corev1.ConditionUnknown,
+		},
+		{
+			name:       "checked recently",
+			deviceType: diskv1.DeviceTypeDisk,
+			lastHealth: &diskv1.DeviceHealth{
+				OverallStatus: diskv1.DeviceHealthPassed,
+				LastCheckedAt: &metav1.Time{Time: time.Now().Add(-time.Minute)},
+			},
+			checker:       &fakeHealthChecker{health: &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthFailed}},
+			expectChecked: false,
+			expectStatus:  diskv1.DeviceHealthPassed,
+		},
+		{
+			name:       "check is due",
+			deviceType: diskv1.DeviceTypeDisk,
+			lastHealth: &diskv1.DeviceHealth{
+				OverallStatus: diskv1.DeviceHealthPassed,
+				LastCheckedAt: &metav1.Time{Time: time.Now().Add(-2 * time.Hour)},
+			},
+			checker:         &fakeHealthChecker{health: &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthFailed}},
+			expectChecked:   true,
+			expectStatus:    diskv1.DeviceHealthFailed,
+			expectCondition: corev1.ConditionFalse,
+		},
+		{
+			name:          "partition",
+			deviceType:    diskv1.DeviceTypePart,
+			checker:       &fakeHealthChecker{health: &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthPassed}},
+			expectChecked: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bds := &fakeBlockDevices{}
+			c := &Controller{
+				Namespace:           "longhorn-system",
+				Blockdevices:        bds,
+				healthChecker:       tc.checker,
+				healthCheckInterval: interval,
+			}
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+				Status: diskv1.BlockDeviceStatus{
+					DeviceStatus: diskv1.DeviceStatus{
+						Details: diskv1.DeviceDetails{DeviceType: tc.deviceType},
+						Health:  tc.lastHealth,
+					},
+				},
+			}
+
+			c.updateDeviceHealth(bd, "/dev/sda")
+
+			if tc.deviceType == diskv1.DeviceTypePart {
+				assert.Equal(t, 0, tc.checker.checks)
+				assert.Nil(t, bd.Status.DeviceStatus.Health)
+				assert.Empty(t, bds.enqueued)
+				return
+			}
+			assert.Contains(t, bds.enqueued, "bd1")
+			assert.LessOrEqual(t, bds.enqueued["bd1"], interval)
+			if !tc.expectChecked {
+				assert.Equal(t, 0, tc.checker.checks)
+				assert.Equal(t, tc.lastHealth, bd.Status.DeviceStatus.Health)
+				return
+			}
+			assert.Equal(t, 1, tc.checker.checks)
+			require.NotNil(t, bd.Status.DeviceStatus.Health)
+			assert.Equal(t, tc.expectStatus, bd.Status.DeviceStatus.Health.OverallStatus)
+			assert.NotNil(t, bd.Status.DeviceStatus.Health.LastCheckedAt)
+			assert.Equal(t, string(tc.expectCondition), diskv1.DeviceHealthy.GetStatus(bd))
+		})
+	}
+}
+
+// fakeNodes is a longhorn node client holding a single node.
+type fakeNodes struct {
+	ctllonghornv1.NodeClient
+	node    *longhornv1.Node
+	updates int
+}
+
+func (f *fakeNodes) Get(_, _ string, _ metav1.GetOptions) (*longhornv1.Node, error) {
+	return f.node.DeepCopy(), nil
+}
+
+func (f *fakeNodes) Update(node *longhornv1.Node) (*longhornv1.Node, error) {
+	f.updates++
+	f.node = node.DeepCopy()
+	return node, nil
+}
+
+func Test_unhealthyReason(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		corrupted  bool
+		filesystem *block.FileSystemInfo
+		health     *diskv1.DeviceHealth
+		ioErrors   uint64
+		expected   string
+	}{
+		{
+			name:       "healthy",
+			filesystem: &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1"},
+			health:     &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthPassed},
+			ioErrors:   ioErrorThreshold - 1,
+			expected:   "",
+		},
+		{
+			name:      "corrupted",
+			corrupted: true,
+			expected:  "filesystem is corrupted",
+		},
+		{
+			name:       "remounted read-only",
+			filesystem: &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1", IsReadOnly: true},
+			expected:   "filesystem is remounted read-only at /var/lib/harvester/extra-disks/bd1",
+		},
+		{
+			name:       "read-only but not mounted",
+			filesystem: &block.FileSystemInfo{IsReadOnly: true},
+			expected:   "",
+		},
+		{
+			name:     "failed health self-assessment",
+			health:   &diskv1.DeviceHealth{OverallStatus: diskv1.DeviceHealthFailed},
+			expected: "device failed the health self-assessment",
+		},
+		{
+			name:     "repeated I/O errors",
+			ioErrors: ioErrorThreshold,
+			expected: "device reported 10 I/O errors",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Controller{BlockInfo: &fakeBlockInfo{ioErrors: tc.ioErrors}}
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+				Status: diskv1.BlockDeviceStatus{
+					DeviceStatus: diskv1.DeviceStatus{
+						Details:    diskv1.DeviceDetails{DeviceType: diskv1.DeviceTypeDisk},
+						FileSystem: &diskv1.FilesystemStatus{Corrupted: tc.corrupted},
+						Health:     tc.health,
+					},
+				},
+			}
+			assert.Equal(t, tc.expected, c.unhealthyReason(bd, "/dev/sda", tc.filesystem))
+		})
+	}
+}
+
+func Test_evictUnhealthyDevice(t *testing.T) {
+	nodes := &fakeNodes{
+		node: &longhornv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: "longhorn-system"},
+			Spec: longhornv1.NodeSpec{
+				Disks: map[string]longhornv1.DiskSpec{
+					"bd1": {Path: "/var/lib/harvester/extra-disks/bd1", AllowScheduling: true},
+				},
+			},
+		},
+	}
+	recorder := &events.FakeRecorder{}
+	c := &Controller{Namespace: "longhorn-system", NodeName: "node1", Nodes: nodes, recorder: recorder}
+	bd := &diskv1.BlockDevice{ObjectMeta: metav1.ObjectMeta{Name: "bd1"}}
+
+	require.NoError(t, c.evictUnhealthyDevice(bd, "filesystem is corrupted"))
+	disk := nodes.node.Spec.Disks["bd1"]
+	assert.False(t, disk.AllowScheduling)
+	assert.True(t, disk.EvictionRequested)
+	assert.True(t, diskv1.DiskEvictionRequested.IsTrue(bd))
+	assert.Contains(t, diskv1.DiskEvictionRequested.GetMessage(bd), "filesystem is corrupted")
+	assert.Equal(t, 1, nodes.updates)
+	assert.Equal(t, []string{
+		"Warning EvictionRequested Requested eviction from longhorn node `node1`, filesystem is corrupted",
+		"Warning EvictionRequested Requested eviction of the disk of unhealthy block device bd1, filesystem is corrupted",
+	}, recorder.Events())
+
+	// the eviction is only requested once
+	require.NoError(t, c.evictUnhealthyDevice(bd, "device reported 10 I/O errors"))
+	assert.Equal(t, 1, nodes.updates)
+	assert.Len(t, recorder.Events(), 2)
+	assert.Contains(t, diskv1.DiskEvictionRequested.GetMessage(bd), "filesystem is corrupted")
+}
+
+func Test_longhornBlockDiskPath(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		partitioned bool
+		filesystem  *diskv1.FilesystemStatus
+	}{
+		{
+			name:        "partitioned",
+			partitioned: true,
+			filesystem:  &diskv1.FilesystemStatus{},
+		},
+		{
+			name:       "with filesystem",
+			filesystem: &diskv1.FilesystemStatus{Type: "ext4"},
+		},
+		{
+			name:       "mounted",
+			filesystem: &diskv1.FilesystemStatus{MountPoint: "/mnt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+				Status: diskv1.BlockDeviceStatus{
+					ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+					DeviceStatus: diskv1.DeviceStatus{
+						Partitioned: tc.partitioned,
+						FileSystem:  tc.filesystem,
+					},
+				},
+			}
+			_, err := longhornBlockDiskPath(bd, "/dev/sda")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/encrypt"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+type secretGetter interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Secret, error)
+}
+
+// fileSystemDevPath returns the path of the device holding the filesystem,
+// which is the opened LUKS device of an encrypted device.
+func fileSystemDevPath(device *diskv1.BlockDevice, devPath string) string {
+	if device.Status.DeviceStatus.FileSystem != nil && device.Status.DeviceStatus.FileSystem.Encrypted {
+		return encrypt.MapperPath(device.Name)
+	}
+	return devPath
+}
+
+// encryptionKey returns the key in the Secret referenced by the encryption of
+// the device.
+func (c *Controller) encryptionKey(device *diskv1.BlockDevice) ([]byte, error) {
+	encryption := device.Spec.FileSystem.Encryption
+	if encryption == nil {
+		return nil, fmt.Errorf("encryption of device %s is not set", device.Name)
+	}
+	secret, err := c.secrets.Get(context.TODO(), encryption.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption secret %s: %w", encryption.SecretName, err)
+	}
+	return encrypt.KeyFromSecret(secret)
+}
+
+// encryptDevice formats the device as a LUKS device, keeping the UUID the
+// device is identified by if it is not empty, and opens it. It returns the path
+// of the opened LUKS device to create the filesystem on.
+func (c *Controller) encryptDevice(device *diskv1.BlockDevice, devPath, uuid string) (string, error) {
+	key, err := c.encryptionKey(device)
+	if err != nil {
+		return "", err
+	}
+	if err := c.encryptor.Format(devPath, uuid, key); err != nil {
+		return "", err
+	}
+	if err := c.encryptor.Open(devPath, encrypt.MapperName(device.Name), key); err != nil {
+		return "", err
+	}
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonEncrypted, "Encrypted device %s with LUKS", devPath)
+	return encrypt.MapperPath(device.Name), nil
+}
+
+// openEncryptedDevice opens the LUKS device of an encrypted device, e.g. after
+// a reboot, so its filesystem could be mounted.
+func (c *Controller) openEncryptedDevice(device *diskv1.BlockDevice, devPath string) error {
+	key, err := c.encryptionKey(device)
+	if err != nil {
+		return err
+	}
+	return c.encryptor.Open(devPath, encrypt.MapperName(device.Name), key)
+}
+
+// closeEncryptedDevice closes the LUKS device of an encrypted device once its
+// filesystem is unmounted.
+func (c *Controller) closeEncryptedDevice(device *diskv1.BlockDevice) error {
+	return c.encryptor.Close(encrypt.MapperName(device.Name))
+}
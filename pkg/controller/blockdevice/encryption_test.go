@@ -0,0 +1,152 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+// fakeSecrets gets the secrets by name
+type fakeSecrets map[string]*corev1.Secret
+
+func (f fakeSecrets) Get(_ context.Context, name string, _ metav1.GetOptions) (*corev1.Secret, error) {
+	if secret, ok := f[name]; ok {
+		return secret, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+}
+
+// fakeEncryptor records the operations on the LUKS devices
+type fakeEncryptor struct {
+	operations []string
+}
+
+func (f *fakeEncryptor) Format(devPath, uuid string, key []byte) error {
+	f.operations = append(f.operations, fmt.Sprintf("format %s %s %s", devPath, uuid, key))
+	return nil
+}
+
+func (f *fakeEncryptor) Open(devPath, name string, key []byte) error {
+	f.operations = append(f.operations, fmt.Sprintf("open %s %s %s", devPath, name, key))
+	return nil
+}
+
+func (f *fakeEncryptor) Close(name string) error {
+	f.operations = append(f.operations, "close "+name)
+	return nil
+}
+
+func (f *fakeEncryptor) Resize(name string, key []byte) error {
+	f.operations = append(f.operations, fmt.Sprintf("resize %s %s", name, key))
+	return nil
+}
+
+func Test_encryptDevice(t *testing.T) {
+	encryptor := &fakeEncryptor{}
+	c := &Controller{
+		recorder:  &events.FakeRecorder{},
+		encryptor: encryptor,
+		secrets: fakeSecrets{
+			"disk-key": {Data: map[string][]byte{"passphrase": []byte("secret\n")}},
+		},
+	}
+	newBlockDevice := func(secretName string) *diskv1.BlockDevice {
+		return &diskv1.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+			Spec: diskv1.BlockDeviceSpec{
+				FileSystem: &diskv1.FilesystemInfo{
+					ForceFormatted: true,
+					Encryption:     &diskv1.EncryptionInfo{SecretName: secretName},
+				},
+			},
+			Status: diskv1.BlockDeviceStatus{
+				DeviceStatus: diskv1.DeviceStatus{FileSystem: &diskv1.FilesystemStatus{}},
+			},
+		}
+	}
+
+	// the LUKS header keeps the UUID the device is identified by
+	bd := newBlockDevice("disk-key")
+	assert.Equal(t, "/dev/sdb", fileSystemDevPath(bd, "/dev/sdb"))
+	fsDevPath, err := c.encryptDevice(bd, "/dev/sdb", "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/mapper/ndm-bd1", fsDevPath)
+	bd.Status.DeviceStatus.FileSystem.Encrypted = true
+	assert.Equal(t, fsDevPath, fileSystemDevPath(bd, "/dev/sdb"))
+
+	// opened again after a reboot, and closed once unmounted
+	require.NoError(t, c.openEncryptedDevice(bd, "/dev/sdb"))
+	require.NoError(t, c.closeEncryptedDevice(bd))
+	assert.Equal(t, []string{
+		"format /dev/sdb 6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e secret",
+		"open /dev/sdb ndm-bd1 secret",
+		"open /dev/sdb ndm-bd1 secret",
+		"close ndm-bd1",
+	}, encryptor.operations)
+
+	// the secret is not found
+	bd = newBlockDevice("missing-key")
+	_, err = c.encryptDevice(bd, "/dev/sdb", "")
+	assert.Error(t, err)
+	assert.Error(t, c.openEncryptedDevice(bd, "/dev/sdb"))
+	assert.Len(t, encryptor.operations, 4)
+}
+
+func Test_expandEncryptedFileSystem(t *testing.T) {
+	tmpl, err := newMountPathTemplate(DefaultMountPathTemplate)
+	require.NoError(t, err)
+	resizer := &fakeResizer{fsSize: 100 << 30, deviceSize: 200 << 30}
+	encryptor := &fakeEncryptor{}
+	c := &Controller{
+		Blockdevices:      &fakeBlockDevices{},
+		semaphore:         newSemaphore(1),
+		recorder:          &events.FakeRecorder{},
+		mountPathTemplate: tmpl,
+		resizer:           resizer,
+		encryptor:         encryptor,
+		secrets: fakeSecrets{
+			"disk-key": {Data: map[string][]byte{"keyfile": []byte("secret")}},
+		},
+	}
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Spec: diskv1.BlockDeviceSpec{
+			FileSystem: &diskv1.FilesystemInfo{
+				Provisioned: true,
+				AutoExpand:  true,
+				Encryption:  &diskv1.EncryptionInfo{SecretName: "disk-key"},
+			},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			ProvisionPhase: diskv1.ProvisionPhaseProvisioned,
+			DeviceStatus: diskv1.DeviceStatus{
+				Capacity:   diskv1.DeviceCapcity{SizeBytes: 200 << 30},
+				FileSystem: &diskv1.FilesystemStatus{Encrypted: true},
+			},
+		},
+	}
+	filesystem := &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1", Type: "ext4"}
+
+	// the LUKS device grows before the filesystem on it
+	require.NoError(t, c.expandFileSystem(bd, "/dev/sdb", filesystem))
+	assert.Equal(t, []string{"resize ndm-bd1 secret"}, encryptor.operations)
+	assert.Equal(t, []string{"/dev/mapper/ndm-bd1:/var/lib/harvester/extra-disks/bd1:ext4"}, resizer.expanded)
+
+	// the LUKS header is not taken as the space to expand the filesystem to
+	resizer.fsSize = 200<<30 - 16<<20
+	diskv1.DeviceExpanded.SetStatusBool(bd, false)
+	require.NoError(t, c.expandFileSystem(bd, "/dev/sdb", filesystem))
+	assert.Len(t, resizer.expanded, 1)
+	assert.True(t, diskv1.DeviceExpanded.IsTrue(bd))
+}
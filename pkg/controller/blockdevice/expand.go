@@ -0,0 +1,136 @@
+package blockdevice
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/encrypt"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+const (
+	// expandSlack is the space at the end of a device which a filesystem may
+	// leave unused, e.g. the tail smaller than a filesystem block
+	expandSlack = 1 << 20
+
+	// the backoff of retrying a failed expansion, which often fails again,
+	// e.g. for a filesystem corrupted or full of metadata
+	expandBackoffInitial = 30 * time.Second
+	expandBackoffMax     = 30 * time.Minute
+)
+
+// markDeviceGrown marks the filesystem of a device with autoExpand to be
+// expanded once the device grows, so the growth is not missed even if the
+// filesystem could not be expanded at the moment, e.g. it is not mounted.
+func markDeviceGrown(device *diskv1.BlockDevice, lastSizeBytes uint64) {
+	sizeBytes := device.Status.DeviceStatus.Capacity.SizeBytes
+	if !device.Spec.FileSystem.AutoExpand || sizeBytes <= lastSizeBytes {
+		return
+	}
+	logrus.Infof("Device %s grew from %d to %d bytes", device.Name, lastSizeBytes, sizeBytes)
+	diskv1.DeviceExpanded.SetStatus(device, string(corev1.ConditionUnknown))
+	diskv1.DeviceExpanded.Message(device, fmt.Sprintf("Device grew from %d to %d bytes, waiting to expand the filesystem", lastSizeBytes, sizeBytes))
+}
+
+// needExpand returns true if the filesystem mounted by NDM is not checked
+// against the size of the device since autoExpand is enabled or the device
+// grew, or the last expansion failed.
+func (c *Controller) needExpand(device *diskv1.BlockDevice, filesystem *block.FileSystemInfo) bool {
+	if !device.Spec.FileSystem.AutoExpand || diskv1.DeviceExpanded.IsTrue(device) {
+		return false
+	}
+	if device.Status.ProvisionPhase != diskv1.ProvisionPhaseProvisioned || isLonghornBlockDisk(device) || device.Status.DeviceStatus.FileSystem.Corrupted {
+		return false
+	}
+	return filesystem != nil && filesystem.MountPoint == c.extraDiskMountPoint(device) && !filesystem.IsReadOnly
+}
+
+// onFileSystemExpand expands the filesystem, unless the last expansion of the
+// device failed within its backoff. A failed expansion is retried once the
+// backoff, doubled on each failure, expires, so a persistent failure does not
+// run the filesystem tools and emit an event on every reconcile.
+func (c *Controller) onFileSystemExpand(device, deviceCpy *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) {
+	if c.expandBackoff != nil && c.expandBackoff.IsInBackOffSinceUpdate(device.Name, c.expandBackoff.Clock.Now()) {
+		logrus.Debugf("Skip expanding filesystem of device %s in backoff", device.Name)
+		return
+	}
+	err := c.expandFileSystem(deviceCpy, devPath, filesystem)
+	if err == nil {
+		if c.expandBackoff != nil && diskv1.DeviceExpanded.IsTrue(deviceCpy) {
+			c.expandBackoff.Reset(device.Name)
+		}
+		return
+	}
+	err = fmt.Errorf("failed to expand filesystem of device %s: %w", device.Name, err)
+	logrus.Error(err)
+	c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonExpandFailed, err.Error())
+	diskv1.DeviceExpanded.SetError(deviceCpy, "", err)
+	diskv1.DeviceExpanded.SetStatusBool(deviceCpy, false)
+	delay := jitterEnqueueDelay()
+	if c.expandBackoff != nil {
+		c.expandBackoff.Next(device.Name, c.expandBackoff.Clock.Now())
+		delay = c.expandBackoff.Get(device.Name)
+	}
+	c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, delay)
+}
+
+// expandFileSystem grows the mounted filesystem online once the device is
+// larger than it, e.g. a resized virtual disk or SAN LUN. Longhorn picks up the
+// new size of the filesystem in the StorageMaximum of the disk by itself.
+func (c *Controller) expandFileSystem(device *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) error {
+	fsType := mountFileSystemType(device, filesystem.Type)
+	deviceSize := device.Status.DeviceStatus.Capacity.SizeBytes
+	encrypted := device.Status.DeviceStatus.FileSystem.Encrypted
+	fsDevPath := fileSystemDevPath(device, devPath)
+	slack := uint64(expandSlack)
+	if encrypted {
+		slack += encrypt.HeaderSize
+	}
+	fsSize, err := c.resizer.FileSystemSize(fsDevPath, filesystem.MountPoint, fsType)
+	if err != nil {
+		return err
+	}
+	if fsSize+slack >= deviceSize {
+		diskv1.DeviceExpanded.SetError(device, "", nil)
+		diskv1.DeviceExpanded.SetStatusBool(device, true)
+		diskv1.DeviceExpanded.Message(device, fmt.Sprintf("Filesystem of %d bytes fills the device of %d bytes", fsSize, deviceSize))
+		return nil
+	}
+
+	if !c.semaphore.tryAcquire() {
+		logrus.Infof("Hit maximum concurrent count. Requeue device %s", device.Name)
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		return nil
+	}
+	defer c.semaphore.release()
+
+	// the LUKS device under the filesystem grows first
+	if encrypted {
+		key, err := c.encryptionKey(device)
+		if err != nil {
+			return err
+		}
+		if err := c.encryptor.Resize(encrypt.MapperName(device.Name), key); err != nil {
+			return err
+		}
+	}
+	if err := c.resizer.Expand(fsDevPath, filesystem.MountPoint, fsType); err != nil {
+		return err
+	}
+	newFsSize, err := c.resizer.FileSystemSize(fsDevPath, filesystem.MountPoint, fsType)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Expanded %s filesystem from %d to %d bytes", fsType, fsSize, newFsSize)
+	diskv1.DeviceExpanded.SetError(device, "", nil)
+	diskv1.DeviceExpanded.SetStatusBool(device, true)
+	diskv1.DeviceExpanded.Message(device, msg)
+	logrus.Infof("Device %s is expanded: %s", device.Name, msg)
+	c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonExpanded, msg)
+	return nil
+}
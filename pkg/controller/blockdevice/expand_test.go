@@ -0,0 +1,166 @@
+package blockdevice
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
+	testingclock "k8s.io/utils/clock/testing"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+// fakeResizer grows the filesystem to the size of the device on expansion
+type fakeResizer struct {
+	fsSize     uint64
+	deviceSize uint64
+	expanded   []string
+	err        error
+}
+
+func (f *fakeResizer) FileSystemSize(_, _, _ string) (uint64, error) {
+	return f.fsSize, nil
+}
+
+func (f *fakeResizer) Expand(devPath, mountPoint, fsType string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.expanded = append(f.expanded, fmt.Sprintf("%s:%s:%s", devPath, mountPoint, fsType))
+	f.fsSize = f.deviceSize
+	return nil
+}
+
+func Test_expandFileSystem(t *testing.T) {
+	tmpl, err := newMountPathTemplate(DefaultMountPathTemplate)
+	require.NoError(t, err)
+	resizer := &fakeResizer{fsSize: 100 << 30, deviceSize: 200 << 30}
+	c := &Controller{
+		Namespace:         "longhorn-system",
+		Blockdevices:      &fakeBlockDevices{},
+		semaphore:         newSemaphore(1),
+		recorder:          &events.FakeRecorder{},
+		mountPathTemplate: tmpl,
+		resizer:           resizer,
+	}
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Spec: diskv1.BlockDeviceSpec{
+			FileSystem: &diskv1.FilesystemInfo{Provisioned: true, AutoExpand: true},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			ProvisionPhase: diskv1.ProvisionPhaseProvisioned,
+			DeviceStatus: diskv1.DeviceStatus{
+				Capacity:   diskv1.DeviceCapcity{SizeBytes: 100 << 30},
+				Details:    diskv1.DeviceDetails{DeviceType: diskv1.DeviceTypeDisk},
+				FileSystem: &diskv1.FilesystemStatus{},
+			},
+		},
+	}
+	filesystem := &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1", Type: "xfs"}
+
+	// the filesystem is checked once autoExpand is enabled
+	require.True(t, c.needExpand(bd, filesystem))
+	resizer.deviceSize = 100 << 30
+	require.NoError(t, c.expandFileSystem(bd, "/dev/sdb", filesystem))
+	assert.Empty(t, resizer.expanded)
+	assert.True(t, diskv1.DeviceExpanded.IsTrue(bd))
+	assert.False(t, c.needExpand(bd, filesystem))
+
+	// the device grows
+	resizer.deviceSize = 200 << 30
+	bd.Status.DeviceStatus.Capacity.SizeBytes = 200 << 30
+	markDeviceGrown(bd, 100<<30)
+	assert.False(t, diskv1.DeviceExpanded.IsTrue(bd))
+
+	// a filesystem not mounted by NDM is not expanded
+	assert.False(t, c.needExpand(bd, &block.FileSystemInfo{MountPoint: "/mnt/data", Type: "xfs"}))
+	assert.False(t, c.needExpand(bd, &block.FileSystemInfo{}))
+
+	// the failed expansion is retried
+	require.True(t, c.needExpand(bd, filesystem))
+	resizer.err = fmt.Errorf("xfs_growfs failed")
+	assert.Error(t, c.expandFileSystem(bd, "/dev/sdb", filesystem))
+	assert.True(t, c.semaphore.acquire())
+	c.semaphore.release()
+
+	resizer.err = nil
+	require.NoError(t, c.expandFileSystem(bd, "/dev/sdb", filesystem))
+	assert.Equal(t, []string{"/dev/sdb:/var/lib/harvester/extra-disks/bd1:xfs"}, resizer.expanded)
+	assert.True(t, diskv1.DeviceExpanded.IsTrue(bd))
+	assert.Equal(t, "Expanded xfs filesystem from 107374182400 to 214748364800 bytes", diskv1.DeviceExpanded.GetMessage(bd))
+	assert.False(t, c.needExpand(bd, filesystem))
+
+	// the device does not grow further
+	markDeviceGrown(bd, 200<<30)
+	assert.True(t, diskv1.DeviceExpanded.IsTrue(bd))
+
+	// a device without autoExpand is never expanded
+	bd.Spec.FileSystem.AutoExpand = false
+	bd.Status.DeviceStatus.Capacity.SizeBytes = 300 << 30
+	markDeviceGrown(bd, 200<<30)
+	assert.True(t, diskv1.DeviceExpanded.IsTrue(bd))
+	diskv1.DeviceExpanded.SetStatusBool(bd, false)
+	assert.False(t, c.needExpand(bd, filesystem))
+}
+
+func Test_onFileSystemExpand(t *testing.T) {
+	tmpl, err := newMountPathTemplate(DefaultMountPathTemplate)
+	require.NoError(t, err)
+	clock := testingclock.NewFakeClock(time.Now())
+	resizer := &fakeResizer{fsSize: 100 << 30, deviceSize: 200 << 30, err: fmt.Errorf("xfs_growfs failed")}
+	bds := &fakeBlockDevices{}
+	recorder := &events.FakeRecorder{}
+	c := &Controller{
+		Namespace:         "longhorn-system",
+		Blockdevices:      bds,
+		semaphore:         newSemaphore(1),
+		recorder:          recorder,
+		mountPathTemplate: tmpl,
+		resizer:           resizer,
+		expandBackoff:     flowcontrol.NewFakeBackOff(expandBackoffInitial, expandBackoffMax, clock),
+	}
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Spec: diskv1.BlockDeviceSpec{
+			FileSystem: &diskv1.FilesystemInfo{Provisioned: true, AutoExpand: true},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			ProvisionPhase: diskv1.ProvisionPhaseProvisioned,
+			DeviceStatus: diskv1.DeviceStatus{
+				Capacity:   diskv1.DeviceCapcity{SizeBytes: 200 << 30},
+				Details:    diskv1.DeviceDetails{DeviceType: diskv1.DeviceTypeDisk},
+				FileSystem: &diskv1.FilesystemStatus{},
+			},
+		},
+	}
+	filesystem := &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1", Type: "xfs"}
+
+	c.onFileSystemExpand(bd, bd, "/dev/sdb", filesystem)
+	assert.Equal(t, expandBackoffInitial, bds.enqueued["bd1"])
+	assert.Len(t, recorder.Events(), 1)
+
+	// no retry within the backoff
+	clock.Step(expandBackoffInitial / 2)
+	c.onFileSystemExpand(bd, bd, "/dev/sdb", filesystem)
+	assert.Len(t, recorder.Events(), 1)
+
+	// the backoff doubles on each failure
+	clock.Step(expandBackoffInitial / 2)
+	c.onFileSystemExpand(bd, bd, "/dev/sdb", filesystem)
+	assert.Equal(t, 2*expandBackoffInitial, bds.enqueued["bd1"])
+	assert.Len(t, recorder.Events(), 2)
+
+	// the backoff is reset once the filesystem is expanded
+	clock.Step(2 * expandBackoffInitial)
+	resizer.err = nil
+	c.onFileSystemExpand(bd, bd, "/dev/sdb", filesystem)
+	assert.True(t, diskv1.DeviceExpanded.IsTrue(bd))
+	assert.Equal(t, time.Duration(0), c.expandBackoff.Get("bd1"))
+}
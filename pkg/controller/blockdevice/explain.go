@@ -0,0 +1,79 @@
+package blockdevice
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	diskclientv1 "github.com/harvester/node-disk-manager/pkg/generated/clientset/versioned/typed/harvesterhci.io/v1beta1"
+)
+
+// DeviceExplanation explains why a disk or partition found on the node is
+// collected as a block device or not.
+type DeviceExplanation struct {
+	DevPath string `json:"devPath"`
+	// BlockDevice is the name of the block device collected
+	BlockDevice string `json:"blockDevice,omitempty"`
+	// ExcludedBy is the name of the first exclude filter matching the device
+	ExcludedBy string `json:"excludedBy,omitempty"`
+	// AutoProvisionedBy is the name of the first auto-provision filter
+	// promoting the disk
+	AutoProvisionedBy string `json:"autoProvisionedBy,omitempty"`
+	// ProvisionPolicy is the name of the DiskProvisionPolicy matching the
+	// disk, which takes precedence over the auto-provision filters
+	ProvisionPolicy string `json:"provisionPolicy,omitempty"`
+	// Skipped is the reason the device is skipped other than the filters
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// ExplainDevices runs the filters and the provision policies against the
+// devices of the node, as the scanner does, without writing anything to the
+// disks or the cluster.
+func (s *Scanner) ExplainDevices() []*DeviceExplanation {
+	_, explanations := s.scanDevices(true)
+	return explanations
+}
+
+// policyClientLister lists the DiskProvisionPolicies from the API server, for
+// the one-shot callers without the controller cache.
+type policyClientLister struct {
+	client diskclientv1.DiskProvisionPolicyInterface
+}
+
+// NewProvisionPolicyClientLister returns the DiskProvisionPolicy lister of the
+// client to build a ProvisionPolicyMatcher with.
+func NewProvisionPolicyClientLister(client diskclientv1.DiskProvisionPolicyInterface) PolicyLister {
+	return &policyClientLister{client: client}
+}
+
+func (l *policyClientLister) List(selector labels.Selector) ([]*diskv1.DiskProvisionPolicy, error) {
+	list, err := l.client.List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]*diskv1.DiskProvisionPolicy, 0, len(list.Items))
+	for i := range list.Items {
+		policies = append(policies, &list.Items[i])
+	}
+	return policies, nil
+}
+
+// nodeClientLister gets the nodes from the API server, for the one-shot
+// callers without the informer cache.
+type nodeClientLister struct {
+	client typedcorev1.NodeInterface
+}
+
+// NewNodeClientLister returns the Node lister of the client to build a
+// ProvisionPolicyMatcher with.
+func NewNodeClientLister(client typedcorev1.NodeInterface) NodeLister {
+	return &nodeClientLister{client: client}
+}
+
+func (l *nodeClientLister) Get(name string) (*corev1.Node, error) {
+	return l.client.Get(context.TODO(), name, metav1.GetOptions{})
+}
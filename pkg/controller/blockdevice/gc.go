@@ -0,0 +1,98 @@
+package blockdevice
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+// onInactiveDeviceChange garbage collects an inactive device once its TTL
+// expires. A provisioned device is removed from the Longhorn node first, and
+// is deleted as an unprovisioned device later.
+func (c *Controller) onInactiveDeviceChange(device *diskv1.BlockDevice) (*diskv1.BlockDevice, error) {
+	if device.Status.InactiveSince == nil {
+		// the scanner records the time soon
+		return nil, nil
+	}
+	elapsed := time.Since(device.Status.InactiveSince.Time)
+
+	if device.Status.ProvisionPhase == diskv1.ProvisionPhaseUnprovisioned && device.Status.VolumeGroup == nil {
+		if c.inactiveDeviceTTL == 0 {
+			return nil, nil
+		}
+		if elapsed < c.inactiveDeviceTTL {
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, c.inactiveDeviceTTL-elapsed)
+			return nil, nil
+		}
+		logrus.Infof("Delete block device %s inactive since %s", device.Name, device.Status.InactiveSince)
+		if err := c.Blockdevices.Delete(c.Namespace, device.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// the physical volumes of LVM are not collected, a missing one has to be
+	// removed from its volume group manually
+	if isLVMDevice(device) || device.Status.VolumeGroup != nil || c.inactiveProvisionedTTL == 0 {
+		return nil, nil
+	}
+	if elapsed < c.inactiveProvisionedTTL {
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, c.inactiveProvisionedTTL-elapsed)
+		return nil, nil
+	}
+	deviceCpy := device.DeepCopy()
+	if err := c.removeInactiveDeviceFromNode(deviceCpy); err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(device, deviceCpy) {
+		return c.Blockdevices.Update(deviceCpy)
+	}
+	return nil, nil
+}
+
+// removeInactiveDeviceFromNode removes the disk of an inactive device from the
+// Longhorn node, as long as Longhorn reports no replicas on it.
+func (c *Controller) removeInactiveDeviceFromNode(device *diskv1.BlockDevice) error {
+	node, err := c.Nodes.Get(c.Namespace, c.NodeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	msg := fmt.Sprintf("Disk of inactive device not in longhorn node `%s`", c.NodeName)
+	if _, ok := node.Spec.Disks[device.Name]; ok {
+		status, ok := node.Status.DiskStatus[device.Name]
+		if !ok || len(status.ScheduledReplica) > 0 {
+			logrus.Infof("Keep the disk of inactive device %s in longhorn node %s/%s, the replicas on it are not reported as removed",
+				device.Name, c.Namespace, c.NodeName)
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, c.inactiveProvisionedTTL)
+			return nil
+		}
+		nodeCpy := node.DeepCopy()
+		delete(nodeCpy.Spec.Disks, device.Name)
+		if _, err := c.Nodes.Update(nodeCpy); err != nil {
+			return err
+		}
+		msg = fmt.Sprintf("Removed disk of inactive device from longhorn node `%s`", c.NodeName)
+		logrus.Infof("Removed disk of device %s inactive since %s from longhorn node %s/%s",
+			device.Name, device.Status.InactiveSince, c.Namespace, c.NodeName)
+		c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonUnprovisioned, msg)
+		c.recorder.Eventf(node, corev1.EventTypeNormal, events.ReasonUnprovisioned, "Removed disk of inactive block device %s", device.Name)
+	}
+
+	device.Status.ProvisionPhase = diskv1.ProvisionPhaseUnprovisioned
+	diskv1.DiskAddedToNode.SetError(device, "", nil)
+	diskv1.DiskAddedToNode.SetStatusBool(device, false)
+	diskv1.DiskAddedToNode.Message(device, msg)
+	return nil
+}
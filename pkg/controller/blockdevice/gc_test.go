@@ -0,0 +1,128 @@
+package blockdevice
+
+import (
+	"testing"
+	"time"
+
+	longhornv1 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+func Test_onInactiveDeviceChange(t *testing.T) {
+	const ttl = time.Hour
+	var testCases = []struct {
+		name           string
+		inactiveFor    time.Duration
+		provisioned    bool
+		replicas       map[string]int64
+		expectDeleted  bool
+		expectRemoved  bool
+		expectEnqueued bool
+		expectPhase    diskv1.BlockDeviceProvisionPhase
+	}{
+		{
+			name:           "unprovisioned within TTL",
+			inactiveFor:    time.Minute,
+			expectEnqueued: true,
+			expectPhase:    diskv1.ProvisionPhaseUnprovisioned,
+		},
+		{
+			name:          "unprovisioned after TTL",
+			inactiveFor:   2 * ttl,
+			expectDeleted: true,
+			expectPhase:   diskv1.ProvisionPhaseUnprovisioned,
+		},
+		{
+			name:           "provisioned within TTL",
+			inactiveFor:    time.Minute,
+			provisioned:    true,
+			expectEnqueued: true,
+			expectPhase:    diskv1.ProvisionPhaseProvisioned,
+		},
+		{
+			name:           "provisioned after TTL with replicas",
+			inactiveFor:    2 * ttl,
+			provisioned:    true,
+			replicas:       map[string]int64{"replica1": 1024},
+			expectEnqueued: true,
+			expectPhase:    diskv1.ProvisionPhaseProvisioned,
+		},
+		{
+			name:          "provisioned after TTL without replicas",
+			inactiveFor:   2 * ttl,
+			provisioned:   true,
+			expectRemoved: true,
+			expectPhase:   diskv1.ProvisionPhaseUnprovisioned,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := &longhornv1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: "longhorn-system"},
+				Spec:       longhornv1.NodeSpec{Disks: map[string]longhornv1.DiskSpec{}},
+				Status:     longhornv1.NodeStatus{DiskStatus: map[string]*longhornv1.DiskStatus{}},
+			}
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+				Spec:       diskv1.BlockDeviceSpec{FileSystem: &diskv1.FilesystemInfo{Provisioned: tc.provisioned}},
+				Status: diskv1.BlockDeviceStatus{
+					State:          diskv1.BlockDeviceInactive,
+					InactiveSince:  &metav1.Time{Time: time.Now().Add(-tc.inactiveFor)},
+					ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+				},
+			}
+			if tc.provisioned {
+				bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+				node.Spec.Disks["bd1"] = longhornv1.DiskSpec{Path: "/var/lib/harvester/extra-disks/bd1"}
+				node.Status.DiskStatus["bd1"] = &longhornv1.DiskStatus{ScheduledReplica: tc.replicas}
+			}
+			nodes := &fakeNodes{node: node}
+			bds := &fakeBlockDevices{}
+			c := &Controller{
+				Namespace:              "longhorn-system",
+				NodeName:               "node1",
+				Nodes:                  nodes,
+				Blockdevices:           bds,
+				recorder:               &events.FakeRecorder{},
+				inactiveDeviceTTL:      ttl,
+				inactiveProvisionedTTL: ttl,
+			}
+
+			updated, err := c.onInactiveDeviceChange(bd)
+			require.NoError(t, err)
+			if updated == nil {
+				updated = bd
+			}
+			assert.Equal(t, tc.expectPhase, updated.Status.ProvisionPhase)
+			assert.Equal(t, tc.expectDeleted, len(bds.deleted) == 1)
+			assert.Equal(t, tc.expectEnqueued, bds.enqueued != nil)
+			_, inNode := nodes.node.Spec.Disks["bd1"]
+			assert.Equal(t, tc.provisioned && !tc.expectRemoved, inNode)
+		})
+	}
+}
+
+func Test_onInactiveDeviceChangeDisabled(t *testing.T) {
+	bds := &fakeBlockDevices{}
+	c := &Controller{Namespace: "longhorn-system", NodeName: "node1", Blockdevices: bds}
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Status: diskv1.BlockDeviceStatus{
+			State:          diskv1.BlockDeviceInactive,
+			InactiveSince:  &metav1.Time{Time: time.Now().Add(-24 * time.Hour)},
+			ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+		},
+	}
+
+	updated, err := c.onInactiveDeviceChange(bd)
+	require.NoError(t, err)
+	assert.Nil(t, updated)
+	assert.Empty(t, bds.deleted)
+	assert.Empty(t, bds.enqueued)
+}
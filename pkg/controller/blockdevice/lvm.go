@@ -0,0 +1,228 @@
+package blockdevice
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/lvm"
+)
+
+// volumeGroupStatusInterval is the interval to refresh the volume group capacity in status
+const volumeGroupStatusInterval = time.Minute
+
+// lvmVGName returns the volume group of the LVM provisioner in spec, or an
+// empty string if the device is not provisioned by LVM.
+func lvmVGName(device *diskv1.BlockDevice) string {
+	if device.Spec.Provisioner == nil || device.Spec.Provisioner.LVM == nil {
+		return ""
+	}
+	return device.Spec.Provisioner.LVM.VgName
+}
+
+// isLVMDevice returns true if the device is in a volume group, or is going to
+// be added to one. A device provisioned to Longhorn needs to be unprovisioned
+// from Longhorn first.
+func isLVMDevice(device *diskv1.BlockDevice) bool {
+	if device.Status.VolumeGroup != nil {
+		return true
+	}
+	return lvmVGName(device) != "" && device.Status.ProvisionPhase == diskv1.ProvisionPhaseUnprovisioned
+}
+
+// onLVMDeviceChange provisions the device as a physical volume of the volume
+// group in spec instead of a Longhorn disk. The device is used raw, so it is
+// never formatted or mounted by NDM.
+func (c *Controller) onLVMDeviceChange(device, deviceCpy *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) (*diskv1.BlockDevice, error) {
+	vgName := lvmVGName(deviceCpy)
+	current := deviceCpy.Status.VolumeGroup
+	switch {
+	case current != nil && (!deviceCpy.Spec.FileSystem.Provisioned || current.Name != vgName):
+		logrus.Infof("Prepare to remove device %s from volume group %s", device.Name, current.Name)
+		if err := c.unprovisionDeviceFromVG(deviceCpy, devPath); err != nil {
+			err := fmt.Errorf("failed to remove device %s from volume group %s: %w", device.Name, current.Name, err)
+			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonUnprovisionFailed, err.Error())
+			diskv1.DeviceAddedToVG.SetError(deviceCpy, "", err)
+			diskv1.DeviceAddedToVG.SetStatusBool(deviceCpy, false)
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		}
+	case current == nil && deviceCpy.Spec.FileSystem.Provisioned && vgName != "":
+		logrus.Infof("Prepare to add device %s to volume group %s", device.Name, vgName)
+		if err := c.provisionDeviceToVG(deviceCpy, devPath, vgName, filesystem); err != nil {
+			err := fmt.Errorf("failed to add device %s to volume group %s: %w", device.Name, vgName, err)
+			logrus.Error(err)
+			c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonProvisionFailed, err.Error())
+			diskv1.DeviceAddedToVG.SetError(deviceCpy, "", err)
+			diskv1.DeviceAddedToVG.SetStatusBool(deviceCpy, false)
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		}
+	case current != nil && deviceCpy.Status.ProvisionPhase == diskv1.ProvisionPhaseProvisioned:
+		if err := c.updateVolumeGroupStatus(deviceCpy); err != nil {
+			logrus.Warnf("failed to update volume group status of device %s: %s", device.Name, err.Error())
+		}
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, volumeGroupStatusInterval)
+	}
+
+	if !reflect.DeepEqual(device, deviceCpy) {
+		logrus.Debugf("Update block device %s for new volume group state", device.Name)
+		return c.Blockdevices.Update(deviceCpy)
+	}
+
+	if err := c.updateDeviceStatus(deviceCpy, devPath); err != nil {
+		return nil, err
+	}
+	c.updateDeviceHealth(deviceCpy, devPath)
+
+	if !reflect.DeepEqual(device, deviceCpy) {
+		logrus.Debugf("Update block device %s for new device status", device.Name)
+		return c.Blockdevices.Update(deviceCpy)
+	}
+	return nil, nil
+}
+
+// provisionDeviceToVG initializes the device as a physical volume and adds it
+// to the volume group, which is created if not exists.
+func (c *Controller) provisionDeviceToVG(device *diskv1.BlockDevice, devPath, vgName string, filesystem *block.FileSystemInfo) error {
+	if filesystem != nil && filesystem.MountPoint != "" {
+		return fmt.Errorf("device is mounted at %s", filesystem.MountPoint)
+	}
+	if err := c.checkRootDisk(device, devPath); err != nil {
+		return err
+	}
+
+	pv, err := c.lvmManager.GetPV(devPath)
+	if err != nil {
+		return err
+	}
+	if pv == nil {
+		wipe := device.Spec.FileSystem.ForceFormatted
+		hasData := device.Status.DeviceStatus.Partitioned || device.Status.DeviceStatus.FileSystem.Type != ""
+		if hasData && !wipe {
+			return fmt.Errorf("device has partitions or a filesystem, please set spec.fileSystem.forceFormatted to wipe it")
+		}
+		logrus.Infof("Create physical volume on device %s", device.Name)
+		if err := c.lvmManager.CreatePV(devPath, wipe); err != nil {
+			return err
+		}
+	} else if pv.VGName != "" && pv.VGName != vgName {
+		return fmt.Errorf("device is already a physical volume of volume group %s", pv.VGName)
+	}
+	if pv == nil || pv.VGName == "" {
+		if err := c.lvmManager.ExtendVG(vgName, devPath); err != nil {
+			return err
+		}
+	}
+
+	device.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+	device.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: vgName}
+	diskv1.DeviceAddedToVG.SetError(device, "", nil)
+	diskv1.DeviceAddedToVG.SetStatusBool(device, true)
+	diskv1.DeviceAddedToVG.Message(device, fmt.Sprintf("Added device %s to volume group %s", device.Name, vgName))
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonProvisioned, "Added device %s to volume group %s", device.Name, vgName)
+	return c.updateVolumeGroupStatus(device)
+}
+
+// unprovisionDeviceFromVG removes the device from its volume group. The
+// allocated extents are moved to the other physical volumes first with pvmove,
+// and the device is requeued until the move is done.
+func (c *Controller) unprovisionDeviceFromVG(device *diskv1.BlockDevice, devPath string) error {
+	vgName := device.Status.VolumeGroup.Name
+	device.Status.ProvisionPhase = diskv1.ProvisionPhaseUnprovisioning
+
+	pv, err := c.lvmManager.GetPV(devPath)
+	if err != nil {
+		return err
+	}
+	if pv != nil && pv.VGName == vgName {
+		if pv.UsedBytes > 0 {
+			return c.moveExtentsOffPV(device, devPath, pv)
+		}
+		vg, err := c.lvmManager.GetVG(vgName)
+		if err != nil {
+			return err
+		}
+		if vg != nil && vg.PVCount <= 1 {
+			if vg.LVCount > 0 {
+				return fmt.Errorf("device is the last physical volume of volume group %s with %d logical volumes", vgName, vg.LVCount)
+			}
+			logrus.Infof("Remove volume group %s with its last device %s", vgName, device.Name)
+			err = c.lvmManager.RemoveVG(vgName)
+		} else {
+			logrus.Infof("Remove device %s from volume group %s", device.Name, vgName)
+			err = c.lvmManager.ReduceVG(vgName, devPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if pv != nil && (pv.VGName == "" || pv.VGName == vgName) {
+		if err := c.lvmManager.RemovePV(devPath); err != nil {
+			return err
+		}
+	}
+
+	device.Status.ProvisionPhase = diskv1.ProvisionPhaseUnprovisioned
+	device.Status.VolumeGroup = nil
+	diskv1.DeviceAddedToVG.SetError(device, "", nil)
+	diskv1.DeviceAddedToVG.SetStatusBool(device, false)
+	diskv1.DeviceAddedToVG.Message(device, fmt.Sprintf("Device not in volume group %s", vgName))
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonUnprovisioned, "Removed device %s from volume group %s", device.Name, vgName)
+	return nil
+}
+
+// moveExtentsOffPV starts pvmove in background if it is not running yet, and
+// requeues the device to check it later.
+func (c *Controller) moveExtentsOffPV(device *diskv1.BlockDevice, devPath string, pv *lvm.PhysicalVolume) error {
+	moving, err := c.lvmManager.IsMoving(pv.VGName)
+	if err != nil {
+		return err
+	}
+	if !moving {
+		pvs, err := c.lvmManager.ListPVs(pv.VGName)
+		if err != nil {
+			return err
+		}
+		var free uint64
+		for _, other := range pvs {
+			if other.Name != pv.Name {
+				free += other.FreeBytes
+			}
+		}
+		if free < pv.UsedBytes {
+			return fmt.Errorf("not enough free space in volume group %s to move %d bytes off the device", pv.VGName, pv.UsedBytes)
+		}
+		logrus.Infof("Move extents of device %s to the other physical volumes of volume group %s", device.Name, pv.VGName)
+		if err := c.lvmManager.MovePV(devPath); err != nil {
+			return err
+		}
+	}
+	diskv1.DeviceAddedToVG.SetError(device, "", nil)
+	diskv1.DeviceAddedToVG.Message(device, fmt.Sprintf("Moving %d bytes off the device in volume group %s", pv.UsedBytes, pv.VGName))
+	c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+	return nil
+}
+
+func (c *Controller) updateVolumeGroupStatus(device *diskv1.BlockDevice) error {
+	vgName := device.Status.VolumeGroup.Name
+	vg, err := c.lvmManager.GetVG(vgName)
+	if err != nil {
+		return err
+	}
+	if vg == nil {
+		return fmt.Errorf("volume group %s not found", vgName)
+	}
+	device.Status.VolumeGroup = &diskv1.VolumeGroupStatus{
+		Name:      vg.Name,
+		SizeBytes: vg.SizeBytes,
+		FreeBytes: vg.FreeBytes,
+		UsedBytes: vg.SizeBytes - vg.FreeBytes,
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package blockdevice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/lvm"
+)
+
+// fakeLVMManager keeps the physical volumes and logical volume counts in
+// memory, and records the commands which would change them.
+type fakeLVMManager struct {
+	pvs      map[string]*lvm.PhysicalVolume
+	lvCounts map[string]int
+	moving   bool
+	commands []string
+}
+
+func (f *fakeLVMManager) GetPV(devPath string) (*lvm.PhysicalVolume, error) {
+	if pv, ok := f.pvs[devPath]; ok {
+		pvCpy := *pv
+		return &pvCpy, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeLVMManager) GetVG(vgName string) (*lvm.VolumeGroup, error) {
+	pvs, _ := f.ListPVs(vgName)
+	if len(pvs) == 0 {
+		return nil, nil
+	}
+	vg := &lvm.VolumeGroup{Name: vgName, PVCount: len(pvs), LVCount: f.lvCounts[vgName]}
+	for _, pv := range pvs {
+		vg.SizeBytes += pv.SizeBytes
+		vg.FreeBytes += pv.FreeBytes
+	}
+	return vg, nil
+}
+
+func (f *fakeLVMManager) ListPVs(vgName string) ([]*lvm.PhysicalVolume, error) {
+	var result []*lvm.PhysicalVolume
+	for _, pv := range f.pvs {
+		if pv.VGName == vgName {
+			result = append(result, pv)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeLVMManager) IsMoving(_ string) (bool, error) {
+	return f.moving, nil
+}
+
+func (f *fakeLVMManager) CreatePV(devPath string, wipe bool) error {
+	if wipe {
+		f.commands = append(f.commands, "wipefs "+devPath)
+	}
+	f.commands = append(f.commands, "pvcreate "+devPath)
+	f.pvs[devPath] = &lvm.PhysicalVolume{Name: devPath, SizeBytes: 100, FreeBytes: 100}
+	return nil
+}
+
+func (f *fakeLVMManager) ExtendVG(vgName, devPath string) error {
+	f.commands = append(f.commands, "vgextend "+vgName+" "+devPath)
+	f.pvs[devPath].VGName = vgName
+	return nil
+}
+
+func (f *fakeLVMManager) MovePV(devPath string) error {
+	f.commands = append(f.commands, "pvmove "+devPath)
+	f.moving = true
+	return nil
+}
+
+func (f *fakeLVMManager) ReduceVG(vgName, devPath string) error {
+	f.commands = append(f.commands, "vgreduce "+vgName+" "+devPath)
+	f.pvs[devPath].VGName = ""
+	return nil
+}
+
+func (f *fakeLVMManager) RemoveVG(vgName string) error {
+	f.commands = append(f.commands, "vgremove "+vgName)
+	for _, pv := range f.pvs {
+		if pv.VGName == vgName {
+			pv.VGName = ""
+		}
+	}
+	return nil
+}
+
+func (f *fakeLVMManager) RemovePV(devPath string) error {
+	f.commands = append(f.commands, "pvremove "+devPath)
+	delete(f.pvs, devPath)
+	return nil
+}
+
+func newLVMBlockDevice(vgName string) *diskv1.BlockDevice {
+	return &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Spec: diskv1.BlockDeviceSpec{
+			FileSystem:  &diskv1.FilesystemInfo{Provisioned: true},
+			Provisioner: &diskv1.ProvisionerInfo{LVM: &diskv1.LVMProvisionerInfo{VgName: vgName}},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+			DeviceStatus: diskv1.DeviceStatus{
+				FileSystem: &diskv1.FilesystemStatus{},
+			},
+		},
+	}
+}
+
+func Test_provisionDeviceToVG(t *testing.T) {
+	var testCases = []struct {
+		name           string
+		pvs            map[string]*lvm.PhysicalVolume
+		mutate         func(bd *diskv1.BlockDevice)
+		filesystem     *block.FileSystemInfo
+		expectErr      bool
+		expectCommands []string
+	}{
+		{
+			name:           "create volume group",
+			expectCommands: []string{"pvcreate /dev/sdb", "vgextend vg0 /dev/sdb"},
+		},
+		{
+			name: "extend volume group",
+			pvs: map[string]*lvm.PhysicalVolume{
+				"/dev/sda": {Name: "/dev/sda", VGName: "vg0", SizeBytes: 100, FreeBytes: 50},
+			},
+			expectCommands: []string{"pvcreate /dev/sdb", "vgextend vg0 /dev/sdb"},
+		},
+		{
+			name: "device is already in the volume group",
+			pvs: map[string]*lvm.PhysicalVolume{
+				"/dev/sdb": {Name: "/dev/sdb", VGName: "vg0", SizeBytes: 100, FreeBytes: 100},
+			},
+		},
+		{
+			name: "device is in another volume group",
+			pvs: map[string]*lvm.PhysicalVolume{
+				"/dev/sdb": {Name: "/dev/sdb", VGName: "vg1", SizeBytes: 100, FreeBytes: 100},
+			},
+			expectErr: true,
+		},
+		{
+			name: "device has a filesystem",
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Status.DeviceStatus.FileSystem.Type = "ext4"
+			},
+			expectErr: true,
+		},
+		{
+			name: "wipe the filesystem",
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Status.DeviceStatus.FileSystem.Type = "ext4"
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+			expectCommands: []string{"wipefs /dev/sdb", "pvcreate /dev/sdb", "vgextend vg0 /dev/sdb"},
+		},
+		{
+			name:       "device is mounted",
+			filesystem: &block.FileSystemInfo{MountPoint: "/mnt"},
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.pvs == nil {
+				tc.pvs = map[string]*lvm.PhysicalVolume{}
+			}
+			fakeLVM := &fakeLVMManager{pvs: tc.pvs}
+			c := &Controller{lvmManager: fakeLVM, recorder: &events.FakeRecorder{}}
+			bd := newLVMBlockDevice("vg0")
+			if tc.mutate != nil {
+				tc.mutate(bd)
+			}
+
+			err := c.provisionDeviceToVG(bd, "/dev/sdb", "vg0", tc.filesystem)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Nil(t, bd.Status.VolumeGroup)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectCommands, fakeLVM.commands)
+			assert.Equal(t, diskv1.ProvisionPhaseProvisioned, bd.Status.ProvisionPhase)
+			assert.True(t, diskv1.DeviceAddedToVG.IsTrue(bd))
+			require.NotNil(t, bd.Status.VolumeGroup)
+			assert.Equal(t, "vg0", bd.Status.VolumeGroup.Name)
+			assert.Equal(t, bd.Status.VolumeGroup.SizeBytes-bd.Status.VolumeGroup.FreeBytes, bd.Status.VolumeGroup.UsedBytes)
+		})
+	}
+}
+
+func Test_unprovisionDeviceFromVG(t *testing.T) {
+	fakeLVM := &fakeLVMManager{
+		pvs: map[string]*lvm.PhysicalVolume{
+			"/dev/sda": {Name: "/dev/sda", VGName: "vg0", SizeBytes: 100, FreeBytes: 60},
+			"/dev/sdb": {Name: "/dev/sdb", VGName: "vg0", SizeBytes: 100, FreeBytes: 50, UsedBytes: 50},
+		},
+		lvCounts: map[string]int{"vg0": 1},
+	}
+	bds := &fakeBlockDevices{}
+	recorder := &events.FakeRecorder{}
+	c := &Controller{lvmManager: fakeLVM, Blockdevices: bds, recorder: recorder}
+	bd := newLVMBlockDevice("vg0")
+	bd.Spec.FileSystem.Provisioned = false
+	bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+	bd.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+
+	// start moving the extents off the device
+	require.NoError(t, c.unprovisionDeviceFromVG(bd, "/dev/sdb"))
+	assert.Equal(t, []string{"pvmove /dev/sdb"}, fakeLVM.commands)
+	assert.Equal(t, diskv1.ProvisionPhaseUnprovisioning, bd.Status.ProvisionPhase)
+	assert.Contains(t, bds.enqueued, bd.Name)
+
+	// still moving
+	require.NoError(t, c.unprovisionDeviceFromVG(bd, "/dev/sdb"))
+	assert.Equal(t, []string{"pvmove /dev/sdb"}, fakeLVM.commands)
+
+	// moved
+	fakeLVM.moving = false
+	fakeLVM.pvs["/dev/sdb"].UsedBytes = 0
+	require.NoError(t, c.unprovisionDeviceFromVG(bd, "/dev/sdb"))
+	assert.Equal(t, []string{"pvmove /dev/sdb", "vgreduce vg0 /dev/sdb", "pvremove /dev/sdb"}, fakeLVM.commands)
+	assert.Equal(t, diskv1.ProvisionPhaseUnprovisioned, bd.Status.ProvisionPhase)
+	assert.Nil(t, bd.Status.VolumeGroup)
+	assert.Equal(t, string(corev1.ConditionFalse), diskv1.DeviceAddedToVG.GetStatus(bd))
+	assert.Equal(t, []string{"Normal Unprovisioned Removed device bd1 from volume group vg0"}, recorder.Events())
+
+	// the last device of a volume group with logical volumes
+	fakeLVM.commands = nil
+	bd.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+	assert.Error(t, c.unprovisionDeviceFromVG(bd, "/dev/sda"))
+	assert.Empty(t, fakeLVM.commands)
+
+	// the last device of an empty volume group
+	fakeLVM.lvCounts["vg0"] = 0
+	require.NoError(t, c.unprovisionDeviceFromVG(bd, "/dev/sda"))
+	assert.Equal(t, []string{"vgremove vg0", "pvremove /dev/sda"}, fakeLVM.commands)
+
+	// not enough free space to move the extents
+	fakeLVM.commands = nil
+	fakeLVM.pvs = map[string]*lvm.PhysicalVolume{
+		"/dev/sda": {Name: "/dev/sda", VGName: "vg0", SizeBytes: 100, FreeBytes: 10},
+		"/dev/sdb": {Name: "/dev/sdb", VGName: "vg0", SizeBytes: 100, FreeBytes: 50, UsedBytes: 50},
+	}
+	bd.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+	assert.Error(t, c.unprovisionDeviceFromVG(bd, "/dev/sdb"))
+	assert.Empty(t, fakeLVM.commands)
+}
@@ -0,0 +1,166 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/partition"
+)
+
+// checkRootDisk returns an error if formatting, mounting or wiping the device
+// would touch the OS. The root disk itself is never touched, and only the
+// partitions of it which are neither OS partitions nor mounted by others could
+// be provisioned, e.g. a free data partition next to the OS partitions.
+func (c *Controller) checkRootDisk(device *diskv1.BlockDevice, devPath string) error {
+	switch device.Status.DeviceStatus.Details.DeviceType {
+	case diskv1.DeviceTypeDisk:
+		disk := c.BlockInfo.GetDiskByDevPath(devPath)
+		if disk != nil && block.IsRootDisk(disk) {
+			return fmt.Errorf("device %s is the root disk, please provision its free partitions instead", devPath)
+		}
+	case diskv1.DeviceTypePart:
+		parentDevPath := device.Status.DeviceStatus.ParentDevice
+		if parentDevPath == "" {
+			var err error
+			if parentDevPath, err = block.GetParentDevName(devPath); err != nil {
+				return fmt.Errorf("failed to get parent devPath for %s: %w", device.Name, err)
+			}
+		}
+		part := c.BlockInfo.GetPartitionByDevPath(parentDevPath, devPath)
+		if part == nil {
+			return fmt.Errorf("partition %s is not found on device %s", devPath, parentDevPath)
+		}
+		if block.IsOSPartition(part) {
+			return fmt.Errorf("partition %s is an OS partition", devPath)
+		}
+		mountPoint := part.FileSystemInfo.MountPoint
+		if part.Disk != nil && block.IsRootDisk(part.Disk) && mountPoint != "" && mountPoint != c.extraDiskMountPoint(device) {
+			return fmt.Errorf("partition %s of the root disk is mounted at %s", devPath, mountPoint)
+		}
+	}
+	return nil
+}
+
+// getHolders lists the devices holding a device, it is replaced in tests
+var getHolders = block.GetHolders
+
+// checkChildPartitionsFree returns an error if wiping or partitioning the
+// device would destroy the data still in use on it, e.g. a partition
+// provisioned to an LVM volume group, which is in use but never mounted.
+func (c *Controller) checkChildPartitionsFree(device *diskv1.BlockDevice, devPath string) error {
+	parts, err := c.BlockdeviceCache.List(c.Namespace, labels.SelectorFromSet(map[string]string{
+		corev1.LabelHostname: c.NodeName,
+		ParentDeviceLabel:    device.Name,
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to list partitions of device %s: %w", device.Name, err)
+	}
+	for _, part := range parts {
+		if part.Status.ProvisionPhase != diskv1.ProvisionPhaseUnprovisioned || part.Status.VolumeGroup != nil ||
+			(part.Spec.FileSystem != nil && part.Spec.FileSystem.Provisioned) {
+			return fmt.Errorf("partition %s is not unprovisioned", part.Name)
+		}
+		if fs := part.Status.DeviceStatus.FileSystem; fs != nil && fs.MountPoint != "" {
+			return fmt.Errorf("partition %s is mounted at %s", part.Name, fs.MountPoint)
+		}
+	}
+	if holders := getHolders(devPath); len(holders) > 0 {
+		return fmt.Errorf("device %s is held by %s", devPath, strings.Join(holders, ", "))
+	}
+	return nil
+}
+
+// needPartition returns true if the partitions in spec are not created yet
+func needPartition(device *diskv1.BlockDevice) bool {
+	return len(device.Spec.Partitions) > 0 && !diskv1.DiskPartitioned.IsTrue(device)
+}
+
+// partitionDevice carves the disk into the partitions in spec, which are
+// discovered as block devices of type part by the scanner then. Only an
+// unprovisioned disk whose partitions are neither provisioned, mounted nor
+// held by other devices is partitioned.
+func (c *Controller) partitionDevice(device *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) error {
+	details := device.Status.DeviceStatus.Details
+	if details.DeviceType != diskv1.DeviceTypeDisk {
+		return fmt.Errorf("only disks could be partitioned")
+	}
+	if valueExists(details.DMUUID) {
+		return fmt.Errorf("partitioning a multipath device is not supported")
+	}
+	if device.Status.ProvisionPhase != diskv1.ProvisionPhaseUnprovisioned || device.Status.VolumeGroup != nil || device.Spec.FileSystem.Provisioned {
+		return fmt.Errorf("device is not unprovisioned")
+	}
+	if filesystem != nil && filesystem.MountPoint != "" {
+		return fmt.Errorf("device is mounted at %s", filesystem.MountPoint)
+	}
+	if err := c.checkRootDisk(device, devPath); err != nil {
+		return err
+	}
+	disk := c.BlockInfo.GetDiskByDevPath(devPath)
+	if disk == nil {
+		return fmt.Errorf("device %s is not found", devPath)
+	}
+	for _, part := range disk.Partitions {
+		if part.FileSystemInfo.MountPoint != "" {
+			return fmt.Errorf("partition /dev/%s is mounted at %s", part.Name, part.FileSystemInfo.MountPoint)
+		}
+	}
+	if err := c.checkChildPartitionsFree(device, devPath); err != nil {
+		return err
+	}
+	diskGUID := diskGUIDToKeep(device)
+	if diskGUID != "" && !partition.IsGUID(diskGUID) {
+		return fmt.Errorf("device is identified by %s, which cannot be kept as the GUID of the partition table", diskGUID)
+	}
+
+	if !c.semaphore.tryAcquire() {
+		logrus.Infof("Hit maximum concurrent count. Requeue device %s", device.Name)
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		return nil
+	}
+	defer c.semaphore.release()
+
+	partPaths, err := c.partitioner.Partition(devPath, diskGUID, disk.SizeBytes, device.Spec.Partitions)
+	if err != nil {
+		return err
+	}
+	// keep the device found by resolvePersistentDevPath, as forceFormat does
+	if diskGUID != "" {
+		device.Status.DeviceStatus.Details.PtUUID = diskGUID
+	}
+	device.Status.DeviceStatus.Partitioned = true
+	msg := fmt.Sprintf("Created partitions %s", strings.Join(partPaths, ", "))
+	diskv1.DiskPartitioned.SetError(device, "", nil)
+	diskv1.DiskPartitioned.SetStatusBool(device, true)
+	diskv1.DiskPartitioned.Message(device, msg)
+	logrus.Infof("Device %s is partitioned: %s", device.Name, msg)
+	c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonPartitioned, msg)
+	if c.scanner != nil {
+		c.scanner.Rescan()
+	}
+	return nil
+}
+
+// diskGUIDToKeep returns the identifier of the disk without a WWN, which has
+// to be kept as the GUID of the new partition table, so the name of the block
+// device generated by block.GenerateDiskGUID does not change.
+func diskGUIDToKeep(device *diskv1.BlockDevice) string {
+	details := device.Status.DeviceStatus.Details
+	if valueExists(details.WWN) {
+		return ""
+	}
+	if valueExists(details.UUID) {
+		return details.UUID
+	}
+	if valueExists(details.PtUUID) {
+		return details.PtUUID
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package blockdevice
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+func Test_checkRootDisk(t *testing.T) {
+	rootDisk := &block.Disk{Name: "nvme0n1"}
+	rootDisk.Partitions = []*block.Partition{
+		{Disk: rootDisk, Name: "nvme0n1p1", PartType: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"},
+		{Disk: rootDisk, Name: "nvme0n1p2", Label: "COS_STATE", FileSystemInfo: block.FileSystemInfo{MountPoint: "/run/initramfs/cos-state"}},
+		{Disk: rootDisk, Name: "nvme0n1p3", Label: "data"},
+		{Disk: rootDisk, Name: "nvme0n1p4", FileSystemInfo: block.FileSystemInfo{MountPoint: "/mnt/backup"}},
+		{Disk: rootDisk, Name: "nvme0n1p5", FileSystemInfo: block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/part5"}},
+	}
+	dataDisk := &block.Disk{Name: "sdb"}
+	tmpl, err := newMountPathTemplate(DefaultMountPathTemplate)
+	require.NoError(t, err)
+	c := &Controller{
+		BlockInfo:         &fakeBlockInfo{disks: []*block.Disk{rootDisk, dataDisk}},
+		mountPathTemplate: tmpl,
+	}
+
+	var testCases = []struct {
+		name       string
+		bdName     string
+		devPath    string
+		deviceType diskv1.BlockDeviceType
+		expectErr  bool
+	}{
+		{name: "root disk", devPath: "/dev/nvme0n1", deviceType: diskv1.DeviceTypeDisk, expectErr: true},
+		{name: "data disk", devPath: "/dev/sdb", deviceType: diskv1.DeviceTypeDisk},
+		{name: "EFI system partition", devPath: "/dev/nvme0n1p1", deviceType: diskv1.DeviceTypePart, expectErr: true},
+		{name: "OS partition", devPath: "/dev/nvme0n1p2", deviceType: diskv1.DeviceTypePart, expectErr: true},
+		{name: "free partition", devPath: "/dev/nvme0n1p3", deviceType: diskv1.DeviceTypePart},
+		{name: "partition mounted by others", devPath: "/dev/nvme0n1p4", deviceType: diskv1.DeviceTypePart, expectErr: true},
+		{name: "provisioned partition", bdName: "part5", devPath: "/dev/nvme0n1p5", deviceType: diskv1.DeviceTypePart},
+		{name: "missing partition", devPath: "/dev/nvme0n1p6", deviceType: diskv1.DeviceTypePart, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bd := &diskv1.BlockDevice{
+				ObjectMeta: metav1.ObjectMeta{Name: tc.bdName},
+				Spec:       diskv1.BlockDeviceSpec{FileSystem: &diskv1.FilesystemInfo{}},
+				Status: diskv1.BlockDeviceStatus{
+					DeviceStatus: diskv1.DeviceStatus{
+						Details: diskv1.DeviceDetails{DeviceType: tc.deviceType},
+					},
+				},
+			}
+			if tc.deviceType == diskv1.DeviceTypePart {
+				bd.Status.DeviceStatus.ParentDevice = "/dev/nvme0n1"
+			}
+			err := c.checkRootDisk(bd, tc.devPath)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// fakePartitioner records the partitioned disks, and returns the device paths
+// of the partitions.
+type fakePartitioner struct {
+	devPaths  []string
+	diskGUIDs []string
+}
+
+func (f *fakePartitioner) Partition(devPath, diskGUID string, _ uint64, partitions []diskv1.PartitionInfo) ([]string, error) {
+	f.devPaths = append(f.devPaths, devPath)
+	f.diskGUIDs = append(f.diskGUIDs, diskGUID)
+	var partPaths []string
+	for i := range partitions {
+		partPaths = append(partPaths, fmt.Sprintf("%s%d", devPath, i+1))
+	}
+	return partPaths, nil
+}
+
+// stubHolders replaces the holders of the devices by devPath for the test
+func stubHolders(t *testing.T, holders map[string][]string) {
+	orig := getHolders
+	getHolders = func(devPath string) []string {
+		return holders[devPath]
+	}
+	t.Cleanup(func() {
+		getHolders = orig
+	})
+}
+
+// newChildPartition returns an unprovisioned partition of the block device
+// bd1 on node1, changed by mutate.
+func newChildPartition(name string, mutate func(part *diskv1.BlockDevice)) *diskv1.BlockDevice {
+	part := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				corev1.LabelHostname: "node1",
+				ParentDeviceLabel:    "bd1",
+			},
+		},
+		Spec: diskv1.BlockDeviceSpec{FileSystem: &diskv1.FilesystemInfo{}},
+		Status: diskv1.BlockDeviceStatus{
+			ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+			DeviceStatus: diskv1.DeviceStatus{
+				Details:    diskv1.DeviceDetails{DeviceType: diskv1.DeviceTypePart},
+				FileSystem: &diskv1.FilesystemStatus{},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(part)
+	}
+	return part
+}
+
+func Test_partitionDevice(t *testing.T) {
+	holders := map[string][]string{}
+	stubHolders(t, holders)
+	disk := &block.Disk{Name: "sdb", SizeBytes: 100 << 30}
+	usedDisk := &block.Disk{Name: "sdc", SizeBytes: 100 << 30}
+	usedDisk.Partitions = []*block.Partition{{Disk: usedDisk, Name: "sdc1", FileSystemInfo: block.FileSystemInfo{MountPoint: "/mnt/data"}}}
+	partitioner := &fakePartitioner{}
+	cache := &fakeBlockDeviceCache{}
+	c := &Controller{
+		Namespace:        "longhorn-system",
+		NodeName:         "node1",
+		BlockInfo:        &fakeBlockInfo{disks: []*block.Disk{disk, usedDisk}},
+		Blockdevices:     &fakeBlockDevices{},
+		BlockdeviceCache: cache,
+		semaphore:        newSemaphore(1),
+		recorder:         &events.FakeRecorder{},
+		partitioner:      partitioner,
+	}
+	newBlockDevice := func() *diskv1.BlockDevice {
+		return &diskv1.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+			Spec: diskv1.BlockDeviceSpec{
+				FileSystem: &diskv1.FilesystemInfo{},
+				Partitions: []diskv1.PartitionInfo{{Name: "longhorn", Size: "60%"}, {Name: "cache", Size: "rest"}},
+			},
+			Status: diskv1.BlockDeviceStatus{
+				ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+				DeviceStatus: diskv1.DeviceStatus{
+					Details: diskv1.DeviceDetails{
+						DeviceType: diskv1.DeviceTypeDisk,
+						UUID:       "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e",
+					},
+				},
+			},
+		}
+	}
+
+	// partition the disk, keeping the filesystem UUID the block device is named after
+	bd := newBlockDevice()
+	require.True(t, needPartition(bd))
+	require.NoError(t, c.partitionDevice(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Equal(t, []string{"/dev/sdb"}, partitioner.devPaths)
+	assert.Equal(t, []string{"6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e"}, partitioner.diskGUIDs)
+	assert.Equal(t, "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e", bd.Status.DeviceStatus.Details.PtUUID)
+	assert.True(t, bd.Status.DeviceStatus.Partitioned)
+	assert.True(t, diskv1.DiskPartitioned.IsTrue(bd))
+	assert.False(t, needPartition(bd))
+	assert.True(t, c.semaphore.acquire())
+	c.semaphore.release()
+
+	// a disk with a mounted partition
+	bd = newBlockDevice()
+	assert.Error(t, c.partitionDevice(bd, "/dev/sdc", &block.FileSystemInfo{}))
+
+	// a provisioned disk
+	bd = newBlockDevice()
+	bd.Spec.FileSystem.Provisioned = true
+	assert.Error(t, c.partitionDevice(bd, "/dev/sdb", &block.FileSystemInfo{}))
+
+	// a disk with a partition provisioned to a volume group, which is not mounted
+	cache.bds = []*diskv1.BlockDevice{newChildPartition("bd1-part1", func(part *diskv1.BlockDevice) {
+		part.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+		part.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+	})}
+	bd = newBlockDevice()
+	assert.ErrorContains(t, c.partitionDevice(bd, "/dev/sdb", &block.FileSystemInfo{}), "not unprovisioned")
+	cache.bds = nil
+
+	// a disk held by a device-mapper device
+	holders["/dev/sdb"] = []string{"dm-0"}
+	bd = newBlockDevice()
+	assert.ErrorContains(t, c.partitionDevice(bd, "/dev/sdb", &block.FileSystemInfo{}), "held by dm-0")
+	delete(holders, "/dev/sdb")
+	assert.Len(t, partitioner.devPaths, 1)
+
+	// a disk with a WWN keeps its name anyway
+	bd = newBlockDevice()
+	bd.Status.DeviceStatus.Details.WWN = "0x5000c50015ac3bd9"
+	require.NoError(t, c.partitionDevice(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Equal(t, "", partitioner.diskGUIDs[1])
+
+	// a disk named after a filesystem UUID which is not a GUID
+	bd = newBlockDevice()
+	bd.Status.DeviceStatus.Details.UUID = "ABCD-1234"
+	assert.Error(t, c.partitionDevice(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Len(t, partitioner.devPaths, 2)
+}
@@ -0,0 +1,219 @@
+package blockdevice
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+// NodeLister gets the nodes, e.g. from the informer cache of the node
+type NodeLister interface {
+	Get(name string) (*corev1.Node, error)
+}
+
+// PolicyLister lists the DiskProvisionPolicies, e.g. from the controller cache
+type PolicyLister interface {
+	List(selector labels.Selector) ([]*diskv1.DiskProvisionPolicy, error)
+}
+
+// ProvisionPolicyMatcher selects the DiskProvisionPolicy applied to the disks
+// of the node.
+type ProvisionPolicyMatcher struct {
+	nodeName string
+	policies PolicyLister
+	nodes    NodeLister
+}
+
+func NewProvisionPolicyMatcher(nodeName string, policies PolicyLister, nodes NodeLister) *ProvisionPolicyMatcher {
+	return &ProvisionPolicyMatcher{
+		nodeName: nodeName,
+		policies: policies,
+		nodes:    nodes,
+	}
+}
+
+// NodePolicies returns the policies selecting the node, sorted by priority.
+func (m *ProvisionPolicyMatcher) NodePolicies() ([]*diskv1.DiskProvisionPolicy, error) {
+	policies, err := m.policies.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	node, err := m.nodes.Get(m.nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %w", m.nodeName, err)
+	}
+
+	var result []*diskv1.DiskProvisionPolicy
+	for _, policy := range policies {
+		if policy.DeletionTimestamp != nil {
+			continue
+		}
+		selected, err := policySelectsNode(policy, node.Labels)
+		if err != nil {
+			logrus.Warnf("Skip disk provision policy %s: %v", policy.Name, err)
+			continue
+		}
+		if selected {
+			result = append(result, policy)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Spec.Priority != result[j].Spec.Priority {
+			return result[i].Spec.Priority > result[j].Spec.Priority
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// matchProvisionPolicy returns the first of the sorted policies matching the disk
+func matchProvisionPolicy(policies []*diskv1.DiskProvisionPolicy, disk *block.Disk) *diskv1.DiskProvisionPolicy {
+	for _, policy := range policies {
+		matched, err := policyMatchesDisk(policy, disk)
+		if err != nil {
+			logrus.Warnf("Skip disk provision policy %s: %v", policy.Name, err)
+			continue
+		}
+		if matched {
+			logrus.Debugf("block device /dev/%s matches disk provision policy %s", disk.Name, policy.Name)
+			return policy
+		}
+	}
+	return nil
+}
+
+func policySelectsNode(policy *diskv1.DiskProvisionPolicy, nodeLabels map[string]string) (bool, error) {
+	if policy.Spec.NodeSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NodeSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid node selector: %w", err)
+	}
+	return selector.Matches(labels.Set(nodeLabels)), nil
+}
+
+// policyMatchesDisk returns true if the disk meets all the criteria set in the
+// disk selector of the policy.
+func policyMatchesDisk(policy *diskv1.DiskProvisionPolicy, disk *block.Disk) (bool, error) {
+	selector := policy.Spec.DiskSelector
+	if selector.MinSizeBytes > 0 && disk.SizeBytes < selector.MinSizeBytes {
+		return false, nil
+	}
+	if selector.MaxSizeBytes > 0 && disk.SizeBytes > selector.MaxSizeBytes {
+		return false, nil
+	}
+	if len(selector.DriveTypes) > 0 && !utils.MatchesIgnoredCase(selector.DriveTypes, disk.DriveType.String()) {
+		return false, nil
+	}
+	if len(selector.StorageControllers) > 0 && !utils.MatchesIgnoredCase(selector.StorageControllers, disk.StorageController.String()) {
+		return false, nil
+	}
+	if len(selector.WWNs) > 0 && !utils.MatchesIgnoredCase(selector.WWNs, disk.WWN) {
+		return false, nil
+	}
+	if matched, err := matchesRegex(selector.VendorRegex, disk.Vendor); !matched || err != nil {
+		return false, err
+	}
+	if matched, err := matchesRegex(selector.ModelRegex, disk.Model); !matched || err != nil {
+		return false, err
+	}
+	if len(selector.BusPaths) > 0 {
+		matched := false
+		for _, pattern := range selector.BusPaths {
+			ok, err := filepath.Match(pattern, disk.BusPath)
+			if err != nil {
+				return false, fmt.Errorf("invalid bus path pattern %q: %w", pattern, err)
+			}
+			matched = matched || ok
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchesRegex returns true if the pattern is empty or the value matches it
+func matchesRegex(pattern, value string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+	return re.MatchString(value), nil
+}
+
+// NeedsProvisionPolicy returns true if the policy is not applied to the block
+// device yet. Like auto-provisioning, a policy is only applied to the disk
+// neither provisioned nor formatted by NDM before.
+func NeedsProvisionPolicy(bd *diskv1.BlockDevice, policy *diskv1.DiskProvisionPolicy) bool {
+	if policy == nil || bd.Status.ProvisionPolicy != "" {
+		return false
+	}
+	if bd.Spec.FileSystem != nil && bd.Spec.FileSystem.Provisioned {
+		return false
+	}
+	fs := bd.Status.DeviceStatus.FileSystem
+	return fs == nil || fs.LastFormattedAt == nil
+}
+
+// ApplyProvisionPolicy records the policy in the status of the block device,
+// and applies its action to the spec.
+func ApplyProvisionPolicy(bd *diskv1.BlockDevice, policy *diskv1.DiskProvisionPolicy) {
+	bd.Status.ProvisionPolicy = policy.Name
+	if bd.Spec.FileSystem == nil {
+		bd.Spec.FileSystem = &diskv1.FilesystemInfo{}
+	}
+	action := policy.Spec.Action
+	if action.FileSystemType != "" {
+		bd.Spec.FileSystem.Type = action.FileSystemType
+	}
+	if len(action.Tags) > 0 {
+		bd.Spec.Tags = action.Tags
+	}
+	// a disk could be formatted without being provisioned, e.g. to be
+	// provisioned by hand later
+	if action.ForceFormatted {
+		bd.Spec.FileSystem.ForceFormatted = true
+	}
+	if action.Provision {
+		bd.Spec.FileSystem.Provisioned = true
+	}
+}
+
+// RegisterNodeLabelsHandler wakes up the scanner to apply the provision
+// policies again once the labels of the node change, since the node selectors
+// of the policies match them.
+func RegisterNodeLabelsHandler(informer cache.SharedIndexInformer, scanner *Scanner) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, newNode := oldObj.(*corev1.Node), newObj.(*corev1.Node)
+			if reflect.DeepEqual(oldNode.Labels, newNode.Labels) {
+				return
+			}
+			utils.CallerWithCondLock(scanner.Cond, func() any {
+				logrus.Infof("Wake up scanner for the changed labels of node %s", newNode.Name)
+				scanner.Cond.Signal()
+				return nil
+			})
+		},
+	})
+}
@@ -0,0 +1,161 @@
+package blockdevice
+
+import (
+	"testing"
+
+	ghwblock "github.com/jaypipes/ghw/pkg/block"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+)
+
+type fakePolicyCache struct {
+	ctldiskv1.DiskProvisionPolicyCache
+	policies []*diskv1.DiskProvisionPolicy
+}
+
+func (f *fakePolicyCache) List(_ labels.Selector) ([]*diskv1.DiskProvisionPolicy, error) {
+	return f.policies, nil
+}
+
+type fakeKubeNodes struct {
+	labels map[string]string
+}
+
+func (f *fakeKubeNodes) Get(name string) (*corev1.Node, error) {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: f.labels}}, nil
+}
+
+func newPolicy(name string, priority int32, selector diskv1.DiskSelector) *diskv1.DiskProvisionPolicy {
+	return &diskv1.DiskProvisionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: diskv1.DiskProvisionPolicySpec{
+			DiskSelector: selector,
+			Priority:     priority,
+			Action:       diskv1.DiskProvisionAction{Provision: true},
+		},
+	}
+}
+
+func Test_policyMatchesDisk(t *testing.T) {
+	disk := &block.Disk{
+		Name:              "sdb",
+		SizeBytes:         500 << 30,
+		DriveType:         ghwblock.DRIVE_TYPE_SSD,
+		StorageController: ghwblock.STORAGE_CONTROLLER_SCSI,
+		Vendor:            "ATA",
+		Model:             "Samsung SSD 870",
+		WWN:               "0x5002538e4095a5b2",
+		BusPath:           "pci-0000:00:1f.2-ata-2",
+	}
+	var testCases = []struct {
+		name      string
+		selector  diskv1.DiskSelector
+		expected  bool
+		expectErr bool
+	}{
+		{name: "empty selector", expected: true},
+		{name: "size in range", selector: diskv1.DiskSelector{MinSizeBytes: 100 << 30, MaxSizeBytes: 1 << 40}, expected: true},
+		{name: "size too small", selector: diskv1.DiskSelector{MinSizeBytes: 1 << 40}},
+		{name: "size too large", selector: diskv1.DiskSelector{MaxSizeBytes: 100 << 30}},
+		{name: "drive type", selector: diskv1.DiskSelector{DriveTypes: []string{"HDD", "ssd"}}, expected: true},
+		{name: "another drive type", selector: diskv1.DiskSelector{DriveTypes: []string{"HDD"}}},
+		{name: "storage controller", selector: diskv1.DiskSelector{StorageControllers: []string{"SCSI"}}, expected: true},
+		{name: "another storage controller", selector: diskv1.DiskSelector{StorageControllers: []string{"NVMe"}}},
+		{name: "vendor and model", selector: diskv1.DiskSelector{VendorRegex: "^ATA$", ModelRegex: "^Samsung SSD 8[0-9]0"}, expected: true},
+		{name: "another model", selector: diskv1.DiskSelector{ModelRegex: "^INTEL"}},
+		{name: "invalid regex", selector: diskv1.DiskSelector{ModelRegex: "Samsung ("}, expectErr: true},
+		{name: "WWN", selector: diskv1.DiskSelector{WWNs: []string{"0x5002538E4095A5B2"}}, expected: true},
+		{name: "another WWN", selector: diskv1.DiskSelector{WWNs: []string{"0x5000c50015ac3bd9"}}},
+		{name: "bus path", selector: diskv1.DiskSelector{BusPaths: []string{"pci-0000:00:1f.2-ata-*"}}, expected: true},
+		{name: "another bus path", selector: diskv1.DiskSelector{BusPaths: []string{"pci-0000:3b:00.0-nvme-*"}}},
+		{name: "all criteria met", selector: diskv1.DiskSelector{DriveTypes: []string{"SSD"}, BusPaths: []string{"*-ata-*"}}, expected: true},
+		{name: "one criterion not met", selector: diskv1.DiskSelector{DriveTypes: []string{"SSD"}, BusPaths: []string{"*-nvme-*"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matched, err := policyMatchesDisk(newPolicy("policy", 0, tc.selector), disk)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, matched)
+		})
+	}
+}
+
+func Test_provisionPolicyMatcher(t *testing.T) {
+	ssdOnly := newPolicy("ssd", 0, diskv1.DiskSelector{DriveTypes: []string{"SSD"}})
+	storageNodes := newPolicy("storage-nodes", 10, diskv1.DiskSelector{})
+	storageNodes.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"node-role/storage": "true"}}
+	low := newPolicy("all", -1, diskv1.DiskSelector{})
+	m := NewProvisionPolicyMatcher("node1",
+		&fakePolicyCache{policies: []*diskv1.DiskProvisionPolicy{low, ssdOnly, storageNodes}},
+		&fakeKubeNodes{labels: map[string]string{"node-role/storage": "true"}},
+	)
+
+	policies, err := m.NodePolicies()
+	require.NoError(t, err)
+	assert.Equal(t, []*diskv1.DiskProvisionPolicy{storageNodes, ssdOnly, low}, policies)
+	assert.Equal(t, storageNodes, matchProvisionPolicy(policies, &block.Disk{Name: "sdb"}))
+
+	m.nodes = &fakeKubeNodes{}
+	policies, err = m.NodePolicies()
+	require.NoError(t, err)
+	assert.Equal(t, ssdOnly, matchProvisionPolicy(policies, &block.Disk{Name: "sdb", DriveType: ghwblock.DRIVE_TYPE_SSD}))
+	assert.Equal(t, low, matchProvisionPolicy(policies, &block.Disk{Name: "sdc", DriveType: ghwblock.DRIVE_TYPE_HDD}))
+}
+
+func Test_applyProvisionPolicy(t *testing.T) {
+	policy := newPolicy("ssd", 0, diskv1.DiskSelector{})
+	policy.Spec.Action = diskv1.DiskProvisionAction{
+		Provision:      true,
+		ForceFormatted: true,
+		FileSystemType: "xfs",
+		Tags:           []string{"ssd"},
+	}
+	bd := GetDiskBlockDevice(&block.Disk{Name: "sdb", WWN: "0x5002538e4095a5b2"}, "node1", "longhorn-system")
+	assert.False(t, NeedsProvisionPolicy(bd, nil))
+	require.True(t, NeedsProvisionPolicy(bd, policy))
+
+	ApplyProvisionPolicy(bd, policy)
+	assert.Equal(t, "ssd", bd.Status.ProvisionPolicy)
+	assert.Equal(t, diskv1.FilesystemInfo{Provisioned: true, ForceFormatted: true, Type: "xfs"}, *bd.Spec.FileSystem)
+	assert.Equal(t, []string{"ssd"}, bd.Spec.Tags)
+	// a policy is applied only once
+	assert.False(t, NeedsProvisionPolicy(bd, policy))
+
+	bd = GetDiskBlockDevice(&block.Disk{Name: "sdb", WWN: "0x5002538e4095a5b2"}, "node1", "longhorn-system")
+	bd.Status.DeviceStatus.FileSystem.LastFormattedAt = &metav1.Time{}
+	assert.False(t, NeedsProvisionPolicy(bd, policy))
+	// formatted without being provisioned
+	policy.Spec.Action = diskv1.DiskProvisionAction{ForceFormatted: true}
+	bd = GetDiskBlockDevice(&block.Disk{Name: "sdb", WWN: "0x5002538e4095a5b2"}, "node1", "longhorn-system")
+	ApplyProvisionPolicy(bd, policy)
+	assert.Equal(t, diskv1.FilesystemInfo{ForceFormatted: true}, *bd.Spec.FileSystem)
+}
+
+func Test_collectAllDevicesWithProvisionPolicy(t *testing.T) {
+	info := &fakeBlockInfo{disks: []*block.Disk{
+		{Name: "sda", WWN: "0x5000c50015ac3bd9", DriveType: ghwblock.DRIVE_TYPE_HDD},
+		{Name: "sdb", WWN: "0x5002538e4095a5b2", DriveType: ghwblock.DRIVE_TYPE_SSD},
+	}}
+	s := newTestScanner(info, 0)
+	policy := newPolicy("ssd", 0, diskv1.DiskSelector{DriveTypes: []string{"SSD"}})
+	s.PolicyMatcher = NewProvisionPolicyMatcher("node1",
+		&fakePolicyCache{policies: []*diskv1.DiskProvisionPolicy{policy}}, &fakeKubeNodes{})
+
+	devices := s.collectAllDevices()
+	require.Len(t, devices, 2)
+	assert.Nil(t, devices[0].Policy)
+	assert.Equal(t, policy, devices[1].Policy)
+	assert.False(t, devices[1].AutoProvisioned)
+}
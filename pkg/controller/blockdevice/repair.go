@@ -0,0 +1,143 @@
+package blockdevice
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+// needCheckFileSystem returns true if the check requested in spec is not run
+// yet, or its result has to be cleared since the request is removed.
+func needCheckFileSystem(device *diskv1.BlockDevice) bool {
+	mode := device.Spec.FileSystem.Repair
+	check := device.Status.DeviceStatus.FileSystem.Check
+	if mode == "" {
+		return check != nil
+	}
+	return check == nil || check.Mode != mode
+}
+
+// fileSystemCheckRetryInterval is the interval to retry a requested check,
+// which could not run yet, e.g. the filesystem is still mounted
+const fileSystemCheckRetryInterval = time.Minute
+
+// onFileSystemCheck runs the check requested in spec.fileSystem.repair once,
+// which is the way out of a corrupted filesystem besides formatting it. The
+// result is cleared once spec.fileSystem.repair is removed, so the filesystem
+// could be checked again. It returns false if the check could not run yet, so
+// the other operations go on, e.g. unprovisioning the device to unmount it,
+// and the check is retried later.
+func (c *Controller) onFileSystemCheck(device *diskv1.BlockDevice) (*diskv1.BlockDevice, bool, error) {
+	deviceCpy := device.DeepCopy()
+	mode := device.Spec.FileSystem.Repair
+	if mode == "" {
+		deviceCpy.Status.DeviceStatus.FileSystem.Check = nil
+		bd, err := c.Blockdevices.Update(deviceCpy)
+		return bd, true, err
+	}
+	devPath, err := resolvePersistentDevPath(device)
+	if err == nil && devPath == "" {
+		err = fmt.Errorf("failed to resolve persistent dev path for block device %s", device.Name)
+	}
+	if err == nil {
+		err = c.checkFileSystem(deviceCpy, devPath, mode)
+	}
+	if err != nil {
+		// the check is not finished, since the checker has not run
+		err := fmt.Errorf("failed to check filesystem of device %s: %w", device.Name, err)
+		logrus.Error(err)
+		c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonCheckFailed, err.Error())
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, fileSystemCheckRetryInterval)
+		return nil, false, nil
+	}
+	if !reflect.DeepEqual(device, deviceCpy) {
+		logrus.Debugf("Update block device %s for new filesystem check state", device.Name)
+		bd, err := c.Blockdevices.Update(deviceCpy)
+		return bd, true, err
+	}
+	return nil, true, nil
+}
+
+// checkFileSystem checks the unmounted filesystem with e2fsck or xfs_repair,
+// repairing it in the auto mode, and clears the corrupted flag only if the
+// check passes, so the device is mounted again. The result is stored in status
+// once the checker has run, and an error is returned if it cannot run yet.
+func (c *Controller) checkFileSystem(device *diskv1.BlockDevice, devPath string, mode diskv1.FilesystemRepairMode) error {
+	if isLVMDevice(device) || isLonghornBlockDisk(device) {
+		return fmt.Errorf("device has no filesystem managed by NDM")
+	}
+	if device.Status.DeviceStatus.Partitioned {
+		return fmt.Errorf("partitioned device has no filesystem, please check its partitions instead")
+	}
+	if err := c.checkRootDisk(device, devPath); err != nil {
+		return err
+	}
+	if device.Status.DeviceStatus.FileSystem.Encrypted {
+		if err := c.openEncryptedDevice(device, devPath); err != nil {
+			return err
+		}
+	}
+	fsDevPath := fileSystemDevPath(device, devPath)
+	fsType := fileSystemType(device)
+	if filesystem := c.BlockInfo.GetFileSystemInfoByDevPath(fsDevPath); filesystem != nil {
+		if filesystem.MountPoint != "" {
+			return fmt.Errorf("device is mounted at %s, please unprovision it first", filesystem.MountPoint)
+		}
+		// the filesystem on the device is checked, even if the type in spec
+		// differs from it
+		if filesystem.Type != "" {
+			fsType = filesystem.Type
+		}
+	}
+	if !utils.IsSupportedFileSystem(fsType) {
+		return fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+
+	if !c.semaphore.tryAcquire() {
+		logrus.Infof("Hit maximum concurrent count. Requeue device %s", device.Name)
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		return nil
+	}
+	defer c.semaphore.release()
+
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonChecking, "Checking %s filesystem of device %s in mode %s", fsType, devPath, mode)
+	result, err := c.fsChecker.Check(fsDevPath, fsType, mode)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to check filesystem of device %s in mode %s: %v", devPath, mode, err)
+		logrus.Error(msg)
+		c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonCheckFailed, msg)
+		device.Status.DeviceStatus.FileSystem.Check = &diskv1.FilesystemCheckStatus{
+			Mode:      mode,
+			Message:   msg,
+			CheckedAt: &metav1.Time{Time: time.Now()},
+		}
+		return nil
+	}
+	exitCode := int32(result.ExitCode)
+	device.Status.DeviceStatus.FileSystem.Check = &diskv1.FilesystemCheckStatus{
+		Mode:      mode,
+		Passed:    result.Passed,
+		ExitCode:  &exitCode,
+		Summary:   result.Summary,
+		CheckedAt: &metav1.Time{Time: time.Now()},
+	}
+	if !result.Passed {
+		msg := fmt.Sprintf("Filesystem of device %s did not pass the check in mode %s, exit code %d", devPath, mode, result.ExitCode)
+		logrus.Warn(msg)
+		c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonCheckFailed, msg)
+		return nil
+	}
+	msg := fmt.Sprintf("Filesystem of device %s passed the check in mode %s, exit code %d", devPath, mode, result.ExitCode)
+	logrus.Info(msg)
+	c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonChecked, msg)
+	device.Status.DeviceStatus.FileSystem.Corrupted = false
+	return nil
+}
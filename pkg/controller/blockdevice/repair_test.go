@@ -0,0 +1,162 @@
+package blockdevice
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/fsck"
+)
+
+// fakeChecker records the checked filesystems, and replies the result or
+// the error
+type fakeChecker struct {
+	result  fsck.Result
+	err     error
+	checked []string
+}
+
+func (f *fakeChecker) Check(devPath, fsType string, mode diskv1.FilesystemRepairMode) (*fsck.Result, error) {
+	f.checked = append(f.checked, devPath+":"+fsType+":"+string(mode))
+	if f.err != nil {
+		return nil, f.err
+	}
+	result := f.result
+	return &result, nil
+}
+
+func Test_needCheckFileSystem(t *testing.T) {
+	newBlockDevice := func(mode diskv1.FilesystemRepairMode, check *diskv1.FilesystemCheckStatus) *diskv1.BlockDevice {
+		return &diskv1.BlockDevice{
+			Spec: diskv1.BlockDeviceSpec{FileSystem: &diskv1.FilesystemInfo{Repair: mode}},
+			Status: diskv1.BlockDeviceStatus{
+				DeviceStatus: diskv1.DeviceStatus{FileSystem: &diskv1.FilesystemStatus{Check: check}},
+			},
+		}
+	}
+	checked := &diskv1.FilesystemCheckStatus{Mode: diskv1.FilesystemRepairReadOnlyCheck}
+
+	assert.False(t, needCheckFileSystem(newBlockDevice("", nil)))
+	assert.True(t, needCheckFileSystem(newBlockDevice(diskv1.FilesystemRepairReadOnlyCheck, nil)))
+	assert.False(t, needCheckFileSystem(newBlockDevice(diskv1.FilesystemRepairReadOnlyCheck, checked)))
+	// checked again in another mode
+	assert.True(t, needCheckFileSystem(newBlockDevice(diskv1.FilesystemRepairAuto, checked)))
+	// the result is cleared once the request is removed
+	assert.True(t, needCheckFileSystem(newBlockDevice("", checked)))
+}
+
+func Test_checkFileSystem(t *testing.T) {
+	checker := &fakeChecker{}
+	recorder := &events.FakeRecorder{}
+	c := &Controller{
+		Blockdevices: &fakeBlockDevices{},
+		BlockInfo:    &fakeBlockInfo{},
+		semaphore:    newSemaphore(1),
+		recorder:     recorder,
+		fsChecker:    checker,
+	}
+	newBlockDevice := func(mode diskv1.FilesystemRepairMode) *diskv1.BlockDevice {
+		return &diskv1.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+			Spec: diskv1.BlockDeviceSpec{
+				FileSystem: &diskv1.FilesystemInfo{Provisioned: true, Type: "xfs", Repair: mode},
+			},
+			Status: diskv1.BlockDeviceStatus{
+				ProvisionPhase: diskv1.ProvisionPhaseProvisioned,
+				DeviceStatus: diskv1.DeviceStatus{
+					FileSystem: &diskv1.FilesystemStatus{Corrupted: true},
+				},
+			},
+		}
+	}
+
+	// the corrupted flag is kept if the errors are only reported
+	checker.result = fsck.Result{ExitCode: 1, Summary: "would have cleared inode 131"}
+	bd := newBlockDevice(diskv1.FilesystemRepairReadOnlyCheck)
+	require.NoError(t, c.checkFileSystem(bd, "/dev/sdb", diskv1.FilesystemRepairReadOnlyCheck))
+	check := bd.Status.DeviceStatus.FileSystem.Check
+	require.NotNil(t, check)
+	assert.Equal(t, diskv1.FilesystemRepairReadOnlyCheck, check.Mode)
+	assert.False(t, check.Passed)
+	assert.Equal(t, int32(1), *check.ExitCode)
+	assert.Equal(t, "would have cleared inode 131", check.Summary)
+	assert.True(t, bd.Status.DeviceStatus.FileSystem.Corrupted)
+	assert.False(t, needCheckFileSystem(bd))
+
+	// cleared once the filesystem is repaired
+	checker.result = fsck.Result{Passed: true, Summary: "done"}
+	bd.Spec.FileSystem.Repair = diskv1.FilesystemRepairAuto
+	assert.True(t, needCheckFileSystem(bd))
+	require.NoError(t, c.checkFileSystem(bd, "/dev/sdb", diskv1.FilesystemRepairAuto))
+	assert.True(t, bd.Status.DeviceStatus.FileSystem.Check.Passed)
+	assert.False(t, bd.Status.DeviceStatus.FileSystem.Corrupted)
+
+	assert.Equal(t, []string{"/dev/sdb:xfs:readonly-check", "/dev/sdb:xfs:auto"}, checker.checked)
+	assert.Equal(t, []string{
+		"Normal Checking Checking xfs filesystem of device /dev/sdb in mode readonly-check",
+		"Warning CheckFailed Filesystem of device /dev/sdb did not pass the check in mode readonly-check, exit code 1",
+		"Normal Checking Checking xfs filesystem of device /dev/sdb in mode auto",
+		"Normal Checked Filesystem of device /dev/sdb passed the check in mode auto, exit code 0",
+	}, recorder.Events())
+
+	// a block disk has no filesystem to check
+	bd = newBlockDevice(diskv1.FilesystemRepairAuto)
+	bd.Spec.Provisioner = &diskv1.ProvisionerInfo{Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock}}
+	assert.Error(t, c.checkFileSystem(bd, "/dev/sdb", diskv1.FilesystemRepairAuto))
+	assert.Nil(t, bd.Status.DeviceStatus.FileSystem.Check)
+	assert.Len(t, checker.checked, 2)
+
+	// the check is finished once the checker has run, even if it fails
+	checker.err = errors.New("xfs_repair: not found")
+	bd = newBlockDevice(diskv1.FilesystemRepairAuto)
+	require.NoError(t, c.checkFileSystem(bd, "/dev/sdb", diskv1.FilesystemRepairAuto))
+	check = bd.Status.DeviceStatus.FileSystem.Check
+	require.NotNil(t, check)
+	assert.False(t, check.Passed)
+	assert.Contains(t, check.Message, "xfs_repair: not found")
+	assert.True(t, bd.Status.DeviceStatus.FileSystem.Corrupted)
+	assert.False(t, needCheckFileSystem(bd))
+}
+
+func Test_onFileSystemCheckRetried(t *testing.T) {
+	checker := &fakeChecker{}
+	recorder := &events.FakeRecorder{}
+	blockdevices := &fakeBlockDevices{}
+	c := &Controller{
+		Namespace:    "longhorn-system",
+		Blockdevices: blockdevices,
+		BlockInfo:    &fakeBlockInfo{},
+		semaphore:    newSemaphore(1),
+		recorder:     recorder,
+		fsChecker:    checker,
+	}
+	// the device cannot be found, since it has no identifier
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Spec: diskv1.BlockDeviceSpec{
+			FileSystem: &diskv1.FilesystemInfo{Type: "xfs", Repair: diskv1.FilesystemRepairAuto},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			DeviceStatus: diskv1.DeviceStatus{
+				Details:    diskv1.DeviceDetails{DeviceType: diskv1.DeviceTypeDisk},
+				FileSystem: &diskv1.FilesystemStatus{},
+			},
+		},
+	}
+
+	updated, handled, err := c.onFileSystemCheck(bd)
+	require.NoError(t, err)
+	assert.False(t, handled)
+	assert.Nil(t, updated)
+	assert.Nil(t, bd.Status.DeviceStatus.FileSystem.Check)
+	assert.True(t, needCheckFileSystem(bd))
+	assert.Equal(t, fileSystemCheckRetryInterval, blockdevices.enqueued["bd1"])
+	assert.Empty(t, checker.checked)
+	require.Len(t, recorder.Events(), 1)
+	assert.Contains(t, recorder.Events()[0], "Warning CheckFailed")
+}
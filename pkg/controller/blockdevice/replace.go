@@ -0,0 +1,136 @@
+package blockdevice
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/strings/slices"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+// needTakeOver returns true if the device replaces another one whose tags and
+// provisioning are not taken over yet.
+func needTakeOver(device *diskv1.BlockDevice) bool {
+	return device.Spec.Replaces != "" && diskv1.DeviceReplaced.GetStatus(device) == ""
+}
+
+// needRemoveReplaced returns true if the device replaces another one which is
+// not removed yet, once the device is provisioned as the replaced one was.
+func needRemoveReplaced(device *diskv1.BlockDevice) bool {
+	if device.Spec.Replaces == "" || diskv1.DeviceReplaced.GetStatus(device) == "" || diskv1.DeviceReplaced.IsTrue(device) {
+		return false
+	}
+	return !device.Spec.FileSystem.Provisioned || device.Status.ProvisionPhase == diskv1.ProvisionPhaseProvisioned
+}
+
+// takeOverReplacedDevice copies the tags and the provisioning of the replaced
+// device, the device is formatted and provisioned as the replaced one then. The
+// device of an encrypted one is refused if it is formatted already, since it
+// would never be formatted again to be encrypted.
+func (c *Controller) takeOverReplacedDevice(device *diskv1.BlockDevice) error {
+	replaced, err := c.BlockdeviceCache.Get(c.Namespace, device.Spec.Replaces)
+	if err != nil {
+		return fmt.Errorf("failed to get replaced block device %s: %w", device.Spec.Replaces, err)
+	}
+	if replaced.Spec.NodeName != c.NodeName || replaced.Status.State != diskv1.BlockDeviceInactive {
+		return fmt.Errorf("replaced block device %s is not an inactive device of node %s", replaced.Name, c.NodeName)
+	}
+
+	if fs := replaced.Spec.FileSystem; fs != nil && fs.Encryption != nil {
+		if status := device.Status.DeviceStatus.FileSystem; status != nil && (status.LastFormattedAt != nil || status.Encrypted) {
+			return fmt.Errorf("replaced block device %s is encrypted, but block device %s is formatted already, please wipe it first", replaced.Name, device.Name)
+		}
+	}
+
+	device.Spec.Tags = append([]string(nil), replaced.Spec.Tags...)
+	device.Spec.Provisioner = replaced.Spec.Provisioner.DeepCopy()
+	if fs := replaced.Spec.FileSystem; fs != nil {
+		device.Spec.FileSystem.Provisioned = fs.Provisioned
+		// an encrypted device is formatted to be encrypted, even if it is not
+		// provisioned
+		device.Spec.FileSystem.ForceFormatted = fs.Provisioned || fs.Encryption != nil
+		device.Spec.FileSystem.Type = fs.Type
+		device.Spec.FileSystem.MountOptions = append([]string(nil), fs.MountOptions...)
+		device.Spec.FileSystem.Encryption = fs.Encryption.DeepCopy()
+	}
+	msg := fmt.Sprintf("Took over the tags and provisioning of block device %s", replaced.Name)
+	diskv1.DeviceReplaced.SetError(device, "", nil)
+	diskv1.DeviceReplaced.SetStatusBool(device, false)
+	diskv1.DeviceReplaced.Message(device, msg)
+	logrus.Infof("Device %s replaces block device %s, tags: %v, provisioned: %v",
+		device.Name, replaced.Name, device.Spec.Tags, device.Spec.FileSystem.Provisioned)
+	c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonReplacing, msg)
+	return nil
+}
+
+// removeReplacedDevice removes the disk of the replaced device from the
+// longhorn node, and deletes the replaced device then.
+func (c *Controller) removeReplacedDevice(device *diskv1.BlockDevice) error {
+	replacedName := device.Spec.Replaces
+	removed, err := c.removeReplacedDisk(device)
+	if err != nil || !removed {
+		return err
+	}
+	if err := c.Blockdevices.Delete(c.Namespace, replacedName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	msg := fmt.Sprintf("Replaced block device %s", replacedName)
+	diskv1.DeviceReplaced.SetError(device, "", nil)
+	diskv1.DeviceReplaced.SetStatusBool(device, true)
+	diskv1.DeviceReplaced.Message(device, msg)
+	logrus.Infof("Device %s replaced block device %s", device.Name, replacedName)
+	c.recorder.Event(device, corev1.EventTypeNormal, events.ReasonReplaced, msg)
+	return nil
+}
+
+// removeReplacedDisk evicts the replicas from the disk of the replaced device,
+// and removes the disk from the longhorn node once Longhorn reports no replicas
+// on it. It returns true if the disk is not in the longhorn node anymore.
+func (c *Controller) removeReplacedDisk(device *diskv1.BlockDevice) (bool, error) {
+	replacedName := device.Spec.Replaces
+	node, err := c.Nodes.Get(c.Namespace, c.NodeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	disk, ok := node.Spec.Disks[replacedName]
+	if !ok {
+		return true, nil
+	}
+
+	if !slices.Contains(disk.Tags, utils.DiskRemoveTag) {
+		logrus.Infof("Evict replicas from disk of replaced block device %s", replacedName)
+		disk.AllowScheduling = false
+		disk.EvictionRequested = true
+		disk.Tags = append(disk.Tags, utils.DiskRemoveTag)
+		nodeCpy := node.DeepCopy()
+		nodeCpy.Spec.Disks[replacedName] = disk
+		if _, err := c.Nodes.Update(nodeCpy); err != nil {
+			return false, err
+		}
+		diskv1.DeviceReplaced.Message(device, fmt.Sprintf("Evicting replicas from the disk of block device %s", replacedName))
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		return false, nil
+	}
+	if status, ok := node.Status.DiskStatus[replacedName]; !ok || len(status.ScheduledReplica) > 0 {
+		logrus.Debugf("Replicas are still being evicted from disk of replaced block device %s", replacedName)
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		return false, nil
+	}
+
+	nodeCpy := node.DeepCopy()
+	delete(nodeCpy.Spec.Disks, replacedName)
+	if _, err := c.Nodes.Update(nodeCpy); err != nil {
+		return false, err
+	}
+	c.recorder.Eventf(node, corev1.EventTypeNormal, events.ReasonReplaced, "Replaced disk of block device %s with block device %s", replacedName, device.Name)
+	return true, nil
+}
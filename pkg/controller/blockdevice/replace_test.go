@@ -0,0 +1,198 @@
+package blockdevice
+
+import (
+	"testing"
+
+	longhornv1 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+// fakeBlockDeviceCache only implements Get and List over a fixed set of block
+// devices.
+type fakeBlockDeviceCache struct {
+	ctldiskv1.BlockDeviceCache
+	bds []*diskv1.BlockDevice
+}
+
+func (f *fakeBlockDeviceCache) Get(_, name string) (*diskv1.BlockDevice, error) {
+	for _, bd := range f.bds {
+		if bd.Name == name {
+			return bd, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "harvesterhci.io", Resource: "blockdevices"}, name)
+}
+
+func (f *fakeBlockDeviceCache) List(_ string, selector labels.Selector) ([]*diskv1.BlockDevice, error) {
+	var bds []*diskv1.BlockDevice
+	for _, bd := range f.bds {
+		if selector.Matches(labels.Set(bd.Labels)) {
+			bds = append(bds, bd)
+		}
+	}
+	return bds, nil
+}
+
+func Test_replaceDevice(t *testing.T) {
+	replaced := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "old-bd"},
+		Spec: diskv1.BlockDeviceSpec{
+			NodeName: "node1",
+			Tags:     []string{"ssd"},
+			FileSystem: &diskv1.FilesystemInfo{
+				Provisioned:  true,
+				Type:         "xfs",
+				MountOptions: []string{"noatime"},
+			},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			State:          diskv1.BlockDeviceInactive,
+			ProvisionPhase: diskv1.ProvisionPhaseProvisioned,
+		},
+	}
+	nodes := &fakeNodes{
+		node: &longhornv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: "longhorn-system"},
+			Spec: longhornv1.NodeSpec{
+				Disks: map[string]longhornv1.DiskSpec{
+					"old-bd": {Path: "/var/lib/harvester/extra-disks/old-bd", AllowScheduling: true, Tags: []string{"ssd"}},
+				},
+			},
+			Status: longhornv1.NodeStatus{
+				DiskStatus: map[string]*longhornv1.DiskStatus{
+					"old-bd": {ScheduledReplica: map[string]int64{"replica1": 1024}},
+				},
+			},
+		},
+	}
+	bds := &fakeBlockDevices{}
+	c := &Controller{
+		Namespace:        "longhorn-system",
+		NodeName:         "node1",
+		Nodes:            nodes,
+		Blockdevices:     bds,
+		BlockdeviceCache: &fakeBlockDeviceCache{bds: []*diskv1.BlockDevice{replaced}},
+		recorder:         &events.FakeRecorder{},
+	}
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "new-bd"},
+		Spec: diskv1.BlockDeviceSpec{
+			NodeName:   "node1",
+			FileSystem: &diskv1.FilesystemInfo{},
+			Replaces:   "old-bd",
+		},
+		Status: diskv1.BlockDeviceStatus{
+			State:          diskv1.BlockDeviceActive,
+			ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned,
+		},
+	}
+
+	// take over the tags and provisioning
+	require.True(t, needTakeOver(bd))
+	require.NoError(t, c.takeOverReplacedDevice(bd))
+	assert.Equal(t, []string{"ssd"}, bd.Spec.Tags)
+	assert.True(t, bd.Spec.FileSystem.Provisioned)
+	assert.True(t, bd.Spec.FileSystem.ForceFormatted)
+	assert.Equal(t, "xfs", bd.Spec.FileSystem.Type)
+	assert.Equal(t, []string{"noatime"}, bd.Spec.FileSystem.MountOptions)
+	assert.False(t, needTakeOver(bd))
+
+	// the replaced device is kept until the device is provisioned
+	assert.False(t, needRemoveReplaced(bd))
+	bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+	require.True(t, needRemoveReplaced(bd))
+
+	// evict the replicas from the replaced disk
+	require.NoError(t, c.removeReplacedDevice(bd))
+	disk := nodes.node.Spec.Disks["old-bd"]
+	assert.False(t, disk.AllowScheduling)
+	assert.True(t, disk.EvictionRequested)
+	assert.Contains(t, disk.Tags, utils.DiskRemoveTag)
+	assert.Empty(t, bds.deleted)
+
+	// still evicting
+	require.NoError(t, c.removeReplacedDevice(bd))
+	assert.Contains(t, nodes.node.Spec.Disks, "old-bd")
+	assert.Empty(t, bds.deleted)
+	assert.False(t, diskv1.DeviceReplaced.IsTrue(bd))
+
+	// evicted
+	nodes.node.Status.DiskStatus["old-bd"].ScheduledReplica = nil
+	require.NoError(t, c.removeReplacedDevice(bd))
+	assert.NotContains(t, nodes.node.Spec.Disks, "old-bd")
+	assert.Equal(t, []string{"old-bd"}, bds.deleted)
+	assert.True(t, diskv1.DeviceReplaced.IsTrue(bd))
+	assert.False(t, needRemoveReplaced(bd))
+}
+
+func Test_takeOverActiveDevice(t *testing.T) {
+	replaced := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "old-bd"},
+		Spec:       diskv1.BlockDeviceSpec{NodeName: "node1", FileSystem: &diskv1.FilesystemInfo{Provisioned: true}},
+		Status:     diskv1.BlockDeviceStatus{State: diskv1.BlockDeviceActive},
+	}
+	c := &Controller{
+		Namespace:        "longhorn-system",
+		NodeName:         "node1",
+		BlockdeviceCache: &fakeBlockDeviceCache{bds: []*diskv1.BlockDevice{replaced}},
+	}
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "new-bd"},
+		Spec:       diskv1.BlockDeviceSpec{NodeName: "node1", FileSystem: &diskv1.FilesystemInfo{}, Replaces: "old-bd"},
+	}
+
+	assert.Error(t, c.takeOverReplacedDevice(bd))
+	assert.False(t, bd.Spec.FileSystem.Provisioned)
+	assert.True(t, needTakeOver(bd))
+}
+
+func Test_takeOverEncryptedDevice(t *testing.T) {
+	replaced := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "old-bd"},
+		Spec: diskv1.BlockDeviceSpec{
+			NodeName: "node1",
+			FileSystem: &diskv1.FilesystemInfo{
+				Provisioned: true,
+				Encryption:  &diskv1.EncryptionInfo{SecretName: "disk-key"},
+			},
+		},
+		Status: diskv1.BlockDeviceStatus{State: diskv1.BlockDeviceInactive},
+	}
+	c := &Controller{
+		Namespace:        "longhorn-system",
+		NodeName:         "node1",
+		BlockdeviceCache: &fakeBlockDeviceCache{bds: []*diskv1.BlockDevice{replaced}},
+		recorder:         &events.FakeRecorder{},
+	}
+	newBlockDevice := func() *diskv1.BlockDevice {
+		return &diskv1.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{Name: "new-bd"},
+			Spec:       diskv1.BlockDeviceSpec{NodeName: "node1", FileSystem: &diskv1.FilesystemInfo{}, Replaces: "old-bd"},
+			Status: diskv1.BlockDeviceStatus{
+				DeviceStatus: diskv1.DeviceStatus{FileSystem: &diskv1.FilesystemStatus{}},
+			},
+		}
+	}
+
+	bd := newBlockDevice()
+	require.NoError(t, c.takeOverReplacedDevice(bd))
+	assert.True(t, bd.Spec.FileSystem.ForceFormatted)
+	assert.Equal(t, &diskv1.EncryptionInfo{SecretName: "disk-key"}, bd.Spec.FileSystem.Encryption)
+
+	// a formatted device would never be encrypted
+	bd = newBlockDevice()
+	bd.Status.DeviceStatus.FileSystem.LastFormattedAt = &metav1.Time{}
+	assert.Error(t, c.takeOverReplacedDevice(bd))
+	assert.Nil(t, bd.Spec.FileSystem.Encryption)
+	assert.True(t, needTakeOver(bd))
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
+	gocommon "github.com/harvester/go-common"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -13,8 +15,11 @@ import (
 
 	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
 	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
 	"github.com/harvester/node-disk-manager/pkg/filter"
 	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/metrics"
+	"github.com/harvester/node-disk-manager/pkg/utils"
 )
 
 type Scanner struct {
@@ -24,14 +29,23 @@ type Scanner struct {
 	BlockInfo            block.Info
 	ExcludeFilters       []*filter.Filter
 	AutoProvisionFilters []*filter.Filter
+	GPTGenerator         block.GPTGenerator // nil if auto GPT generation is disabled
+	PolicyMatcher        *ProvisionPolicyMatcher
+	Recorder             events.Recorder
+	RescanInterval       time.Duration
 	Cond                 *sync.Cond
 	Shutdown             bool
 	TerminatedChannels   *chan bool
+
+	// filtersLock guards the filters read without the scanner lock, e.g. by udev
+	filtersLock sync.RWMutex
 }
 
 type deviceWithAutoProvision struct {
 	bd              *diskv1.BlockDevice
 	AutoProvisioned bool
+	// the DiskProvisionPolicy matching the disk, it takes precedence over the auto-provision filters
+	Policy *diskv1.DiskProvisionPolicy
 }
 
 func NewScanner(
@@ -39,6 +53,10 @@ func NewScanner(
 	bds ctldiskv1.BlockDeviceController,
 	block block.Info,
 	excludeFilters, autoProvisionFilters []*filter.Filter,
+	gptGenerator block.GPTGenerator,
+	policyMatcher *ProvisionPolicyMatcher,
+	recorder events.Recorder,
+	rescanInterval time.Duration,
 	cond *sync.Cond,
 	shutdown bool,
 	ch *chan bool,
@@ -50,6 +68,10 @@ func NewScanner(
 		BlockInfo:            block,
 		ExcludeFilters:       excludeFilters,
 		AutoProvisionFilters: autoProvisionFilters,
+		GPTGenerator:         gptGenerator,
+		PolicyMatcher:        policyMatcher,
+		Recorder:             recorder,
+		RescanInterval:       rescanInterval,
 		Cond:                 cond,
 		Shutdown:             shutdown,
 		TerminatedChannels:   ch,
@@ -60,6 +82,11 @@ func (s *Scanner) Start() error {
 	if err := s.scanBlockDevicesOnNode(); err != nil {
 		return err
 	}
+
+	stopRescan := make(chan struct{})
+	rescanStopped := make(chan struct{})
+	go s.periodicRescan(stopRescan, rescanStopped)
+
 	go func() {
 		for {
 			s.Cond.L.Lock()
@@ -69,6 +96,10 @@ func (s *Scanner) Start() error {
 			if s.Shutdown {
 				logrus.Info("Prepare to stop scanner.")
 				s.Cond.L.Unlock()
+				// the rescan routine needs the lock to see the shutdown flag,
+				// so wait for it only after the lock is released.
+				close(stopRescan)
+				<-rescanStopped
 				logrus.Info("Receiver routine shutdown.")
 				*s.TerminatedChannels <- true
 				return
@@ -84,43 +115,207 @@ func (s *Scanner) Start() error {
 	return nil
 }
 
+// periodicRescan wakes up the scanner every RescanInterval (plus jitter) until
+// stop is closed. It covers the devices whose udev events were missed, e.g.
+// netlink buffer overruns or a respawned udev monitor.
+func (s *Scanner) periodicRescan(stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	if s.RescanInterval <= 0 {
+		logrus.Info("Periodic rescan is disabled")
+		<-stop
+		return
+	}
+
+	logrus.Infof("Periodic rescan is enabled with interval %v", s.RescanInterval)
+	timer := time.NewTimer(jitterRescanInterval(s.RescanInterval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			logrus.Info("Periodic rescan routine shutdown.")
+			return
+		case <-timer.C:
+			utils.CallerWithCondLock(s.Cond, func() any {
+				if s.Shutdown {
+					return nil
+				}
+				logrus.Debugf("Wake up scanner for periodic rescan")
+				s.Cond.Signal()
+				return nil
+			})
+			timer.Reset(jitterRescanInterval(s.RescanInterval))
+		}
+	}
+}
+
+// jitterRescanInterval returns the interval plus a random jitter up to 10% of
+// it, so NDM instances on different nodes do not rescan in lockstep.
+func jitterRescanInterval(interval time.Duration) time.Duration {
+	maxJitter := int64(interval / 10)
+	if maxJitter <= 0 {
+		return interval
+	}
+	randNum, err := gocommon.GenRandNumber(maxJitter)
+	if err != nil {
+		logrus.Errorf("Failed to generate random number, set jitter to `0`: %v", err)
+	}
+	return interval + time.Duration(randNum)
+}
+
 func (s *Scanner) collectAllDevices() []*deviceWithAutoProvision {
+	allDevices, _ := s.scanDevices(false)
+	return allDevices
+}
+
+// scanDevices collects the block devices of the node, and explains the
+// decision on each of the disks and partitions found. Nothing is written to
+// the disks in dry run, i.e. no GPT partition table is generated.
+func (s *Scanner) scanDevices(dryRun bool) ([]*deviceWithAutoProvision, []*DeviceExplanation) {
 	allDevices := make([]*deviceWithAutoProvision, 0)
+	explanations := make([]*DeviceExplanation, 0)
+	skipPartitions := func(disk *block.Disk, reason string) {
+		for _, part := range disk.Partitions {
+			explanations = append(explanations, &DeviceExplanation{DevPath: utils.GetFullDevPath(part.Name), Skipped: reason})
+		}
+	}
+	policies := s.nodeProvisionPolicies()
 	// list all the block devices
 	for _, disk := range s.BlockInfo.GetDisks() {
+		explanation := &DeviceExplanation{DevPath: utils.GetFullDevPath(disk.Name)}
+		explanations = append(explanations, explanation)
+		// the paths of a multipath device are the same disk as it
+		if disk.IsMultipathPath() {
+			logrus.Debugf("Skip block device /dev/%s, a path of multipath device /dev/%s", disk.Name, disk.MultipathHolder)
+			explanation.Skipped = fmt.Sprintf("a path of multipath device /dev/%s", disk.MultipathHolder)
+			continue
+		}
+		if disk.IsCrypt() {
+			logrus.Debugf("Skip block device /dev/%s, an opened dm-crypt device", disk.Name)
+			explanation.Skipped = "an opened dm-crypt device"
+			continue
+		}
+		if disk.IsMultipathPartition() {
+			logrus.Debugf("Skip block device /dev/%s, partitions of multipath devices are not supported", disk.Name)
+			explanation.Skipped = "partitions of multipath devices are not supported"
+			continue
+		}
 		// ignore block device by filters
-		if s.ApplyExcludeFiltersForDisk(disk) {
+		if f := s.excludeFilterOfDisk(disk); f != nil {
+			logrus.Debugf("block device /dev/%s ignored by %s", disk.Name, f.Name)
+			explanation.ExcludedBy = f.Name
+			skipPartitions(disk, "the disk is excluded")
 			continue
 		}
 		logrus.Debugf("Found a disk block device /dev/%s", disk.Name)
 		bd := GetDiskBlockDevice(disk, s.NodeName, s.Namespace)
+		if bd.Name == "" && s.GPTGenerator != nil && dryRun {
+			explanation.Skipped = "non-identifiable, a GPT partition table would be generated"
+			skipPartitions(disk, "the disk is non-identifiable")
+			continue
+		}
+		if bd.Name == "" && s.GPTGenerator != nil {
+			if labeled, err := s.generateGPT(disk); err != nil {
+				logrus.Warnf("Skip generating GPT partition table for block device /dev/%s: %v", disk.Name, err)
+			} else {
+				disk = labeled
+				bd = GetDiskBlockDevice(disk, s.NodeName, s.Namespace)
+			}
+		}
 		if bd.Name == "" {
 			logrus.Infof("Skip adding non-identifiable block device /dev/%s", disk.Name)
+			explanation.Skipped = "non-identifiable"
+			skipPartitions(disk, "the disk is non-identifiable")
 			continue
 		}
-		autoProv := s.ApplyAutoProvisionFiltersForDisk(disk)
-		allDevices = append(allDevices, &deviceWithAutoProvision{bd: bd, AutoProvisioned: autoProv})
+		explanation.BlockDevice = bd.Name
+		policy := matchProvisionPolicy(policies, disk)
+		autoProv := false
+		if policy != nil {
+			explanation.ProvisionPolicy = policy.Name
+		} else if f := s.autoProvisionFilterOfDisk(disk); f != nil {
+			logrus.Debugf("block device /dev/%s is promoted to auto-provision by %s", disk.Name, f.Name)
+			explanation.AutoProvisionedBy = f.Name
+			autoProv = true
+		}
+		allDevices = append(allDevices, &deviceWithAutoProvision{bd: bd, AutoProvisioned: autoProv, Policy: policy})
 
 		for _, part := range disk.Partitions {
+			explanation := &DeviceExplanation{DevPath: utils.GetFullDevPath(part.Name)}
+			explanations = append(explanations, explanation)
 			// ignore block device by filters
-			if s.ApplyExcludeFiltersForPartition(part) {
+			if f := s.excludeFilterOfPartition(part); f != nil {
+				logrus.Debugf("block device /dev/%s ignored by %s", part.Name, f.Name)
+				explanation.ExcludedBy = f.Name
 				continue
 			}
 			logrus.Debugf("Found a partition block device /dev/%s", part.Name)
 			bd := GetPartitionBlockDevice(part, s.NodeName, s.Namespace)
 			if bd.Name == "" {
 				logrus.Infof("Skip adding non-identifiable block device %s", bd.Spec.DevPath)
+				explanation.Skipped = "non-identifiable"
 				continue
 			}
+			explanation.BlockDevice = bd.Name
 			allDevices = append(allDevices, &deviceWithAutoProvision{bd: bd, AutoProvisioned: false})
 		}
 	}
-	return allDevices
+	return allDevices, explanations
+}
+
+// nodeProvisionPolicies returns the DiskProvisionPolicies selecting the node
+func (s *Scanner) nodeProvisionPolicies() []*diskv1.DiskProvisionPolicy {
+	if s.PolicyMatcher == nil {
+		return nil
+	}
+	policies, err := s.PolicyMatcher.NodePolicies()
+	if err != nil {
+		logrus.Warnf("Failed to list disk provision policies of node %s: %v", s.NodeName, err)
+		return nil
+	}
+	return policies
+}
+
+// MatchProvisionPolicy returns the DiskProvisionPolicy applied to the disk, or
+// nil if none of them matches it.
+func (s *Scanner) MatchProvisionPolicy(disk *block.Disk) *diskv1.DiskProvisionPolicy {
+	return matchProvisionPolicy(s.nodeProvisionPolicies(), disk)
+}
+
+// generateGPT writes a GPT partition table to the non-identifiable disk, which
+// gives it a PTUUID to generate the GUID from. Only a blank disk is labeled,
+// i.e. it has no partitions and wipefs finds no signature on it. The disk is
+// returned as read again after labeling.
+func (s *Scanner) generateGPT(disk *block.Disk) (*block.Disk, error) {
+	devPath := utils.GetFullDevPath(disk.Name)
+	if len(disk.Partitions) > 0 || disk.FileSystemInfo.Type != "" {
+		return nil, fmt.Errorf("disk is not blank")
+	}
+	hasSignatures, err := s.GPTGenerator.HasSignatures(devPath)
+	if err != nil {
+		return nil, err
+	}
+	if hasSignatures {
+		return nil, fmt.Errorf("disk has signatures found by wipefs")
+	}
+
+	logrus.Infof("Generate GPT partition table for blank block device %s", devPath)
+	if err := s.GPTGenerator.GenerateGPT(devPath); err != nil {
+		return nil, err
+	}
+	labeled := s.BlockInfo.GetDiskByDevPath(devPath)
+	if labeled == nil || labeled.PtUUID == "" {
+		return nil, fmt.Errorf("no PTUUID found after generating GPT partition table")
+	}
+	return labeled, nil
 }
 
 // scanBlockDevicesOnNode scans block devices on the node, and it will either create or update them.
-func (s *Scanner) scanBlockDevicesOnNode() error {
+func (s *Scanner) scanBlockDevicesOnNode() (err error) {
 	logrus.Debugf("Scan block devices of node: %s", s.NodeName)
+	defer func(start time.Time) {
+		metrics.ObserveScan(start, err)
+	}(time.Now())
 
 	// list all the block devices
 	allDevices := s.collectAllDevices()
@@ -142,6 +337,9 @@ func (s *Scanner) scanBlockDevicesOnNode() error {
 				s.Blockdevices.Enqueue(s.Namespace, bd.Name)
 			} else if isDevAlreadyProvisioned(bd) {
 				logrus.Debugf("Skip the provisioned device: %s", bd.Name)
+			} else if NeedsProvisionPolicy(oldBd, device.Policy) {
+				logrus.Debugf("Enqueue block device %s for disk provision policy %s", bd.Name, device.Policy.Name)
+				s.Blockdevices.Enqueue(s.Namespace, bd.Name)
 			} else if s.NeedsAutoProvision(oldBd, autoProvisioned) {
 				logrus.Debugf("Enqueue block device %s for auto-provisioning", bd.Name)
 				s.Blockdevices.Enqueue(s.Namespace, bd.Name)
@@ -158,13 +356,18 @@ func (s *Scanner) scanBlockDevicesOnNode() error {
 			/*
 			 * Prevent add duplicated wwn even if the device path is different.
 			 * That prevent the device from being formatted again.
-			 * We should use multiple device path (TBD) for the same wwn.
+			 * The paths of dm-multipath devices are collected into one device
+			 * already, see collectAllDevices.
 			 */
 			if slices.Contains(existingWWNs, bd.Status.DeviceStatus.Details.WWN) {
 				logrus.Warnf("Skip adding duplicated WWN device %s, device path: %s", bd.Status.DeviceStatus.Details.WWN, bd.Spec.DevPath)
 				continue
 			}
 			logrus.Infof("Create new device %s with wwn: %s", bd.Name, bd.Status.DeviceStatus.Details.WWN)
+			if device.Policy != nil {
+				logrus.Infof("Apply disk provision policy %s to new device %s", device.Policy.Name, bd.Name)
+				ApplyProvisionPolicy(bd, device.Policy)
+			}
 			// persist newly detected block device
 			if _, err := s.SaveBlockDevice(bd, autoProvisioned); err != nil && !errors.IsAlreadyExists(err) {
 				return err
@@ -179,19 +382,24 @@ func (s *Scanner) scanBlockDevicesOnNode() error {
 	// We do not remove the block device that maybe just temporily not available.
 	// Set it to inactive and give the chance to recover.
 	for _, oldBd := range oldBds {
-		if oldBd.Status.State == diskv1.BlockDeviceInactive {
+		if oldBd.Status.State == diskv1.BlockDeviceInactive && oldBd.Status.InactiveSince != nil {
 			logrus.Debugf("The device %s is already inactive, continue.", oldBd.Name)
 			continue
 		}
 		logrus.Debugf("Change the device %s to inactive.", oldBd.Name)
 		newBd := oldBd.DeepCopy()
 		newBd.Status.State = diskv1.BlockDeviceInactive
+		// also record the time for the devices turned inactive before it was recorded
+		newBd.Status.InactiveSince = &metav1.Time{Time: time.Now()}
 		if !reflect.DeepEqual(oldBd, newBd) {
 			logrus.Debugf("Update block device %s for new formatting and mount state", oldBd.Name)
 			if _, err := s.Blockdevices.Update(newBd); err != nil {
 				logrus.Errorf("Update device %s status error", oldBd.Name)
 				return err
 			}
+			if oldBd.Status.State != diskv1.BlockDeviceInactive {
+				s.Recorder.Eventf(newBd, corev1.EventTypeWarning, events.ReasonDeviceInactive, "Device %s is not found on node %s", oldBd.Spec.DevPath, s.NodeName)
+			}
 		}
 	}
 	return nil
@@ -208,15 +416,13 @@ func convertBlockDeviceListToMap(bdList *diskv1.BlockDeviceList) (map[string]*di
 	return bdMap, wwns
 }
 
-// ApplyExcludeFiltersForPartition check the status of disk for every
+// ApplyExcludeFiltersForDisk check the status of disk for every
 // registered exclude filters. If the disk meets one of the criteria, it
 // returns true.
 func (s *Scanner) ApplyExcludeFiltersForDisk(disk *block.Disk) bool {
-	for _, filter := range s.ExcludeFilters {
-		if filter.ApplyDiskFilter(disk) {
-			logrus.Debugf("block device /dev/%s ignored by %s", disk.Name, filter.Name)
-			return true
-		}
+	if f := s.excludeFilterOfDisk(disk); f != nil {
+		logrus.Debugf("block device /dev/%s ignored by %s", disk.Name, f.Name)
+		return true
 	}
 	return false
 }
@@ -225,11 +431,9 @@ func (s *Scanner) ApplyExcludeFiltersForDisk(disk *block.Disk) bool {
 // registered exclude filters. If the partition meets one of the criteria, it
 // returns true.
 func (s *Scanner) ApplyExcludeFiltersForPartition(part *block.Partition) bool {
-	for _, filter := range s.ExcludeFilters {
-		if filter.ApplyPartFilter(part) {
-			logrus.Debugf("block device /dev/%s ignored by %s", part.Name, filter.Name)
-			return true
-		}
+	if f := s.excludeFilterOfPartition(part); f != nil {
+		logrus.Debugf("block device /dev/%s ignored by %s", part.Name, f.Name)
+		return true
 	}
 	return false
 }
@@ -238,15 +442,77 @@ func (s *Scanner) ApplyExcludeFiltersForPartition(part *block.Partition) bool {
 // registered auto-provision filters. If the disk meets one of the criteria, it
 // returns true.
 func (s *Scanner) ApplyAutoProvisionFiltersForDisk(disk *block.Disk) bool {
-	for _, filter := range s.AutoProvisionFilters {
-		if filter.ApplyDiskFilter(disk) {
-			logrus.Debugf("block device /dev/%s is promoted to auto-provision by %s", disk.Name, filter.Name)
-			return true
-		}
+	if f := s.autoProvisionFilterOfDisk(disk); f != nil {
+		logrus.Debugf("block device /dev/%s is promoted to auto-provision by %s", disk.Name, f.Name)
+		return true
 	}
 	return false
 }
 
+// excludeFilterOfDisk returns the first exclude filter matching the disk
+func (s *Scanner) excludeFilterOfDisk(disk *block.Disk) *filter.Filter {
+	s.filtersLock.RLock()
+	defer s.filtersLock.RUnlock()
+	for _, f := range s.ExcludeFilters {
+		if f.ApplyDiskFilter(disk) {
+			return f
+		}
+	}
+	return nil
+}
+
+// excludeFilterOfPartition returns the first exclude filter matching the partition
+func (s *Scanner) excludeFilterOfPartition(part *block.Partition) *filter.Filter {
+	s.filtersLock.RLock()
+	defer s.filtersLock.RUnlock()
+	for _, f := range s.ExcludeFilters {
+		if f.ApplyPartFilter(part) {
+			return f
+		}
+	}
+	return nil
+}
+
+// autoProvisionFilterOfDisk returns the first auto-provision filter matching the disk
+func (s *Scanner) autoProvisionFilterOfDisk(disk *block.Disk) *filter.Filter {
+	s.filtersLock.RLock()
+	defer s.filtersLock.RUnlock()
+	for _, f := range s.AutoProvisionFilters {
+		if f.ApplyDiskFilter(disk) {
+			return f
+		}
+	}
+	return nil
+}
+
+// UpdateFilters replaces the exclude and auto-provision filters under the
+// scanner lock, and wakes up the scanner to rescan the devices with them.
+func (s *Scanner) UpdateFilters(excludeFilters, autoProvisionFilters []*filter.Filter) {
+	utils.CallerWithCondLock(s.Cond, func() any {
+		s.filtersLock.Lock()
+		s.ExcludeFilters = excludeFilters
+		s.AutoProvisionFilters = autoProvisionFilters
+		s.filtersLock.Unlock()
+
+		logrus.Infof("Wake up scanner for updated filters")
+		s.Cond.Signal()
+		return nil
+	})
+}
+
+// Rescan wakes up the scanner to rescan the devices, e.g. once the partitions
+// of a disk are created.
+func (s *Scanner) Rescan() {
+	utils.CallerWithCondLock(s.Cond, func() any {
+		if s.Shutdown {
+			return nil
+		}
+		logrus.Infof("Wake up scanner for changed devices")
+		s.Cond.Signal()
+		return nil
+	})
+}
+
 // SaveBlockDevice persists the blockedevice information.
 func (s *Scanner) SaveBlockDevice(bd *diskv1.BlockDevice, autoProvisioned bool) (*diskv1.BlockDevice, error) {
 	curBd, err := s.Blockdevices.Get(bd.Namespace, bd.Name, metav1.GetOptions{})
@@ -263,7 +529,13 @@ func (s *Scanner) SaveBlockDevice(bd *diskv1.BlockDevice, autoProvisioned bool)
 	}
 	logrus.Infof("The inactive block device %s with wwn %s is coming back", bd.Name, bd.Status.DeviceStatus.Details.WWN)
 	curBd.Status.State = diskv1.BlockDeviceActive
-	return s.Blockdevices.Update(curBd)
+	curBd.Status.InactiveSince = nil
+	updated, err := s.Blockdevices.Update(curBd)
+	if err != nil {
+		return nil, err
+	}
+	s.Recorder.Eventf(updated, corev1.EventTypeNormal, events.ReasonDeviceActive, "Device %s is back on node %s", bd.Spec.DevPath, s.NodeName)
+	return updated, nil
 }
 
 // NeedsAutoProvision returns true if the current block device needs to be auto-provisioned.
@@ -0,0 +1,313 @@
+package blockdevice
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ghwblock "github.com/jaypipes/ghw/pkg/block"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/filter"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+)
+
+// fakeBlockInfo is a block.Info with a fixed set of disks that counts the scans.
+type fakeBlockInfo struct {
+	lock     sync.Mutex
+	scans    int
+	ioErrors uint64
+	disks    []*block.Disk
+}
+
+func (f *fakeBlockInfo) GetDisks() []*block.Disk {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.scans++
+	return f.disks
+}
+
+func (f *fakeBlockInfo) GetPartitions() []*block.Partition {
+	return nil
+}
+
+func (f *fakeBlockInfo) GetDiskByDevPath(name string) *block.Disk {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, disk := range f.disks {
+		if "/dev/"+disk.Name == name {
+			return disk
+		}
+	}
+	return nil
+}
+
+func (f *fakeBlockInfo) GetPartitionByDevPath(_, name string) *block.Partition {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, disk := range f.disks {
+		for _, part := range disk.Partitions {
+			if "/dev/"+part.Name == name {
+				return part
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeBlockInfo) GetFileSystemInfoByDevPath(_ string) *block.FileSystemInfo {
+	return nil
+}
+
+func (f *fakeBlockInfo) GetDiskIOErrorCount(_ string) uint64 {
+	return f.ioErrors
+}
+
+func (f *fakeBlockInfo) scanCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.scans
+}
+
+// fakeBlockDevices only implements the methods called by the scanner when
+// there is no block device on the node, and records the delayed enqueues and
+// the deleted devices.
+type fakeBlockDevices struct {
+	ctldiskv1.BlockDeviceController
+	enqueued map[string]time.Duration
+	deleted  []string
+}
+
+func (f *fakeBlockDevices) EnqueueAfter(_, name string, duration time.Duration) {
+	if f.enqueued == nil {
+		f.enqueued = make(map[string]time.Duration)
+	}
+	f.enqueued[name] = duration
+}
+
+func (f *fakeBlockDevices) Enqueue(_, _ string) {}
+
+func (f *fakeBlockDevices) Update(bd *diskv1.BlockDevice) (*diskv1.BlockDevice, error) {
+	return bd, nil
+}
+
+func (f *fakeBlockDevices) Delete(_, name string, _ *metav1.DeleteOptions) error {
+	f.deleted = append(f.deleted, name)
+	return nil
+}
+
+func (f *fakeBlockDevices) List(_ string, _ metav1.ListOptions) (*diskv1.BlockDeviceList, error) {
+	return &diskv1.BlockDeviceList{}, nil
+}
+
+func newTestScanner(info block.Info, rescanInterval time.Duration) *Scanner {
+	CacheDiskTags = &DiskTags{
+		diskTags: make(map[string][]string),
+		lock:     &sync.RWMutex{},
+	}
+	terminatedChannel := make(chan bool, 1)
+	return NewScanner(
+		"node1",
+		"longhorn-system",
+		&fakeBlockDevices{},
+		info,
+		nil,
+		nil,
+		nil,
+		nil,
+		&events.FakeRecorder{},
+		rescanInterval,
+		sync.NewCond(&sync.Mutex{}),
+		false,
+		&terminatedChannel,
+	)
+}
+
+func shutdownScanner(t *testing.T, s *Scanner) {
+	s.Cond.L.Lock()
+	s.Shutdown = true
+	s.Cond.Signal()
+	s.Cond.L.Unlock()
+	select {
+	case <-*s.TerminatedChannels:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scanner did not terminate")
+	}
+}
+
+func Test_periodicRescan(t *testing.T) {
+	info := &fakeBlockInfo{}
+	s := newTestScanner(info, 20*time.Millisecond)
+	require.NoError(t, s.Start())
+
+	assert.Eventually(t, func() bool {
+		return info.scanCount() >= 3
+	}, 5*time.Second, 10*time.Millisecond, "scanner should be woken up periodically")
+
+	shutdownScanner(t, s)
+
+	scans := info.scanCount()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, scans, info.scanCount(), "scanner should not rescan after shutdown")
+}
+
+func Test_periodicRescanDisabled(t *testing.T) {
+	info := &fakeBlockInfo{}
+	s := newTestScanner(info, 0)
+	require.NoError(t, s.Start())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, info.scanCount(), "only the initial scan is expected")
+
+	shutdownScanner(t, s)
+}
+
+func Test_jitterRescanInterval(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		interval time.Duration
+	}{
+		{
+			name:     "seconds",
+			interval: 30 * time.Second,
+		},
+		{
+			name:     "too short to jitter",
+			interval: time.Nanosecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				result := jitterRescanInterval(tc.interval)
+				assert.GreaterOrEqual(t, result, tc.interval)
+				assert.LessOrEqual(t, result, tc.interval+tc.interval/10)
+			}
+		})
+	}
+}
+
+func Test_collectAllDevicesWithMultipath(t *testing.T) {
+	wwn := "0x6001405e3c2d5a8f"
+	info := &fakeBlockInfo{disks: []*block.Disk{
+		{Name: "sda", WWN: "0x5000c50015ac3bd9"},
+		{Name: "sdb", WWN: wwn, MultipathHolder: "dm-3"},
+		{Name: "sdc", WWN: wwn, MultipathHolder: "dm-3"},
+		{Name: "dm-3", WWN: wwn, DMUUID: "mpath-36001405e3c2d5a8f", Paths: []string{"sdb", "sdc"}},
+		{Name: "dm-4", DMUUID: "part1-mpath-36001405e3c2d5a8f", PtUUID: "a4f5a7ec-40e1-4c4a-9a02-5b2b4b5c8e0d"},
+		// the opened LUKS device of an encrypted disk is not a disk of its own
+		{Name: "dm-5", DMUUID: "CRYPT-LUKS2-6b9c3d4e1f2a4b5c8d7e9f0a1b2c3d4e-ndm-bd1", UUID: "0d7f3c55-9a1e-4c1b-8f4e-2b6a7d9e1c3f"},
+	}}
+	s := newTestScanner(info, 0)
+
+	devices := s.collectAllDevices()
+	require.Len(t, devices, 2)
+	assert.Equal(t, "/dev/sda", devices[0].bd.Status.DeviceStatus.DevPath)
+	assert.Empty(t, devices[0].bd.Status.DeviceStatus.Paths)
+
+	mpath := devices[1].bd.Status.DeviceStatus
+	assert.Equal(t, "/dev/dm-3", mpath.DevPath)
+	assert.Equal(t, "mpath-36001405e3c2d5a8f", mpath.Details.DMUUID)
+	assert.Equal(t, []string{"/dev/sdb", "/dev/sdc"}, mpath.Paths)
+	// the multipath device is identified the same as its paths
+	assert.Equal(t, block.GenerateDiskGUID(info.disks[1], "node1"), devices[1].bd.Name)
+}
+
+// fakeGPTGenerator labels the disks of fakeBlockInfo with a PtUUID
+type fakeGPTGenerator struct {
+	info       *fakeBlockInfo
+	signatures map[string]bool
+	generated  []string
+}
+
+func (f *fakeGPTGenerator) HasSignatures(devPath string) (bool, error) {
+	return f.signatures[devPath], nil
+}
+
+func (f *fakeGPTGenerator) GenerateGPT(devPath string) error {
+	f.generated = append(f.generated, devPath)
+	f.info.GetDiskByDevPath(devPath).PtUUID = "6b9c3d4e-1f2a-4b5c-8d7e-" + strings.TrimPrefix(devPath, "/dev/")
+	return nil
+}
+
+func Test_collectAllDevicesWithAutoGPTGenerate(t *testing.T) {
+	info := &fakeBlockInfo{disks: []*block.Disk{
+		{Name: "sda", WWN: "0x5000c50015ac3bd9"},
+		{Name: "vda"},
+		{Name: "vdb"},
+		{Name: "vdc", FileSystemInfo: block.FileSystemInfo{Type: "ext4"}},
+		{Name: "vdd", Partitions: []*block.Partition{{Name: "vdd1"}}},
+	}}
+	s := newTestScanner(info, 0)
+
+	// disabled by default
+	require.Len(t, s.collectAllDevices(), 1)
+
+	gpt := &fakeGPTGenerator{info: info, signatures: map[string]bool{"/dev/vdb": true}}
+	s.GPTGenerator = gpt
+	devices := s.collectAllDevices()
+	require.Len(t, devices, 2)
+	// only the blank disk without any signature is labeled
+	assert.Equal(t, []string{"/dev/vda"}, gpt.generated)
+	assert.Equal(t, "/dev/vda", devices[1].bd.Status.DeviceStatus.DevPath)
+	assert.Equal(t, block.GenerateDiskGUID(info.disks[1], "node1"), devices[1].bd.Name)
+	assert.Equal(t, info.disks[1].PtUUID, devices[1].bd.Status.DeviceStatus.Details.PtUUID)
+
+	// the labeled disk is identifiable from now on
+	devices = s.collectAllDevices()
+	require.Len(t, devices, 2)
+	assert.Equal(t, []string{"/dev/vda"}, gpt.generated)
+}
+
+func Test_explainDevices(t *testing.T) {
+	sda := &block.Disk{Name: "sda", WWN: "0x5000c50015ac3bd9", DriveType: ghwblock.DRIVE_TYPE_HDD}
+	sda.Partitions = []*block.Partition{
+		{Disk: sda, Name: "sda1", UUID: "1b9a5b2c-7f0e-4c5e-9a43-2b1d8f1e9c01", DriveType: ghwblock.DRIVE_TYPE_HDD},
+		{Disk: sda, Name: "sda2", UUID: "1b9a5b2c-7f0e-4c5e-9a43-2b1d8f1e9c02", DriveType: ghwblock.DRIVE_TYPE_HDD, Label: "COS_OEM"},
+	}
+	sdb := &block.Disk{Name: "sdb", WWN: "0x5000c50015ac3bda", Vendor: "longhorn", DriveType: ghwblock.DRIVE_TYPE_HDD}
+	sdb.Partitions = []*block.Partition{{Disk: sdb, Name: "sdb1", DriveType: ghwblock.DRIVE_TYPE_HDD}}
+	info := &fakeBlockInfo{disks: []*block.Disk{
+		sda,
+		sdb,
+		{Name: "sdc", WWN: "0x5002538e4095a5b2", DriveType: ghwblock.DRIVE_TYPE_SSD},
+		{Name: "nvme0n1", WWN: "eui.0025388b91b3a0c1", DriveType: ghwblock.DRIVE_TYPE_SSD},
+		{Name: "vda", DriveType: ghwblock.DRIVE_TYPE_HDD},
+	}}
+	s := newTestScanner(info, 0)
+	s.ExcludeFilters = filter.SetExcludeFilters("longhorn", "", "COS_*", "")
+	s.AutoProvisionFilters = filter.SetAutoProvisionFilters("/dev/sd*,/dev/nvme*")
+	s.PolicyMatcher = NewProvisionPolicyMatcher("node1", &fakePolicyCache{policies: []*diskv1.DiskProvisionPolicy{
+		newPolicy("nvme", 0, diskv1.DiskSelector{WWNs: []string{"eui.0025388b91b3a0c1"}}),
+	}}, &fakeKubeNodes{})
+	gpt := &fakeGPTGenerator{info: info}
+	s.GPTGenerator = gpt
+
+	explanations := s.ExplainDevices()
+	names := map[string]string{}
+	for _, e := range explanations {
+		names[e.DevPath] = e.BlockDevice
+	}
+	assert.Equal(t, []*DeviceExplanation{
+		{DevPath: "/dev/sda", BlockDevice: names["/dev/sda"], AutoProvisionedBy: "device path filter"},
+		{DevPath: "/dev/sda1", BlockDevice: names["/dev/sda1"]},
+		{DevPath: "/dev/sda2", ExcludedBy: "label filter"},
+		{DevPath: "/dev/sdb", ExcludedBy: "vendor filter"},
+		{DevPath: "/dev/sdb1", Skipped: "the disk is excluded"},
+		{DevPath: "/dev/sdc", BlockDevice: names["/dev/sdc"], AutoProvisionedBy: "device path filter"},
+		{DevPath: "/dev/nvme0n1", BlockDevice: names["/dev/nvme0n1"], ProvisionPolicy: "nvme"},
+		{DevPath: "/dev/vda", Skipped: "non-identifiable, a GPT partition table would be generated"},
+	}, explanations)
+	for _, devPath := range []string{"/dev/sda", "/dev/sda1", "/dev/sdc", "/dev/nvme0n1"} {
+		assert.NotEmpty(t, names[devPath])
+	}
+	// nothing is written in dry run
+	assert.Empty(t, gpt.generated)
+}
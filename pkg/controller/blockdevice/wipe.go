@@ -0,0 +1,133 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+)
+
+// wipeProgressInterval is the interval to refresh the progress of a wipe in status
+const wipeProgressInterval = 30 * time.Second
+
+// wipeJob is a wipe running in background, since it could take hours
+type wipeJob struct {
+	mode     diskv1.WipeMode
+	progress atomic.Int32
+	done     chan struct{}
+	err      error
+}
+
+// reconcileWipe runs the wipe requested in spec, and reports its progress in
+// status. It returns true if the device is being wiped, or the wipe is just
+// started or finished, so the other operations are skipped this time.
+func (c *Controller) reconcileWipe(device *diskv1.BlockDevice, devPath string, filesystem *block.FileSystemInfo) bool {
+	if value, ok := c.wipeJobs.Load(device.Name); ok {
+		job := value.(*wipeJob)
+		if device.Status.Wipe == nil || device.Status.Wipe.Mode != job.mode {
+			// the status of the started wipe is not updated
+			device.Status.Wipe = &diskv1.WipeStatus{Mode: job.mode, Phase: diskv1.WipePhaseWiping, LastWipedAt: lastWipedAt(device)}
+		}
+		select {
+		case <-job.done:
+			c.wipeJobs.Delete(device.Name)
+			c.finishWipe(device, job.mode, job.err)
+		default:
+			device.Status.Wipe.Progress = job.progress.Load()
+			c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, wipeProgressInterval)
+		}
+		return true
+	}
+
+	spec := device.Spec.Wipe
+	if spec == nil {
+		// clear the status, so the device could be wiped again
+		device.Status.Wipe = nil
+		return false
+	}
+	if status := device.Status.Wipe; status != nil && status.Mode == spec.Mode {
+		if status.Phase != diskv1.WipePhaseWiping {
+			return false
+		}
+		c.failWipe(device, spec.Mode, fmt.Errorf("the wipe is interrupted, remove spec.wipe and set it again to retry"))
+		return true
+	}
+
+	if device.Status.ProvisionPhase != diskv1.ProvisionPhaseUnprovisioned || device.Status.VolumeGroup != nil || device.Spec.FileSystem.Provisioned {
+		c.failWipe(device, spec.Mode, fmt.Errorf("device %s is not unprovisioned", device.Name))
+		return true
+	}
+	if filesystem != nil && filesystem.MountPoint != "" {
+		c.failWipe(device, spec.Mode, fmt.Errorf("device %s is mounted at %s", device.Name, filesystem.MountPoint))
+		return true
+	}
+	if err := c.checkRootDisk(device, devPath); err != nil {
+		c.failWipe(device, spec.Mode, err)
+		return true
+	}
+	if err := c.checkChildPartitionsFree(device, devPath); err != nil {
+		c.failWipe(device, spec.Mode, err)
+		return true
+	}
+	if !c.semaphore.tryAcquire() {
+		logrus.Infof("Hit maximum concurrent count. Requeue device %s", device.Name)
+		c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, jitterEnqueueDelay())
+		return true
+	}
+
+	job := &wipeJob{mode: spec.Mode, done: make(chan struct{})}
+	c.wipeJobs.Store(device.Name, job)
+	go func(name string) {
+		defer c.semaphore.release()
+		job.err = c.wiper.Wipe(devPath, job.mode, job.progress.Store)
+		close(job.done)
+		c.Blockdevices.Enqueue(c.Namespace, name)
+	}(device.Name)
+
+	device.Status.Wipe = &diskv1.WipeStatus{
+		Mode:        spec.Mode,
+		Phase:       diskv1.WipePhaseWiping,
+		StartedAt:   &metav1.Time{Time: time.Now()},
+		LastWipedAt: lastWipedAt(device),
+	}
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonWiping, "Wiping device %s with mode %s", devPath, spec.Mode)
+	c.Blockdevices.EnqueueAfter(c.Namespace, device.Name, wipeProgressInterval)
+	return true
+}
+
+func (c *Controller) finishWipe(device *diskv1.BlockDevice, mode diskv1.WipeMode, err error) {
+	if err != nil {
+		c.failWipe(device, mode, err)
+		return
+	}
+	logrus.Infof("Wiped device %s with mode %s", device.Name, mode)
+	device.Status.Wipe.Phase = diskv1.WipePhaseWiped
+	device.Status.Wipe.Progress = 100
+	device.Status.Wipe.Message = ""
+	device.Status.Wipe.LastWipedAt = &metav1.Time{Time: time.Now()}
+	c.recorder.Eventf(device, corev1.EventTypeNormal, events.ReasonWiped, "Wiped device with mode %s", mode)
+}
+
+func (c *Controller) failWipe(device *diskv1.BlockDevice, mode diskv1.WipeMode, err error) {
+	logrus.Errorf("Failed to wipe device %s with mode %s: %v", device.Name, mode, err)
+	if device.Status.Wipe == nil || device.Status.Wipe.Mode != mode {
+		device.Status.Wipe = &diskv1.WipeStatus{Mode: mode, LastWipedAt: lastWipedAt(device)}
+	}
+	device.Status.Wipe.Phase = diskv1.WipePhaseFailed
+	device.Status.Wipe.Message = err.Error()
+	c.recorder.Event(device, corev1.EventTypeWarning, events.ReasonWipeFailed, err.Error())
+}
+
+func lastWipedAt(device *diskv1.BlockDevice) *metav1.Time {
+	if device.Status.Wipe == nil {
+		return nil
+	}
+	return device.Status.Wipe.LastWipedAt
+}
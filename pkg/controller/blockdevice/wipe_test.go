@@ -0,0 +1,187 @@
+package blockdevice
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/events"
+	"github.com/harvester/node-disk-manager/pkg/wipe"
+)
+
+// fakeWiper reports half of the progress, and blocks the wipe until it is
+// released.
+type fakeWiper struct {
+	release chan error
+	modes   []diskv1.WipeMode
+}
+
+func (f *fakeWiper) Wipe(_ string, mode diskv1.WipeMode, progress wipe.ProgressFunc) error {
+	f.modes = append(f.modes, mode)
+	progress(50)
+	return <-f.release
+}
+
+func newWipeBlockDevice(mode diskv1.WipeMode) *diskv1.BlockDevice {
+	return &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1"},
+		Spec: diskv1.BlockDeviceSpec{
+			FileSystem: &diskv1.FilesystemInfo{},
+			Wipe:       &diskv1.WipeInfo{Mode: mode},
+		},
+		Status: diskv1.BlockDeviceStatus{ProvisionPhase: diskv1.ProvisionPhaseUnprovisioned},
+	}
+}
+
+// waitWipeJob waits for the wipe job of the device to be done
+func waitWipeJob(t *testing.T, c *Controller, name string) {
+	value, ok := c.wipeJobs.Load(name)
+	require.True(t, ok)
+	select {
+	case <-value.(*wipeJob).done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "wipe job is not done")
+	}
+}
+
+func Test_reconcileWipe(t *testing.T) {
+	stubHolders(t, nil)
+	wiper := &fakeWiper{release: make(chan error)}
+	c := &Controller{
+		Namespace:        "longhorn-system",
+		Blockdevices:     &fakeBlockDevices{},
+		BlockdeviceCache: &fakeBlockDeviceCache{},
+		semaphore:        newSemaphore(1),
+		recorder:         &events.FakeRecorder{},
+		wiper:            wiper,
+	}
+	bd := newWipeBlockDevice(diskv1.WipeModeZero)
+
+	// start the wipe
+	require.True(t, c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	require.NotNil(t, bd.Status.Wipe)
+	assert.Equal(t, diskv1.WipePhaseWiping, bd.Status.Wipe.Phase)
+	assert.NotNil(t, bd.Status.Wipe.StartedAt)
+	// the semaphore is held by the wipe
+	assert.False(t, c.semaphore.acquire())
+
+	// report the progress
+	require.Eventually(t, func() bool {
+		c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{})
+		return bd.Status.Wipe.Progress == 50
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// done
+	wiper.release <- nil
+	waitWipeJob(t, c, bd.Name)
+	require.True(t, c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Equal(t, diskv1.WipePhaseWiped, bd.Status.Wipe.Phase)
+	assert.Equal(t, int32(100), bd.Status.Wipe.Progress)
+	require.NotNil(t, bd.Status.Wipe.LastWipedAt)
+	assert.True(t, c.semaphore.acquire())
+	c.semaphore.release()
+
+	// the wipe runs once
+	assert.False(t, c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Equal(t, []diskv1.WipeMode{diskv1.WipeModeZero}, wiper.modes)
+
+	// wipe again with another mode, which fails
+	bd.Spec.Wipe.Mode = diskv1.WipeModeDiscard
+	lastWipedAt := bd.Status.Wipe.LastWipedAt
+	require.True(t, c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	wiper.release <- errors.New("discard is not supported")
+	waitWipeJob(t, c, bd.Name)
+	require.True(t, c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Equal(t, diskv1.WipeModeDiscard, bd.Status.Wipe.Mode)
+	assert.Equal(t, diskv1.WipePhaseFailed, bd.Status.Wipe.Phase)
+	assert.Contains(t, bd.Status.Wipe.Message, "not supported")
+	assert.Equal(t, lastWipedAt, bd.Status.Wipe.LastWipedAt)
+
+	// the status is cleared once spec.wipe is removed
+	bd.Spec.Wipe = nil
+	assert.False(t, c.reconcileWipe(bd, "/dev/sdb", &block.FileSystemInfo{}))
+	assert.Nil(t, bd.Status.Wipe)
+}
+
+func Test_reconcileWipeNotAllowed(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		mutate     func(bd *diskv1.BlockDevice)
+		filesystem *block.FileSystemInfo
+		partitions []*diskv1.BlockDevice
+		holders    map[string][]string
+	}{
+		{
+			name: "provisioned",
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+			},
+		},
+		{
+			name: "in a volume group",
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+			},
+		},
+		{
+			name:       "mounted",
+			filesystem: &block.FileSystemInfo{MountPoint: "/var/lib/harvester/extra-disks/bd1"},
+		},
+		{
+			name: "partition in a volume group",
+			partitions: []*diskv1.BlockDevice{newChildPartition("bd1-part1", func(part *diskv1.BlockDevice) {
+				part.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+				part.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+			})},
+		},
+		{
+			name: "mounted partition",
+			partitions: []*diskv1.BlockDevice{newChildPartition("bd1-part1", func(part *diskv1.BlockDevice) {
+				part.Status.DeviceStatus.FileSystem.MountPoint = "/mnt/data"
+			})},
+		},
+		{
+			name:    "held by a device-mapper device",
+			holders: map[string][]string{"/dev/sdb": {"dm-0"}},
+		},
+		{
+			name: "interrupted",
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Status.Wipe = &diskv1.WipeStatus{Mode: diskv1.WipeModeZero, Phase: diskv1.WipePhaseWiping}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubHolders(t, tc.holders)
+			wiper := &fakeWiper{}
+			c := &Controller{
+				Namespace:        "longhorn-system",
+				NodeName:         "node1",
+				Blockdevices:     &fakeBlockDevices{},
+				BlockdeviceCache: &fakeBlockDeviceCache{bds: tc.partitions},
+				semaphore:        newSemaphore(1),
+				recorder:         &events.FakeRecorder{},
+				wiper:            wiper,
+			}
+			bd := newWipeBlockDevice(diskv1.WipeModeZero)
+			if tc.mutate != nil {
+				tc.mutate(bd)
+			}
+
+			require.True(t, c.reconcileWipe(bd, "/dev/sdb", tc.filesystem))
+			require.NotNil(t, bd.Status.Wipe)
+			assert.Equal(t, diskv1.WipePhaseFailed, bd.Status.Wipe.Phase)
+			assert.NotEmpty(t, bd.Status.Wipe.Message)
+			assert.Empty(t, wiper.modes)
+		})
+	}
+}
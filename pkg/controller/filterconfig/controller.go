@@ -0,0 +1,105 @@
+package filterconfig
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/harvester/node-disk-manager/pkg/controller/blockdevice"
+	"github.com/harvester/node-disk-manager/pkg/filter"
+	"github.com/harvester/node-disk-manager/pkg/option"
+)
+
+type Controller struct {
+	nodeName string
+	defaults filter.Config
+	scanner  *blockdevice.Scanner
+
+	lock    sync.Mutex
+	current filter.Config
+}
+
+// Register watches the filter ConfigMap in the namespace, and reloads the
+// filters of the scanner once it changes. The filters of the flags are used
+// if the ConfigMap is not found.
+func Register(ctx context.Context, clientset kubernetes.Interface, opt *option.Option, defaults filter.Config, scanner *blockdevice.Scanner) error {
+	if opt.FilterConfigMap == "" {
+		return nil
+	}
+	c := &Controller{
+		nodeName: opt.NodeName,
+		defaults: defaults,
+		scanner:  scanner,
+		current:  defaults,
+	}
+
+	watchConfigMap(ctx, clientset, opt, c.OnConfigMapChange)
+	return nil
+}
+
+// watchConfigMap calls onChange with the filter ConfigMap once it changes, or
+// with nil once it is removed, and returns the factory of the informer.
+func watchConfigMap(ctx context.Context, clientset kubernetes.Interface, opt *option.Option, onChange func(cm *corev1.ConfigMap)) informers.SharedInformerFactory {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(opt.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opt.FilterConfigMap).String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			onChange(obj.(*corev1.ConfigMap))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			onChange(obj.(*corev1.ConfigMap))
+		},
+		DeleteFunc: func(_ interface{}) {
+			onChange(nil)
+		},
+	})
+	logrus.Infof("Watch ConfigMap %s/%s for the filters", opt.Namespace, opt.FilterConfigMap)
+	factory.Start(ctx.Done())
+	return factory
+}
+
+// OnConfigMapChange rebuilds the filters of the scanner from the ConfigMap, or
+// from the flags if it is removed. An invalid ConfigMap is ignored, and the
+// current filters are kept.
+func (c *Controller) OnConfigMapChange(cm *corev1.ConfigMap) {
+	config := c.defaults
+	if cm != nil {
+		var err error
+		if config, err = filter.ParseConfigData(cm.Data, c.nodeName, c.defaults); err != nil {
+			logrus.Errorf("Failed to parse filters of ConfigMap %s/%s, keep the current filters: %v", cm.Namespace, cm.Name, err)
+			return
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if reflect.DeepEqual(c.current, config) {
+		return
+	}
+	excludeFilters, err := config.ExcludeFilters()
+	if err != nil {
+		logrus.Errorf("Failed to build exclude filters, keep the current filters: %v", err)
+		return
+	}
+	autoProvisionFilters, err := config.AutoProvisionFilters()
+	if err != nil {
+		logrus.Errorf("Failed to build auto-provision filters, keep the current filters: %v", err)
+		return
+	}
+	logrus.Infof("Reload filters: %+v", config)
+	c.scanner.UpdateFilters(excludeFilters, autoProvisionFilters)
+	c.current = config
+}
@@ -0,0 +1,98 @@
+package filterconfig
+
+import (
+	"sync"
+	"testing"
+
+	ghwblock "github.com/jaypipes/ghw/pkg/block"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/harvester/node-disk-manager/pkg/block"
+	"github.com/harvester/node-disk-manager/pkg/controller/blockdevice"
+	"github.com/harvester/node-disk-manager/pkg/filter"
+)
+
+func Test_OnConfigMapChange(t *testing.T) {
+	defaults := filter.Config{VendorFilter: "longhorn"}
+	excludeFilters, err := defaults.ExcludeFilters()
+	require.NoError(t, err)
+	scanner := &blockdevice.Scanner{
+		Cond:           sync.NewCond(&sync.Mutex{}),
+		ExcludeFilters: excludeFilters,
+	}
+	c := &Controller{nodeName: "node1", defaults: defaults, scanner: scanner, current: defaults}
+	qemu := &block.Disk{Name: "sdb", Vendor: "QEMU", DriveType: ghwblock.DRIVE_TYPE_HDD}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harvester-system", Name: "ndm-filters"},
+		Data:       map[string]string{"node1": "vendorFilter: longhorn,QEMU"},
+	}
+
+	assert.False(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+	c.OnConfigMapChange(cm)
+	assert.True(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+
+	// the current filters are kept for an invalid ConfigMap
+	cm.Data["node1"] = "unknownFilter: QEMU"
+	c.OnConfigMapChange(cm)
+	assert.True(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+	cm.Data["node1"] = "excludeExpression: vendor =="
+	c.OnConfigMapChange(cm)
+	assert.True(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+	cm.Data["node1"] = "modelFilter: QEMU ["
+	c.OnConfigMapChange(cm)
+	assert.True(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+
+	cm.Data["node1"] = "excludeExpression: vendor == \"QEMU\" && size < 1Ti"
+	c.OnConfigMapChange(cm)
+	assert.True(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+	assert.False(t, scanner.ApplyExcludeFiltersForDisk(&block.Disk{Name: "sdc", Vendor: "QEMU", SizeBytes: 2 << 40, DriveType: ghwblock.DRIVE_TYPE_HDD}))
+
+	// the filters of the flags are restored once the ConfigMap is removed
+	c.OnConfigMapChange(nil)
+	assert.False(t, scanner.ApplyExcludeFiltersForDisk(qemu))
+}
+
+func Test_Resolver(t *testing.T) {
+	_, err := NewResolver(filter.Config{ModelFilter: "regex:QEMU ("})
+	assert.Error(t, err)
+	r, err := NewResolver(filter.Config{VendorFilter: "longhorn"})
+	require.NoError(t, err)
+	excluded := func(nodeName string, disk *block.Disk) bool {
+		for _, f := range r.ExcludeFilters(nodeName) {
+			if f.ApplyDiskFilter(disk) {
+				return true
+			}
+		}
+		return false
+	}
+	qemu := &block.Disk{Name: "sdb", Vendor: "QEMU", DriveType: ghwblock.DRIVE_TYPE_HDD}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harvester-system", Name: "ndm-filters"},
+		Data: map[string]string{
+			"modelFilter": "QEMU HARDDISK",
+			"node1":       "vendorFilter: longhorn,QEMU",
+			"node2":       "unknownFilter: QEMU",
+		},
+	}
+
+	assert.False(t, excluded("node1", qemu))
+	r.OnConfigMapChange(cm)
+	assert.True(t, excluded("node1", qemu))
+	assert.False(t, excluded("node3", qemu))
+	// the filters of all nodes are used for the invalid ones of a node
+	assert.True(t, excluded("node2", &block.Disk{Name: "sdc", Model: "QEMU HARDDISK", DriveType: ghwblock.DRIVE_TYPE_HDD}))
+	assert.False(t, excluded("node2", qemu))
+
+	// the current filters are kept for an invalid ConfigMap
+	r.OnConfigMapChange(&corev1.ConfigMap{Data: map[string]string{"excludeExpression": "vendor =="}})
+	assert.True(t, excluded("node1", qemu))
+	r.OnConfigMapChange(&corev1.ConfigMap{Data: map[string]string{"sizeFilter": "64Gi-16Gi"}})
+	assert.True(t, excluded("node1", qemu))
+
+	// the filters of the flags are restored once the ConfigMap is removed
+	r.OnConfigMapChange(nil)
+	assert.False(t, excluded("node1", qemu))
+}
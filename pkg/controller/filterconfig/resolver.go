@@ -0,0 +1,102 @@
+package filterconfig
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/harvester/node-disk-manager/pkg/filter"
+	"github.com/harvester/node-disk-manager/pkg/option"
+)
+
+// Resolver resolves the exclude filters of any node from the filter
+// ConfigMap, for the webhook validating the blockdevices of all nodes.
+type Resolver struct {
+	defaults       filter.Config
+	defaultFilters []*filter.Filter
+
+	lock sync.Mutex
+	// data is the data of the ConfigMap, or nil if it is not found
+	data map[string]string
+	// filters caches the exclude filters resolved by node name
+	filters map[string][]*filter.Filter
+}
+
+// NewResolver returns a Resolver resolving the filters of the flags until the
+// ConfigMap is found.
+func NewResolver(defaults filter.Config) (*Resolver, error) {
+	defaultFilters, err := defaults.ExcludeFilters()
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{
+		defaults:       defaults,
+		defaultFilters: defaultFilters,
+		filters:        map[string][]*filter.Filter{},
+	}, nil
+}
+
+// RegisterResolver watches the filter ConfigMap in the namespace for the
+// resolver, and waits until it is synced.
+func RegisterResolver(ctx context.Context, clientset kubernetes.Interface, opt *option.Option, r *Resolver) error {
+	if opt.FilterConfigMap == "" {
+		return nil
+	}
+	factory := watchConfigMap(ctx, clientset, opt, r.OnConfigMapChange)
+	factory.WaitForCacheSync(ctx.Done())
+	return nil
+}
+
+// OnConfigMapChange resets the resolved filters to the ones of the ConfigMap,
+// or of the flags if it is removed. An invalid ConfigMap is ignored, and the
+// current filters are kept.
+func (r *Resolver) OnConfigMapChange(cm *corev1.ConfigMap) {
+	var data map[string]string
+	if cm != nil {
+		config, err := filter.ParseConfigData(cm.Data, "", r.defaults)
+		if err == nil {
+			_, err = config.ExcludeFilters()
+		}
+		if err != nil {
+			logrus.Errorf("Failed to parse filters of ConfigMap %s/%s, keep the current filters: %v", cm.Namespace, cm.Name, err)
+			return
+		}
+		data = cm.Data
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.data = data
+	r.filters = map[string][]*filter.Filter{}
+}
+
+// ExcludeFilters returns the exclude filters of the node, overridden by the
+// ConfigMap as the scanner of the node does. The filters of all nodes are used
+// if the ones of the node are invalid.
+func (r *Resolver) ExcludeFilters(nodeName string) []*filter.Filter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.data == nil {
+		return r.defaultFilters
+	}
+	if filters, ok := r.filters[nodeName]; ok {
+		return filters
+	}
+
+	config, err := filter.ParseConfigData(r.data, nodeName, r.defaults)
+	var filters []*filter.Filter
+	if err == nil {
+		filters, err = config.ExcludeFilters()
+	}
+	if err != nil {
+		logrus.Warnf("Failed to build filters of node %s, use the filters of all nodes: %v", nodeName, err)
+		// the filters of all nodes are validated once the ConfigMap changes
+		config, _ = filter.ParseConfigData(r.data, "", r.defaults)
+		filters, _ = config.ExcludeFilters()
+	}
+	r.filters[nodeName] = filters
+	return filters
+}
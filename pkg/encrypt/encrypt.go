@@ -0,0 +1,147 @@
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	// SecretKeyPassphrase is the key of the passphrase in the encryption Secret
+	SecretKeyPassphrase = "passphrase"
+	// SecretKeyKeyfile is the key of the keyfile in the encryption Secret
+	SecretKeyKeyfile = "keyfile"
+
+	// HeaderSize is the size of the default LUKS2 header, which the opened
+	// LUKS device is smaller than the encrypted device by
+	HeaderSize = 16 << 20
+
+	// mapperPrefix is the prefix of the names of the LUKS devices opened by NDM
+	mapperPrefix = "ndm-"
+	mapperDir    = "/dev/mapper/"
+)
+
+// Encryptor sets up the LUKS encryption of devices with cryptsetup. The key is
+// fed to cryptsetup in stdin, so it never shows up in the command line.
+type Encryptor interface {
+	// Format formats the device as a LUKS2 device with the key. The UUID of
+	// the LUKS header is kept if it is not empty.
+	Format(devPath, uuid string, key []byte) error
+	// Open opens the LUKS device as /dev/mapper/<name> with the key, if it is
+	// not opened yet.
+	Open(devPath, name string, key []byte) error
+	// Close closes the LUKS device opened as /dev/mapper/<name>, if any.
+	Close(name string) error
+	// Resize grows the opened LUKS device to fill the grown device.
+	Resize(name string, key []byte) error
+}
+
+type executor interface {
+	Execute(cmd string, args []string) (string, error)
+	ExecuteWithStdin(cmd string, args []string, stdin []byte) (string, error)
+}
+
+type encryptor struct {
+	executor executor
+	// exists returns true if the device node exists
+	exists func(devPath string) bool
+}
+
+// NewEncryptor returns an Encryptor running cryptsetup on the host namespace if
+// the host `/proc` is mounted.
+func NewEncryptor() (Encryptor, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptor{executor: executor, exists: deviceExists}, nil
+}
+
+func (e *encryptor) Format(devPath, uuid string, key []byte) error {
+	logrus.Infof("Format device %s as a LUKS2 device", devPath)
+	args := []string{"luksFormat", "--batch-mode", "--type=luks2", "--key-file=-"}
+	if uuid != "" {
+		args = append(args, "--uuid="+uuid)
+	}
+	args = append(args, devPath)
+	if _, err := e.executor.ExecuteWithStdin("cryptsetup", args, key); err != nil {
+		return fmt.Errorf("failed to format LUKS device %s: %w", devPath, err)
+	}
+	return nil
+}
+
+func (e *encryptor) Open(devPath, name string, key []byte) error {
+	if e.exists(mapperDir + name) {
+		return nil
+	}
+	logrus.Infof("Open LUKS device %s as %s", devPath, mapperDir+name)
+	if _, err := e.executor.ExecuteWithStdin("cryptsetup", []string{"open", "--type=luks", "--key-file=-", devPath, name}, key); err != nil {
+		return fmt.Errorf("failed to open LUKS device %s: %w", devPath, err)
+	}
+	return nil
+}
+
+func (e *encryptor) Close(name string) error {
+	if !e.exists(mapperDir + name) {
+		return nil
+	}
+	logrus.Infof("Close LUKS device %s", mapperDir+name)
+	if _, err := e.executor.Execute("cryptsetup", []string{"close", name}); err != nil {
+		return fmt.Errorf("failed to close LUKS device %s: %w", mapperDir+name, err)
+	}
+	return nil
+}
+
+func (e *encryptor) Resize(name string, key []byte) error {
+	logrus.Infof("Resize LUKS device %s", mapperDir+name)
+	if _, err := e.executor.ExecuteWithStdin("cryptsetup", []string{"resize", "--key-file=-", name}, key); err != nil {
+		return fmt.Errorf("failed to resize LUKS device %s: %w", mapperDir+name, err)
+	}
+	return nil
+}
+
+// MapperName returns the name of the opened LUKS device of a block device
+func MapperName(bdName string) string {
+	return mapperPrefix + bdName
+}
+
+// MapperPath returns the path of the opened LUKS device of a block device,
+// i.e. /dev/mapper/ndm-<name>
+func MapperPath(bdName string) string {
+	return mapperDir + MapperName(bdName)
+}
+
+// KeyFromSecret returns the key in the encryption Secret, which holds either a
+// passphrase or a keyfile. The trailing newline of the passphrase is trimmed,
+// so the device could be opened by typing the passphrase as well.
+func KeyFromSecret(secret *corev1.Secret) ([]byte, error) {
+	passphrase, hasPassphrase := secret.Data[SecretKeyPassphrase]
+	keyfile, hasKeyfile := secret.Data[SecretKeyKeyfile]
+	switch {
+	case hasPassphrase && hasKeyfile:
+		return nil, fmt.Errorf("secret %s/%s holds both %s and %s", secret.Namespace, secret.Name, SecretKeyPassphrase, SecretKeyKeyfile)
+	case hasPassphrase:
+		passphrase = bytes.TrimRight(passphrase, "\r\n")
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("%s of secret %s/%s is empty", SecretKeyPassphrase, secret.Namespace, secret.Name)
+		}
+		return passphrase, nil
+	case hasKeyfile:
+		if len(keyfile) == 0 {
+			return nil, fmt.Errorf("%s of secret %s/%s is empty", SecretKeyKeyfile, secret.Namespace, secret.Name)
+		}
+		return keyfile, nil
+	default:
+		return nil, fmt.Errorf("secret %s/%s holds neither %s nor %s", secret.Namespace, secret.Name, SecretKeyPassphrase, SecretKeyKeyfile)
+	}
+}
+
+func deviceExists(devPath string) bool {
+	_, err := os.Stat(devPath)
+	return err == nil
+}
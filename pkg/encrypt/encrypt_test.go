@@ -0,0 +1,114 @@
+package encrypt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeExecutor records the commands along with their stdin, and fails the
+// ones in errors.
+type fakeExecutor struct {
+	commands []string
+	errors   map[string]bool
+}
+
+func (f *fakeExecutor) Execute(cmd string, args []string) (string, error) {
+	return f.ExecuteWithStdin(cmd, args, nil)
+}
+
+func (f *fakeExecutor) ExecuteWithStdin(cmd string, args []string, stdin []byte) (string, error) {
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	if stdin != nil {
+		command += " < " + string(stdin)
+	}
+	f.commands = append(f.commands, command)
+	if f.errors[command] {
+		return "", fmt.Errorf("failed to run %s", command)
+	}
+	return "", nil
+}
+
+func Test_encryptor(t *testing.T) {
+	executor := &fakeExecutor{}
+	opened := map[string]bool{}
+	e := &encryptor{
+		executor: executor,
+		exists:   func(devPath string) bool { return opened[devPath] },
+	}
+	key := []byte("secret")
+
+	require.NoError(t, e.Format("/dev/sdb", "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e", key))
+	require.NoError(t, e.Format("/dev/sdc", "", key))
+	require.NoError(t, e.Open("/dev/sdb", MapperName("bd1"), key))
+	require.NoError(t, e.Resize(MapperName("bd1"), key))
+	// already opened
+	opened[MapperPath("bd1")] = true
+	require.NoError(t, e.Open("/dev/sdb", MapperName("bd1"), key))
+	require.NoError(t, e.Close(MapperName("bd1")))
+	// not opened
+	require.NoError(t, e.Close(MapperName("bd2")))
+
+	assert.Equal(t, []string{
+		"cryptsetup luksFormat --batch-mode --type=luks2 --key-file=- --uuid=6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e /dev/sdb < secret",
+		"cryptsetup luksFormat --batch-mode --type=luks2 --key-file=- /dev/sdc < secret",
+		"cryptsetup open --type=luks --key-file=- /dev/sdb ndm-bd1 < secret",
+		"cryptsetup resize --key-file=- ndm-bd1 < secret",
+		"cryptsetup close ndm-bd1",
+	}, executor.commands)
+}
+
+func Test_keyFromSecret(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		data      map[string][]byte
+		expectKey []byte
+		expectErr bool
+	}{
+		{
+			name:      "passphrase",
+			data:      map[string][]byte{SecretKeyPassphrase: []byte("correct horse battery staple\n")},
+			expectKey: []byte("correct horse battery staple"),
+		},
+		{
+			name:      "keyfile",
+			data:      map[string][]byte{SecretKeyKeyfile: {0x00, 0x0a, 0xff, 0x0a}},
+			expectKey: []byte{0x00, 0x0a, 0xff, 0x0a},
+		},
+		{
+			name:      "both",
+			data:      map[string][]byte{SecretKeyPassphrase: []byte("passphrase"), SecretKeyKeyfile: []byte("keyfile")},
+			expectErr: true,
+		},
+		{
+			name:      "empty passphrase",
+			data:      map[string][]byte{SecretKeyPassphrase: []byte("\n")},
+			expectErr: true,
+		},
+		{
+			name:      "neither",
+			data:      map[string][]byte{"password": []byte("secret")},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "disk-key", Namespace: "longhorn-system"},
+				Data:       tc.data,
+			}
+			key, err := KeyFromSecret(secret)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectKey, key)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// FakeRecorder keeps the events recorded in the form of "<type> <reason>
+// <message>", for tests.
+type FakeRecorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (f *FakeRecorder) Event(_ runtime.Object, eventType, reason, message string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.events = append(f.events, fmt.Sprintf("%s %s %s", eventType, reason, message))
+}
+
+func (f *FakeRecorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	f.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// Events returns the events recorded so far
+func (f *FakeRecorder) Events() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.events...)
+}
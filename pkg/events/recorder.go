@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/reference"
+)
+
+// Reasons of the events emitted for the lifecycle actions of block devices
+const (
+	ReasonFormatting        = "Formatting"
+	ReasonFormatted         = "Formatted"
+	ReasonFormatFailed      = "FormatFailed"
+	ReasonEncrypted         = "Encrypted"
+	ReasonMounted           = "Mounted"
+	ReasonUnmounted         = "Unmounted"
+	ReasonMountFailed       = "MountFailed"
+	ReasonCorrupted         = "Corrupted"
+	ReasonChecking          = "Checking"
+	ReasonChecked           = "Checked"
+	ReasonCheckFailed       = "CheckFailed"
+	ReasonProvisioned       = "Provisioned"
+	ReasonProvisionFailed   = "ProvisionFailed"
+	ReasonUnprovisioning    = "Unprovisioning"
+	ReasonUnprovisioned     = "Unprovisioned"
+	ReasonUnprovisionFailed = "UnprovisionFailed"
+	ReasonEvictionRequested = "EvictionRequested"
+	ReasonReplacing         = "Replacing"
+	ReasonReplaced          = "Replaced"
+	ReasonWiping            = "Wiping"
+	ReasonWiped             = "Wiped"
+	ReasonWipeFailed        = "WipeFailed"
+	ReasonPartitioned       = "Partitioned"
+	ReasonPartitionFailed   = "PartitionFailed"
+	ReasonExpanded          = "Expanded"
+	ReasonExpandFailed      = "ExpandFailed"
+	ReasonDeviceActive      = "DeviceActive"
+	ReasonDeviceInactive    = "DeviceInactive"
+)
+
+const (
+	// queueSize is the count of events waiting to be written, the events
+	// are dropped once the queue is full
+	queueSize = 1000
+	// maxCachedEvents is the count of events cached to aggregate the
+	// repeated ones, the cache is reset once it is full
+	maxCachedEvents = 4096
+	// aggregationWindow is how long a repeated event increases the count
+	// of the cached one, instead of being created as a new one
+	aggregationWindow = 10 * time.Minute
+)
+
+// Recorder records events of objects, in the same way as the EventRecorder
+// of client-go.
+type Recorder interface {
+	// Event records an event of the object, the type is either Normal or
+	// Warning, and the reason is a short CamelCase string.
+	Event(object runtime.Object, eventType, reason, message string)
+	// Eventf is just like Event, but with Sprintf for the message field.
+	Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{})
+}
+
+type recorder struct {
+	client typedcorev1.EventsGetter
+	scheme *runtime.Scheme
+	source corev1.EventSource
+	queue  chan *corev1.Event
+
+	lock  sync.Mutex
+	cache map[string]*corev1.Event
+}
+
+// NewRecorder returns a recorder writing the events of the objects of the
+// scheme in background until the context is done.
+func NewRecorder(ctx context.Context, client typedcorev1.EventsGetter, scheme *runtime.Scheme, component, host string) Recorder {
+	r := &recorder{
+		client: client,
+		scheme: scheme,
+		source: corev1.EventSource{Component: component, Host: host},
+		queue:  make(chan *corev1.Event, queueSize),
+		cache:  map[string]*corev1.Event{},
+	}
+	go r.run(ctx)
+	return r
+}
+
+func (r *recorder) Event(object runtime.Object, eventType, reason, message string) {
+	ref, err := reference.GetReference(r.scheme, object)
+	if err != nil {
+		logrus.Warnf("Failed to get reference of object %#v, skip event %s: %v", object, reason, err)
+		return
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: ref.Namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source:         r.source,
+	}
+	if event.Namespace == "" {
+		event.Namespace = metav1.NamespaceDefault
+	}
+	select {
+	case r.queue <- event:
+	default:
+		logrus.Warnf("Event queue is full, drop event %s of %s/%s: %s", reason, ref.Namespace, ref.Name, message)
+	}
+}
+
+func (r *recorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *recorder) run(ctx context.Context) {
+	for {
+		select {
+		case event := <-r.queue:
+			r.write(ctx, event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// write creates the event, or increases the count of the same event written
+// within the aggregation window.
+func (r *recorder) write(ctx context.Context, event *corev1.Event) {
+	key := eventKey(event)
+	r.lock.Lock()
+	cached, ok := r.cache[key]
+	r.lock.Unlock()
+
+	events := r.client.Events(event.Namespace)
+	if ok && event.LastTimestamp.Sub(cached.LastTimestamp.Time) < aggregationWindow {
+		updated := cached.DeepCopy()
+		updated.Count++
+		updated.LastTimestamp = event.LastTimestamp
+		result, err := events.Update(ctx, updated, metav1.UpdateOptions{})
+		if err == nil {
+			r.store(key, result)
+			return
+		}
+		if !apierrors.IsNotFound(err) {
+			logrus.Warnf("Failed to update event %s/%s: %v", updated.Namespace, updated.Name, err)
+			return
+		}
+	}
+
+	result, err := events.Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		logrus.Warnf("Failed to create event %s of %s/%s: %v", event.Reason, event.InvolvedObject.Namespace, event.InvolvedObject.Name, err)
+		return
+	}
+	r.store(key, result)
+}
+
+func (r *recorder) store(key string, event *corev1.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.cache[key]; !ok && len(r.cache) >= maxCachedEvents {
+		r.cache = map[string]*corev1.Event{}
+	}
+	r.cache[key] = event
+}
+
+func eventKey(event *corev1.Event) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.UID, event.Type, event.Reason, event.Message)
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+)
+
+type fakeEvents struct {
+	typedcorev1.EventInterface
+	events map[string]*corev1.Event
+}
+
+func (f *fakeEvents) Events(_ string) typedcorev1.EventInterface {
+	return f
+}
+
+func (f *fakeEvents) Create(_ context.Context, event *corev1.Event, _ metav1.CreateOptions) (*corev1.Event, error) {
+	f.events[event.Name] = event.DeepCopy()
+	return event, nil
+}
+
+func (f *fakeEvents) Update(_ context.Context, event *corev1.Event, _ metav1.UpdateOptions) (*corev1.Event, error) {
+	if _, ok := f.events[event.Name]; !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "events"}, event.Name)
+	}
+	f.events[event.Name] = event.DeepCopy()
+	return event, nil
+}
+
+func newTestRecorder(client typedcorev1.EventsGetter) *recorder {
+	scheme := runtime.NewScheme()
+	_ = diskv1.AddToScheme(scheme)
+	return &recorder{
+		client: client,
+		scheme: scheme,
+		source: corev1.EventSource{Component: "harvester-node-disk-manager", Host: "node1"},
+		queue:  make(chan *corev1.Event, queueSize),
+		cache:  map[string]*corev1.Event{},
+	}
+}
+
+// receive returns the event recorded in the queue, with the last timestamp
+// shifted by the offset
+func receive(t *testing.T, r *recorder, offset time.Duration) *corev1.Event {
+	select {
+	case event := <-r.queue:
+		event.LastTimestamp = metav1.NewTime(event.LastTimestamp.Add(offset))
+		return event
+	default:
+		require.FailNow(t, "no event is recorded")
+		return nil
+	}
+}
+
+func Test_recorder(t *testing.T) {
+	client := &fakeEvents{events: map[string]*corev1.Event{}}
+	r := newTestRecorder(client)
+	bd := &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd1", Namespace: "longhorn-system", UID: "uid1"},
+	}
+
+	r.Eventf(bd, corev1.EventTypeNormal, ReasonFormatted, "Formatted device %s with %s filesystem", "/dev/sdb", "ext4")
+	event := receive(t, r, 0)
+	assert.Equal(t, "longhorn-system", event.Namespace)
+	assert.Equal(t, "BlockDevice", event.InvolvedObject.Kind)
+	assert.Equal(t, "bd1", event.InvolvedObject.Name)
+	assert.Equal(t, "Formatted device /dev/sdb with ext4 filesystem", event.Message)
+	assert.Equal(t, "node1", event.Source.Host)
+	r.write(context.TODO(), event)
+	require.Len(t, client.events, 1)
+
+	// the same event is aggregated within the window
+	r.Eventf(bd, corev1.EventTypeNormal, ReasonFormatted, "Formatted device %s with %s filesystem", "/dev/sdb", "ext4")
+	r.write(context.TODO(), receive(t, r, time.Minute))
+	require.Len(t, client.events, 1)
+	for _, e := range client.events {
+		assert.Equal(t, int32(2), e.Count)
+	}
+
+	// a different event is created
+	r.Event(bd, corev1.EventTypeWarning, ReasonFormatFailed, "failed to format")
+	r.write(context.TODO(), receive(t, r, 2*time.Minute))
+	assert.Len(t, client.events, 2)
+
+	// the same event is created again after the window
+	r.Eventf(bd, corev1.EventTypeNormal, ReasonFormatted, "Formatted device %s with %s filesystem", "/dev/sdb", "ext4")
+	r.write(context.TODO(), receive(t, r, time.Minute+aggregationWindow))
+	assert.Len(t, client.events, 3)
+
+	// an object out of the scheme is skipped
+	r.Event(&corev1.Pod{}, corev1.EventTypeNormal, ReasonMounted, "mounted")
+	assert.Len(t, r.queue, 0)
+}
@@ -0,0 +1,31 @@
+package filter
+
+import (
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	busPathFilterName = "bus path filter"
+)
+
+// busPathFilter filters disk based on given bus path glob or regex patterns,
+// e.g. "*-usb-*" for the USB-attached disks.
+type busPathFilter struct {
+	busPaths []*pattern
+}
+
+func RegisterBusPathFilter(filters ...string) (*Filter, error) {
+	patterns, err := newPatterns(busPathFilterName, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		Name:       busPathFilterName,
+		DiskFilter: &busPathFilter{busPaths: patterns},
+	}, nil
+}
+
+// Match returns true if bus path of the disk matches the pattern
+func (f *busPathFilter) Match(disk *block.Disk) bool {
+	return matchPatterns(disk.BusPath, f.busPaths)
+}
@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ConfigKeyVendorFilter        = "vendorFilter"
+	ConfigKeyPathFilter          = "pathFilter"
+	ConfigKeyLabelFilter         = "labelFilter"
+	ConfigKeyPartTypeFilter      = "partTypeFilter"
+	ConfigKeyAutoProvisionFilter = "autoProvisionFilter"
+
+	ConfigKeySizeFilter              = "sizeFilter"
+	ConfigKeyModelFilter             = "modelFilter"
+	ConfigKeySerialFilter            = "serialFilter"
+	ConfigKeyWWNFilter               = "wwnFilter"
+	ConfigKeyBusPathFilter           = "busPathFilter"
+	ConfigKeyStorageControllerFilter = "storageControllerFilter"
+
+	ConfigKeyExcludeExpression       = "excludeExpression"
+	ConfigKeyAutoProvisionExpression = "autoProvisionExpression"
+)
+
+// Config holds the comma-separated patterns the exclude and auto-provision
+// filters are built from.
+type Config struct {
+	VendorFilter        string
+	PathFilter          string
+	LabelFilter         string
+	PartTypeFilter      string
+	AutoProvisionFilter string
+
+	SizeFilter              string
+	ModelFilter             string
+	SerialFilter            string
+	WWNFilter               string
+	BusPathFilter           string
+	StorageControllerFilter string
+
+	ExcludeExpression       string
+	AutoProvisionExpression string
+}
+
+// ExcludeFilters builds the exclude filters of the config, and fails if any
+// of the size ranges, the hardware patterns or the exclude expression is
+// invalid.
+func (c Config) ExcludeFilters() ([]*Filter, error) {
+	expressionFilters, err := RegisterExpressionFilters(c.ExcludeExpression)
+	if err != nil {
+		return nil, err
+	}
+	hardwareFilters, err := SetHardwareExcludeFilters(c.SizeFilter, c.ModelFilter, c.SerialFilter,
+		c.WWNFilter, c.BusPathFilter, c.StorageControllerFilter)
+	if err != nil {
+		return nil, err
+	}
+	filters := SetExcludeFilters(c.VendorFilter, c.PathFilter, c.LabelFilter, c.PartTypeFilter)
+	filters = append(filters, hardwareFilters...)
+	return append(filters, expressionFilters...), nil
+}
+
+// AutoProvisionFilters builds the auto-provision filters of the config, and
+// fails if the auto-provision expression is invalid.
+func (c Config) AutoProvisionFilters() ([]*Filter, error) {
+	expressionFilters, err := RegisterExpressionFilters(c.AutoProvisionExpression)
+	if err != nil {
+		return nil, err
+	}
+	return append(SetAutoProvisionFilters(c.AutoProvisionFilter), expressionFilters...), nil
+}
+
+// ParseConfigData overrides the patterns of the config with the ones set in
+// the data of a ConfigMap. The patterns of a node could be overridden again
+// in a YAML document under the key of the node name, e.g.
+//
+//	vendorFilter: "longhorn"
+//	node1: |
+//	  vendorFilter: "longhorn,QEMU"
+//
+// A pattern set to an empty string overrides the default one as well.
+func ParseConfigData(data map[string]string, nodeName string, defaults Config) (Config, error) {
+	config := defaults
+	config.override(data)
+
+	if nodeData, ok := data[nodeName]; ok {
+		nodeConfig := map[string]string{}
+		if err := yaml.UnmarshalStrict([]byte(nodeData), &nodeConfig); err != nil {
+			return defaults, fmt.Errorf("failed to parse the filters of node %s: %w", nodeName, err)
+		}
+		for key := range nodeConfig {
+			if _, ok := config.fields()[key]; !ok {
+				return defaults, fmt.Errorf("unknown filter %s of node %s", key, nodeName)
+			}
+		}
+		config.override(nodeConfig)
+	}
+	return config, nil
+}
+
+func (c *Config) fields() map[string]*string {
+	return map[string]*string{
+		ConfigKeyVendorFilter:        &c.VendorFilter,
+		ConfigKeyPathFilter:          &c.PathFilter,
+		ConfigKeyLabelFilter:         &c.LabelFilter,
+		ConfigKeyPartTypeFilter:      &c.PartTypeFilter,
+		ConfigKeyAutoProvisionFilter: &c.AutoProvisionFilter,
+
+		ConfigKeySizeFilter:              &c.SizeFilter,
+		ConfigKeyModelFilter:             &c.ModelFilter,
+		ConfigKeySerialFilter:            &c.SerialFilter,
+		ConfigKeyWWNFilter:               &c.WWNFilter,
+		ConfigKeyBusPathFilter:           &c.BusPathFilter,
+		ConfigKeyStorageControllerFilter: &c.StorageControllerFilter,
+
+		ConfigKeyExcludeExpression:       &c.ExcludeExpression,
+		ConfigKeyAutoProvisionExpression: &c.AutoProvisionExpression,
+	}
+}
+
+func (c *Config) override(data map[string]string) {
+	for key, field := range c.fields() {
+		if value, ok := data[key]; ok {
+			*field = value
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseConfigData(t *testing.T) {
+	defaults := Config{VendorFilter: "longhorn", AutoProvisionFilter: "/dev/sdb"}
+	var testCases = []struct {
+		name      string
+		data      map[string]string
+		expected  Config
+		expectErr bool
+	}{
+		{
+			name:     "empty data",
+			expected: defaults,
+		},
+		{
+			name: "override the defaults",
+			data: map[string]string{
+				ConfigKeyVendorFilter:   "longhorn,QEMU",
+				ConfigKeyPartTypeFilter: "c12a7328-f81f-11d2-ba4b-00a0c93ec93b",
+			},
+			expected: Config{VendorFilter: "longhorn,QEMU", PartTypeFilter: "c12a7328-f81f-11d2-ba4b-00a0c93ec93b", AutoProvisionFilter: "/dev/sdb"},
+		},
+		{
+			name:     "clear a default",
+			data:     map[string]string{ConfigKeyAutoProvisionFilter: ""},
+			expected: Config{VendorFilter: "longhorn"},
+		},
+		{
+			name: "override the node",
+			data: map[string]string{
+				ConfigKeyLabelFilter: "COS_*",
+				"node1":              "labelFilter: COS_OEM\nautoProvisionFilter: /dev/nvme*",
+				"node2":              "labelFilter: \"\"",
+			},
+			expected: Config{VendorFilter: "longhorn", LabelFilter: "COS_OEM", AutoProvisionFilter: "/dev/nvme*"},
+		},
+		{
+			name: "override the hardware filters of the node",
+			data: map[string]string{
+				"node1": "sizeFilter: \"-64Gi\"\nbusPathFilter: \"*-usb-*\"",
+			},
+			expected: Config{VendorFilter: "longhorn", AutoProvisionFilter: "/dev/sdb", SizeFilter: "-64Gi", BusPathFilter: "*-usb-*"},
+		},
+		{
+			name:      "unknown filter of the node",
+			data:      map[string]string{"node1": "speedFilter: 1Gi"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid node filters",
+			data:      map[string]string{"node1": "- vendorFilter"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ParseConfigData(tc.data, "node1", defaults)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, config)
+		})
+	}
+}
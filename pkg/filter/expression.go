@@ -0,0 +1,505 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	expressionFilterName = "expression filter"
+)
+
+// CompileExpression compiles a filter expression into a filter matching both
+// disks and partitions, e.g.
+//
+//	driveType == "HDD" && size < 500Gi && !vendor.matches("X*")
+//
+// An expression is made of comparisons of the device fields, combined by
+// "&&", "||", "!" and parentheses. String fields are compared ignoring cases
+// with "==" and "!=", or matched with glob patterns by ".matches()", which
+// takes regular expressions prefixed with "regex:" as well. The size field
+// is compared with quantities, e.g. "500Gi", by "==", "!=", "<", "<=", ">"
+// and ">=". For partitions, the disk fields, e.g. vendor, are the ones of
+// their disks.
+func CompileExpression(expression string) (*Filter, error) {
+	p := &exprParser{lexer: &exprLexer{input: expression}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, p.errorf("unexpected %s", p.token)
+	}
+	f := &expressionFilter{node: node}
+	return &Filter{
+		Name:       fmt.Sprintf("%s %q", expressionFilterName, expression),
+		PartFilter: f,
+		DiskFilter: &diskExpressionFilter{filter: f},
+	}, nil
+}
+
+// RegisterExpressionFilters compiles the non-empty expressions, and fails on
+// the first invalid one.
+func RegisterExpressionFilters(expressions ...string) ([]*Filter, error) {
+	var filters []*Filter
+	for _, expression := range expressions {
+		if strings.TrimSpace(expression) == "" {
+			continue
+		}
+		f, err := CompileExpression(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter expression %q: %w", expression, err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// expressionFilter filters partition if the expression is true for it
+type expressionFilter struct {
+	node exprNode
+}
+
+// diskExpressionFilter filters disk if the expression is true for it
+type diskExpressionFilter struct {
+	filter *expressionFilter
+}
+
+// Match returns true if the expression is true for the partition
+func (f *expressionFilter) Match(part *block.Partition) bool {
+	return f.node.eval(&exprDevice{disk: part.Disk, part: part})
+}
+
+// Match returns true if the expression is true for the disk
+func (f *diskExpressionFilter) Match(disk *block.Disk) bool {
+	return f.filter.node.eval(&exprDevice{disk: disk})
+}
+
+// exprDevice is either a disk or a partition of the disk, whose disk might be
+// unknown.
+type exprDevice struct {
+	disk *block.Disk
+	part *block.Partition
+}
+
+type exprFieldKind int
+
+const (
+	stringField exprFieldKind = iota
+	sizeField
+)
+
+type exprField struct {
+	kind  exprFieldKind
+	value func(d *exprDevice) string
+	size  func(d *exprDevice) uint64
+}
+
+// diskValue returns the value of the disk field, or an empty string for the
+// partition without the disk.
+func diskValue(value func(disk *block.Disk) string) func(d *exprDevice) string {
+	return func(d *exprDevice) string {
+		if d.disk == nil {
+			return ""
+		}
+		return value(d.disk)
+	}
+}
+
+var exprFields = map[string]exprField{
+	"name": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.Name
+		}
+		return d.disk.Name
+	}},
+	"devPath": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return "/dev/" + d.part.Name
+		}
+		return "/dev/" + d.disk.Name
+	}},
+	"size": {kind: sizeField, size: func(d *exprDevice) uint64 {
+		if d.part != nil {
+			return d.part.SizeBytes
+		}
+		return d.disk.SizeBytes
+	}},
+	"driveType": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.DriveType.String()
+		}
+		return d.disk.DriveType.String()
+	}},
+	"storageController": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.StorageController.String()
+		}
+		return d.disk.StorageController.String()
+	}},
+	"label": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.Label
+		}
+		return d.disk.Label
+	}},
+	"fsType": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.FileSystemInfo.Type
+		}
+		return d.disk.FileSystemInfo.Type
+	}},
+	"mountPoint": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.FileSystemInfo.MountPoint
+		}
+		return d.disk.FileSystemInfo.MountPoint
+	}},
+	"partType": {value: func(d *exprDevice) string {
+		if d.part != nil {
+			return d.part.PartType
+		}
+		return ""
+	}},
+	"vendor":  {value: diskValue(func(disk *block.Disk) string { return disk.Vendor })},
+	"model":   {value: diskValue(func(disk *block.Disk) string { return disk.Model })},
+	"serial":  {value: diskValue(func(disk *block.Disk) string { return disk.SerialNumber })},
+	"wwn":     {value: diskValue(func(disk *block.Disk) string { return disk.WWN })},
+	"busPath": {value: diskValue(func(disk *block.Disk) string { return disk.BusPath })},
+}
+
+type exprNode interface {
+	eval(d *exprDevice) bool
+}
+
+type notNode struct {
+	x exprNode
+}
+
+func (n *notNode) eval(d *exprDevice) bool {
+	return !n.x.eval(d)
+}
+
+type andNode struct {
+	left, right exprNode
+}
+
+func (n *andNode) eval(d *exprDevice) bool {
+	return n.left.eval(d) && n.right.eval(d)
+}
+
+type orNode struct {
+	left, right exprNode
+}
+
+func (n *orNode) eval(d *exprDevice) bool {
+	return n.left.eval(d) || n.right.eval(d)
+}
+
+type stringCompareNode struct {
+	field exprField
+	equal bool
+	value string
+}
+
+func (n *stringCompareNode) eval(d *exprDevice) bool {
+	return strings.EqualFold(n.field.value(d), n.value) == n.equal
+}
+
+type sizeCompareNode struct {
+	field exprField
+	op    string
+	value uint64
+}
+
+func (n *sizeCompareNode) eval(d *exprDevice) bool {
+	size := n.field.size(d)
+	switch n.op {
+	case "==":
+		return size == n.value
+	case "!=":
+		return size != n.value
+	case "<":
+		return size < n.value
+	case "<=":
+		return size <= n.value
+	case ">":
+		return size > n.value
+	default:
+		return size >= n.value
+	}
+}
+
+type matchNode struct {
+	field   exprField
+	pattern *pattern
+}
+
+func (n *matchNode) eval(d *exprDevice) bool {
+	return matchPatterns(n.field.value(d), []*pattern{n.pattern})
+}
+
+type exprTokenKind int
+
+const (
+	tokenEOF exprTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	value string
+	pos   int
+}
+
+func (t exprToken) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.value)
+}
+
+type exprLexer struct {
+	input string
+	pos   int
+}
+
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "."}
+
+func (l *exprLexer) next() (exprToken, error) {
+	for l.pos < len(l.input) && unicode.IsSpace(rune(l.input[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return exprToken{kind: tokenEOF, pos: start}, nil
+	}
+
+	c := l.input[l.pos]
+	switch {
+	case c == '"':
+		for l.pos++; l.pos < len(l.input) && l.input[l.pos] != '"'; l.pos++ {
+			if l.input[l.pos] == '\\' {
+				l.pos++
+			}
+		}
+		if l.pos >= len(l.input) {
+			return exprToken{}, fmt.Errorf("unterminated string at position %d", start)
+		}
+		l.pos++
+		value, err := strconv.Unquote(l.input[start:l.pos])
+		if err != nil {
+			return exprToken{}, fmt.Errorf("invalid string at position %d: %w", start, err)
+		}
+		return exprToken{kind: tokenString, value: value, pos: start}, nil
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.input) && (isIdentChar(l.input[l.pos]) || l.input[l.pos] == '.') {
+			l.pos++
+		}
+		return exprToken{kind: tokenNumber, value: l.input[start:l.pos], pos: start}, nil
+	case isIdentChar(c):
+		for l.pos < len(l.input) && isIdentChar(l.input[l.pos]) {
+			l.pos++
+		}
+		return exprToken{kind: tokenIdent, value: l.input[start:l.pos], pos: start}, nil
+	}
+	for _, op := range exprOperators {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return exprToken{kind: tokenOperator, value: op, pos: start}, nil
+		}
+	}
+	return exprToken{}, fmt.Errorf("unexpected character %q at position %d", c, start)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// exprParser is a recursive descent parser of the grammar:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | primary
+//	primary    = "(" or ")" | field ( compareOp value | ".matches(" string ")" )
+type exprParser struct {
+	lexer *exprLexer
+	token exprToken
+}
+
+func (p *exprParser) next() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.token.pos)
+}
+
+func (p *exprParser) isOperator(op string) bool {
+	return p.token.kind == tokenOperator && p.token.value == op
+}
+
+func (p *exprParser) expectOperator(op string) error {
+	if !p.isOperator(op) {
+		return p.errorf("expected %q but got %s", op, p.token)
+	}
+	return p.next()
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if !p.isOperator("!") {
+		return p.parsePrimary()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &notNode{x: x}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.isOperator("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expectOperator(")")
+	}
+
+	if p.token.kind != tokenIdent {
+		return nil, p.errorf("expected a field but got %s", p.token)
+	}
+	name := p.token.value
+	field, ok := exprFields[name]
+	if !ok {
+		return nil, p.errorf("unknown field %q", name)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.isOperator(".") {
+		return p.parseMatches(name, field)
+	}
+	return p.parseCompare(name, field)
+}
+
+func (p *exprParser) parseMatches(name string, field exprField) (exprNode, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenIdent || p.token.value != "matches" {
+		return nil, p.errorf("expected \"matches\" but got %s", p.token)
+	}
+	if field.kind != stringField {
+		return nil, p.errorf("field %q does not support matches", name)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.expectOperator("("); err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenString {
+		return nil, p.errorf("expected a string pattern but got %s", p.token)
+	}
+	pattern, err := compilePattern(p.token.value)
+	if err != nil {
+		return nil, p.errorf("%s", err.Error())
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return &matchNode{field: field, pattern: pattern}, p.expectOperator(")")
+}
+
+func (p *exprParser) parseCompare(name string, field exprField) (exprNode, error) {
+	if p.token.kind != tokenOperator {
+		return nil, p.errorf("expected a comparison operator but got %s", p.token)
+	}
+	op := p.token.value
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	switch field.kind {
+	case sizeField:
+		switch op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, p.errorf("unexpected operator %q of field %q", op, name)
+		}
+		if p.token.kind != tokenNumber {
+			return nil, p.errorf("expected a size but got %s", p.token)
+		}
+		size, err := parseSize(p.token.value)
+		if err != nil {
+			return nil, p.errorf("%s", err.Error())
+		}
+		return &sizeCompareNode{field: field, op: op, value: size}, p.next()
+	default:
+		if op != "==" && op != "!=" {
+			return nil, p.errorf("unexpected operator %q of field %q", op, name)
+		}
+		if p.token.kind != tokenString {
+			return nil, p.errorf("expected a string but got %s", p.token)
+		}
+		return &stringCompareNode{field: field, equal: op == "==", value: p.token.value}, p.next()
+	}
+}
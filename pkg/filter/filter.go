@@ -22,7 +22,7 @@ func SetAutoProvisionFilters(devPathString string) []*Filter {
 	return []*Filter{devPathFilter}
 }
 
-func SetExcludeFilters(vendorString, pathString, labelString string) []*Filter {
+func SetExcludeFilters(vendorString, pathString, labelString, partTypeString string) []*Filter {
 	logrus.Info("register exclude filters")
 
 	driveTypeFilter := RegisterDriveTypeFilter()
@@ -38,11 +38,41 @@ func SetExcludeFilters(vendorString, pathString, labelString string) []*Filter {
 	labels := strings.Split(labelString, ",")
 	labelFilter := RegisterLabelFilter(labels...)
 
-	partTypeFilters := RegisterPartTypeFilter(defaultExcludedPartTypes...)
+	partTypes := strings.Split(partTypeString, ",")
+	partTypes = append(partTypes, defaultExcludedPartTypes...)
+	partTypeFilters := RegisterPartTypeFilter(partTypes...)
 
 	return []*Filter{driveTypeFilter, vendorFilter, pathFilter, labelFilter, partTypeFilters}
 }
 
+// SetHardwareExcludeFilters registers the exclude filters matching the
+// hardware attributes of disks. Except for the size ranges, the values are
+// glob patterns, or regular expressions if prefixed with "regex:". It fails
+// if any of the size ranges or patterns is invalid.
+func SetHardwareExcludeFilters(sizeString, modelString, serialString, wwnString, busPathString, storageControllerString string) ([]*Filter, error) {
+	logrus.Info("register hardware exclude filters")
+
+	var filters []*Filter
+	for _, r := range []struct {
+		register func(filters ...string) (*Filter, error)
+		value    string
+	}{
+		{register: RegisterSizeFilter, value: sizeString},
+		{register: RegisterModelFilter, value: modelString},
+		{register: RegisterSerialFilter, value: serialString},
+		{register: RegisterWWNFilter, value: wwnString},
+		{register: RegisterBusPathFilter, value: busPathString},
+		{register: RegisterStorageControllerFilter, value: storageControllerString},
+	} {
+		filter, err := r.register(strings.Split(r.value, ",")...)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
 type DiskFilter interface {
 	// Match returns true if passing disk matches with the value
 	Match(disk *block.Disk) bool
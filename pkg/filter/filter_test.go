@@ -5,6 +5,7 @@ import (
 
 	ghwblock "github.com/jaypipes/ghw/pkg/block"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/harvester/node-disk-manager/pkg/block"
 )
@@ -482,3 +483,212 @@ func Test_driveTypeFilter(t *testing.T) {
 		})
 	}
 }
+
+func Test_sizeFilter(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		size     uint64
+		ranges   []string
+		expected bool
+		err      bool
+	}{
+		{name: "up to the maximum size", size: 32 << 30, ranges: []string{"-64Gi"}, expected: true},
+		{name: "larger than the maximum size", size: 128 << 30, ranges: []string{"-64Gi"}},
+		{name: "from the minimum size", size: 16 << 40, ranges: []string{"16Ti-"}, expected: true},
+		{name: "smaller than the minimum size", size: 8 << 40, ranges: []string{"16Ti-"}},
+		{name: "in the range", size: 1 << 40, ranges: []string{"500G-2T"}, expected: true},
+		{name: "in one of the ranges", size: 1 << 40, ranges: []string{"-64Gi", "1Ti-2Ti"}, expected: true},
+		{name: "unknown size", size: 0, ranges: []string{"-64Gi"}},
+		{name: "empty range", size: 32 << 30, ranges: nil},
+		{name: "invalid range without separator", size: 32 << 30, ranges: []string{"64Gi"}, err: true},
+		{name: "invalid range without ends", size: 32 << 30, ranges: []string{"-"}, err: true},
+		{name: "invalid reversed range", size: 32 << 30, ranges: []string{"64Gi-16Gi"}, err: true},
+		{name: "invalid quantity", size: 32 << 30, ranges: []string{"-64GB"}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := RegisterSizeFilter(tc.ranges...)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			result := filter.ApplyDiskFilter(&block.Disk{SizeBytes: tc.size})
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func Test_diskAttributeFilters(t *testing.T) {
+	disk := &block.Disk{
+		Model:             "PERC H730P Mini",
+		SerialNumber:      "00c1a2b3d4e5f6a7",
+		WWN:               "0x5002538e4095a5b2",
+		BusPath:           "pci-0000:00:14.0-usb-0:3:1.0-scsi-0:0:0:0",
+		StorageController: ghwblock.STORAGE_CONTROLLER_SCSI,
+	}
+	var testCases = []struct {
+		name     string
+		register func(filters ...string) (*Filter, error)
+		disk     *block.Disk
+		patterns []string
+		expected bool
+		err      bool
+	}{
+		{name: "model", register: RegisterModelFilter, disk: disk, patterns: []string{"PERC H730P Mini"}, expected: true},
+		{name: "model glob ignoring cases", register: RegisterModelFilter, disk: disk, patterns: []string{"perc *"}, expected: true},
+		{name: "model regex", register: RegisterModelFilter, disk: disk, patterns: []string{"regex:^PERC H7[0-9]0"}, expected: true},
+		{name: "model regex with cases", register: RegisterModelFilter, disk: disk, patterns: []string{"regex:^perc"}},
+		{name: "model mismatch", register: RegisterModelFilter, disk: disk, patterns: []string{"Samsung*"}},
+		{name: "unknown model", register: RegisterModelFilter, disk: &block.Disk{Model: "unknown"}, patterns: []string{"*"}},
+		{name: "invalid model regex", register: RegisterModelFilter, disk: disk, patterns: []string{"regex:PERC ("}, err: true},
+		{name: "invalid model glob", register: RegisterModelFilter, disk: disk, patterns: []string{"PERC ["}, err: true},
+		{name: "serial", register: RegisterSerialFilter, disk: disk, patterns: []string{"mismatch", "00c1a2b3d4e5f6a7"}, expected: true},
+		{name: "serial glob", register: RegisterSerialFilter, disk: disk, patterns: []string{"00C1*"}, expected: true},
+		{name: "serial mismatch", register: RegisterSerialFilter, disk: disk, patterns: []string{"00c1"}},
+		{name: "empty serial", register: RegisterSerialFilter, disk: &block.Disk{}, patterns: []string{"*"}},
+		{name: "WWN", register: RegisterWWNFilter, disk: disk, patterns: []string{"0x5002538E4095A5B2"}, expected: true},
+		{name: "WWN regex", register: RegisterWWNFilter, disk: disk, patterns: []string{"regex:^0x5002538e"}, expected: true},
+		{name: "WWN mismatch", register: RegisterWWNFilter, disk: disk, patterns: []string{"0x5000c500*"}},
+		{name: "bus path", register: RegisterBusPathFilter, disk: disk, patterns: []string{"*-usb-*"}, expected: true},
+		{name: "bus path mismatch", register: RegisterBusPathFilter, disk: disk, patterns: []string{"*-nvme-*"}},
+		{name: "storage controller", register: RegisterStorageControllerFilter, disk: disk, patterns: []string{"scsi"}, expected: true},
+		{name: "storage controller mismatch", register: RegisterStorageControllerFilter, disk: disk, patterns: []string{"virtio", "MMC"}},
+		{name: "unknown storage controller", register: RegisterStorageControllerFilter, disk: &block.Disk{}, patterns: []string{"*"}},
+		{name: "empty pattern", register: RegisterModelFilter, disk: disk, patterns: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := tc.register(tc.patterns...)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			result := filter.ApplyDiskFilter(tc.disk)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func Test_storageControllerPartFilter(t *testing.T) {
+	filter, err := RegisterStorageControllerFilter("virtio")
+	require.NoError(t, err)
+	assert.True(t, filter.ApplyPartFilter(&block.Partition{StorageController: ghwblock.STORAGE_CONTROLLER_VIRTIO}))
+	assert.False(t, filter.ApplyPartFilter(&block.Partition{StorageController: ghwblock.STORAGE_CONTROLLER_NVME}))
+}
+
+func Test_expressionFilter(t *testing.T) {
+	hdd := &block.Disk{
+		Name:              "sdb",
+		SizeBytes:         300 << 30,
+		DriveType:         ghwblock.DRIVE_TYPE_HDD,
+		StorageController: ghwblock.STORAGE_CONTROLLER_SCSI,
+		Vendor:            "SEAGATE",
+		Model:             "ST300MM0048",
+		BusPath:           "pci-0000:00:1f.2-ata-2",
+	}
+	part := &block.Partition{
+		Disk:      hdd,
+		Name:      "sdb1",
+		Label:     "COS_OEM",
+		SizeBytes: 64 << 20,
+		DriveType: ghwblock.DRIVE_TYPE_HDD,
+		PartType:  "0fc63daf-8483-4772-8e79-3d69d8477de4",
+	}
+	var testCases = []struct {
+		name       string
+		expression string
+		disk       *block.Disk
+		part       *block.Partition
+		expected   bool
+	}{
+		{name: "string equality ignoring cases", expression: `driveType == "hdd"`, disk: hdd, expected: true},
+		{name: "string inequality", expression: `driveType != "HDD"`, disk: hdd},
+		{name: "size less than", expression: `size < 500Gi`, disk: hdd, expected: true},
+		{name: "size greater than or equal to", expression: `size >= 300Gi`, disk: hdd, expected: true},
+		{name: "size greater than", expression: `size > 300Gi`, disk: hdd},
+		{name: "glob matching", expression: `model.matches("ST300*")`, disk: hdd, expected: true},
+		{name: "regex matching", expression: `busPath.matches("regex:-ata-[0-9]+$")`, disk: hdd, expected: true},
+		{
+			name:       "and with not",
+			expression: `driveType == "HDD" && size < 500Gi && !vendor.matches("X*")`,
+			disk:       hdd,
+			expected:   true,
+		},
+		{
+			name:       "and with negated match",
+			expression: `driveType == "HDD" && size < 500Gi && !vendor.matches("SEA*")`,
+			disk:       hdd,
+		},
+		{name: "or", expression: `vendor == "X" || storageController == "SCSI"`, disk: hdd, expected: true},
+		{name: "and takes precedence over or", expression: `vendor == "X" && size > 0 || name == "sdb"`, disk: hdd, expected: true},
+		{name: "parentheses", expression: `vendor == "X" && (size > 0 || name == "sdb")`, disk: hdd},
+		{name: "double negation", expression: `!!(devPath == "/dev/sdb")`, disk: hdd, expected: true},
+		{name: "partition fields", expression: `label == "COS_OEM" && size < 1Gi`, part: part, expected: true},
+		{name: "disk fields of partition", expression: `vendor == "SEAGATE" && devPath == "/dev/sdb1"`, part: part, expected: true},
+		{name: "partition type of disk", expression: `partType.matches("*")`, disk: hdd},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := CompileExpression(tc.expression)
+			require.NoError(t, err)
+			if tc.disk != nil {
+				assert.Equal(t, tc.expected, filter.ApplyDiskFilter(tc.disk))
+			}
+			if tc.part != nil {
+				assert.Equal(t, tc.expected, filter.ApplyPartFilter(tc.part))
+			}
+		})
+	}
+}
+
+func Test_invalidExpression(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		expression string
+		errMsg     string
+	}{
+		{name: "empty", expression: ``, errMsg: "expected a field but got end of expression at position 0"},
+		{name: "unknown field", expression: `speed > 1`, errMsg: `unknown field "speed" at position 0`},
+		{name: "missing value", expression: `vendor ==`, errMsg: "expected a string but got end of expression at position 9"},
+		{name: "unterminated string", expression: `vendor == "X`, errMsg: "unterminated string at position 10"},
+		{name: "size compared with string", expression: `size < "1Gi"`, errMsg: `expected a size but got "1Gi" at position 7`},
+		{name: "invalid size", expression: `size < 1GB`, errMsg: "invalid size 1GB"},
+		{name: "string compared by less than", expression: `vendor < "X"`, errMsg: `unexpected operator "<" of field "vendor" at position 9`},
+		{name: "matches on size", expression: `size.matches("1*")`, errMsg: `field "size" does not support matches`},
+		{name: "unknown method", expression: `vendor.contains("X")`, errMsg: `expected "matches" but got "contains" at position 7`},
+		{name: "invalid pattern", expression: `vendor.matches("regex:(")`, errMsg: "invalid regex pattern regex:("},
+		{name: "unbalanced parentheses", expression: `(vendor == "X"`, errMsg: `expected ")" but got end of expression at position 14`},
+		{name: "trailing token", expression: `vendor == "X" vendor`, errMsg: `unexpected "vendor" at position 14`},
+		{name: "single ampersand", expression: `vendor == "X" & size > 0`, errMsg: `unexpected character '&' at position 14`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileExpression(tc.expression)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.errMsg)
+		})
+	}
+}
+
+func Test_configFiltersWithExpressions(t *testing.T) {
+	config := Config{
+		ExcludeExpression:       `driveType == "HDD" && size < 500Gi`,
+		AutoProvisionExpression: `busPath.matches("*-nvme-*")`,
+	}
+	excludeFilters, err := config.ExcludeFilters()
+	require.NoError(t, err)
+	assert.Equal(t, `expression filter "driveType == \"HDD\" && size < 500Gi"`, excludeFilters[len(excludeFilters)-1].Name)
+	autoProvisionFilters, err := config.AutoProvisionFilters()
+	require.NoError(t, err)
+	assert.Len(t, autoProvisionFilters, 2)
+
+	config.AutoProvisionExpression = `busPath.matches(`
+	_, err = config.AutoProvisionFilters()
+	assert.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	modelFilterName = "model filter"
+)
+
+// modelFilter filters disk based on given model glob or regex patterns
+type modelFilter struct {
+	models []*pattern
+}
+
+func RegisterModelFilter(filters ...string) (*Filter, error) {
+	patterns, err := newPatterns(modelFilterName, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		Name:       modelFilterName,
+		DiskFilter: &modelFilter{models: patterns},
+	}, nil
+}
+
+// Match returns true if model of the disk matches the pattern
+func (f *modelFilter) Match(disk *block.Disk) bool {
+	return matchPatterns(disk.Model, f.models)
+}
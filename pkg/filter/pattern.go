@@ -0,0 +1,76 @@
+package filter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ghwutil "github.com/jaypipes/ghw/pkg/util"
+)
+
+// regexPatternPrefix marks a pattern as a regular expression, the others are
+// glob patterns.
+const regexPatternPrefix = "regex:"
+
+// pattern matches a value against a case-insensitive glob pattern, or a
+// regular expression if it is prefixed with "regex:", e.g. "regex:^PERC H7[0-9]0".
+type pattern struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+// newPatterns compiles the non-empty patterns, and fails on an invalid one,
+// since a filter silently dropping it would not exclude the disks it is meant
+// to protect.
+func newPatterns(filterName string, filters ...string) ([]*pattern, error) {
+	var patterns []*pattern
+	for _, filter := range filters {
+		if filter == "" {
+			continue
+		}
+		p, err := compilePattern(filter)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filterName, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func compilePattern(filter string) (*pattern, error) {
+	if !strings.HasPrefix(filter, regexPatternPrefix) {
+		if _, err := filepath.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %s: %w", filter, err)
+		}
+		return &pattern{glob: strings.ToLower(filter)}, nil
+	}
+	regex, err := regexp.Compile(strings.TrimPrefix(filter, regexPatternPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern %s: %w", filter, err)
+	}
+	return &pattern{regex: regex}, nil
+}
+
+func (p *pattern) match(value string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(value)
+	}
+	// the glob pattern is validated while being compiled
+	ok, _ := filepath.Match(p.glob, strings.ToLower(value))
+	return ok
+}
+
+// matchPatterns returns true if the value is known and matches any of the
+// patterns.
+func matchPatterns(value string, patterns []*pattern) bool {
+	if value == "" || value == ghwutil.UNKNOWN {
+		return false
+	}
+	for _, p := range patterns {
+		if p.match(value) {
+			return true
+		}
+	}
+	return false
+}
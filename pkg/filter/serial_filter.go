@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	serialFilterName = "serial number filter"
+)
+
+// serialFilter filters disk based on given serial number glob or regex patterns
+type serialFilter struct {
+	serials []*pattern
+}
+
+func RegisterSerialFilter(filters ...string) (*Filter, error) {
+	patterns, err := newPatterns(serialFilterName, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		Name:       serialFilterName,
+		DiskFilter: &serialFilter{serials: patterns},
+	}, nil
+}
+
+// Match returns true if serial number of the disk matches the pattern
+func (f *serialFilter) Match(disk *block.Disk) bool {
+	return matchPatterns(disk.SerialNumber, f.serials)
+}
@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	sizeFilterName = "size filter"
+)
+
+// sizeRange is an inclusive range of sizes in bytes, 0 for an open end.
+type sizeRange struct {
+	min uint64
+	max uint64
+}
+
+// sizeFilter filters disk based on given size ranges, e.g. "-64Gi" for the
+// disks up to 64 GiB, "1Ti-2Ti" or "16Ti-".
+type sizeFilter struct {
+	ranges []sizeRange
+}
+
+func RegisterSizeFilter(filters ...string) (*Filter, error) {
+	f := &sizeFilter{}
+	for _, filter := range filters {
+		if filter == "" {
+			continue
+		}
+		r, err := parseSizeRange(filter)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid size range %s: %w", sizeFilterName, filter, err)
+		}
+		f.ranges = append(f.ranges, r)
+	}
+	return &Filter{
+		Name:       sizeFilterName,
+		DiskFilter: f,
+	}, nil
+}
+
+// Match returns true if size of the disk is in any of the ranges
+func (f *sizeFilter) Match(disk *block.Disk) bool {
+	if disk.SizeBytes == 0 {
+		return false
+	}
+	for _, r := range f.ranges {
+		if r.min > 0 && disk.SizeBytes < r.min {
+			continue
+		}
+		if r.max > 0 && disk.SizeBytes > r.max {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// parseSizeRange parses a range of quantities in the form of "<min>-<max>",
+// either end of which could be omitted.
+func parseSizeRange(s string) (sizeRange, error) {
+	minStr, maxStr, found := strings.Cut(strings.TrimSpace(s), "-")
+	if !found {
+		return sizeRange{}, fmt.Errorf("missing '-' between the minimum and maximum sizes")
+	}
+	var r sizeRange
+	var err error
+	if r.min, err = parseSize(minStr); err != nil {
+		return sizeRange{}, err
+	}
+	if r.max, err = parseSize(maxStr); err != nil {
+		return sizeRange{}, err
+	}
+	if r.min == 0 && r.max == 0 {
+		return sizeRange{}, fmt.Errorf("either the minimum or maximum size is required")
+	}
+	if r.max > 0 && r.min > r.max {
+		return sizeRange{}, fmt.Errorf("the minimum size is larger than the maximum size")
+	}
+	return r, nil
+}
+
+func parseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s: %w", s, err)
+	}
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf("negative size %s", s)
+	}
+	return uint64(q.Value()), nil
+}
@@ -0,0 +1,53 @@
+package filter
+
+import (
+	ghwblock "github.com/jaypipes/ghw/pkg/block"
+
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	storageControllerFilterName = "storage controller filter"
+)
+
+// partStorageControllerFilter filters partition based on given storage
+// controller patterns, e.g. "virtio" or "mmc".
+type partStorageControllerFilter struct {
+	controllers []*pattern
+}
+
+// diskStorageControllerFilter filters disk based on given storage controller
+// patterns.
+type diskStorageControllerFilter struct {
+	filter *partStorageControllerFilter
+}
+
+func RegisterStorageControllerFilter(filters ...string) (*Filter, error) {
+	patterns, err := newPatterns(storageControllerFilterName, filters...)
+	if err != nil {
+		return nil, err
+	}
+	f := &partStorageControllerFilter{controllers: patterns}
+	return &Filter{
+		Name:       storageControllerFilterName,
+		PartFilter: f,
+		DiskFilter: &diskStorageControllerFilter{filter: f},
+	}, nil
+}
+
+// Match returns true if storage controller of the partition matches the pattern
+func (f *partStorageControllerFilter) Match(part *block.Partition) bool {
+	return matchStorageController(part.StorageController, f.controllers)
+}
+
+// Match returns true if storage controller of the disk matches the pattern
+func (f *diskStorageControllerFilter) Match(disk *block.Disk) bool {
+	return matchStorageController(disk.StorageController, f.filter.controllers)
+}
+
+func matchStorageController(controller ghwblock.StorageController, patterns []*pattern) bool {
+	if controller == ghwblock.STORAGE_CONTROLLER_UNKNOWN {
+		return false
+	}
+	return matchPatterns(controller.String(), patterns)
+}
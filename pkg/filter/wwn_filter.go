@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"github.com/harvester/node-disk-manager/pkg/block"
+)
+
+const (
+	wwnFilterName = "WWN filter"
+)
+
+// wwnFilter filters disk based on given WWN glob or regex patterns
+type wwnFilter struct {
+	wwns []*pattern
+}
+
+func RegisterWWNFilter(filters ...string) (*Filter, error) {
+	patterns, err := newPatterns(wwnFilterName, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		Name:       wwnFilterName,
+		DiskFilter: &wwnFilter{wwns: patterns},
+	}, nil
+}
+
+// Match returns true if WWN of the disk matches the pattern
+func (f *wwnFilter) Match(disk *block.Disk) bool {
+	return matchPatterns(disk.WWN, f.wwns)
+}
@@ -0,0 +1,124 @@
+package fsck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	// summaryLines is the count of the last lines of the output kept in the
+	// summary, where both e2fsck and xfs_repair report the result
+	summaryLines = 10
+	// summarySize is the maximum size of the summary in bytes
+	summarySize = 2048
+
+	// the bits of the exit code of e2fsck, see e2fsck(8)
+	e2fsckErrorsCorrected       = 0x1
+	e2fsckErrorsCorrectedReboot = 0x2
+)
+
+// Result is the result of a filesystem check
+type Result struct {
+	// ExitCode is the exit code of e2fsck or xfs_repair
+	ExitCode int
+	// Passed is true if the filesystem is clean, or is repaired in the auto mode
+	Passed bool
+	// Summary is the last lines of the output
+	Summary string
+}
+
+// Checker checks and repairs the filesystems which could not be mounted
+type Checker interface {
+	// Check checks the unmounted filesystem on the device in the mode. It
+	// returns an error only if the check could not run at all.
+	Check(devPath, fsType string, mode diskv1.FilesystemRepairMode) (*Result, error)
+}
+
+type executor interface {
+	ExecuteCombinedWithExitCode(cmd string, args []string) (string, int, error)
+}
+
+type checker struct {
+	executor executor
+}
+
+// NewChecker returns a Checker running the commands on the host namespace if
+// the host `/proc` is mounted. The commands are not timed out, since checking
+// a large filesystem could take a while.
+func NewChecker() (Checker, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	executor.SetTimeout(0)
+	return &checker{executor: executor}, nil
+}
+
+func (c *checker) Check(devPath, fsType string, mode diskv1.FilesystemRepairMode) (*Result, error) {
+	var cmd string
+	var args []string
+	switch fsType {
+	case utils.FileSystemTypeExt4:
+		// the check is forced, since a filesystem failing to be mounted may
+		// still be marked clean
+		cmd, args = "e2fsck", []string{"-f", "-y", devPath}
+		if mode == diskv1.FilesystemRepairReadOnlyCheck {
+			args = []string{"-f", "-n", devPath}
+		}
+	case utils.FileSystemTypeXFS:
+		// the log is never zeroed with -L, which loses the metadata changes in
+		// it, so a dirty log fails the repair
+		cmd, args = "xfs_repair", []string{devPath}
+		if mode == diskv1.FilesystemRepairReadOnlyCheck {
+			args = []string{"-n", devPath}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+
+	logrus.Infof("Check %s filesystem of device %s in mode %s", fsType, devPath, mode)
+	out, exitCode, err := c.executor.ExecuteCombinedWithExitCode(cmd, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check filesystem of %s: %w", devPath, err)
+	}
+	return &Result{
+		ExitCode: exitCode,
+		Passed:   passed(fsType, mode, exitCode),
+		Summary:  summarize(out),
+	}, nil
+}
+
+// passed returns true if the exit code means the filesystem is clean, or the
+// errors are all corrected in the auto mode.
+func passed(fsType string, mode diskv1.FilesystemRepairMode, exitCode int) bool {
+	if exitCode == 0 {
+		return true
+	}
+	if fsType == utils.FileSystemTypeExt4 && mode == diskv1.FilesystemRepairAuto {
+		return exitCode&^(e2fsckErrorsCorrected|e2fsckErrorsCorrectedReboot) == 0
+	}
+	return false
+}
+
+// summarize returns the last non-empty lines of the output
+func summarize(out string) string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimRight(line, " \r\t"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > summaryLines {
+		lines = lines[len(lines)-summaryLines:]
+	}
+	summary := strings.Join(lines, "\n")
+	if len(summary) > summarySize {
+		summary = summary[len(summary)-summarySize:]
+	}
+	return summary
+}
@@ -0,0 +1,152 @@
+package fsck
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+)
+
+// fakeExecutor records the commands, and replies the outputs and exit codes of
+// the commands
+type fakeExecutor struct {
+	commands  []string
+	outputs   map[string]string
+	exitCodes map[string]int
+}
+
+func (f *fakeExecutor) ExecuteCombinedWithExitCode(cmd string, args []string) (string, int, error) {
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	f.commands = append(f.commands, command)
+	output := f.outputs[command]
+	if strings.HasPrefix(output, "error:") {
+		return "", 0, fmt.Errorf("%s", output)
+	}
+	return output, f.exitCodes[command], nil
+}
+
+const e2fsckOutput = `e2fsck 1.46.4 (18-Aug-2021)
+Pass 1: Checking inodes, blocks, and sizes
+Pass 2: Checking directory structure
+Pass 3: Checking directory connectivity
+Pass 4: Checking reference counts
+Pass 5: Checking group summary information
+Free blocks count wrong (25656747, counted=25656731).
+Fix? yes
+
+/dev/sdb: ***** FILE SYSTEM WAS MODIFIED *****
+/dev/sdb: 11/6553600 files (0.0% non-contiguous), 557653/26214400 blocks
+`
+
+func Test_check(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsType   string
+		mode     diskv1.FilesystemRepairMode
+		output   string
+		exitCode int
+		command  string
+		expected *Result
+		err      string
+	}{
+		{
+			name:     "ext4 repaired",
+			fsType:   "ext4",
+			mode:     diskv1.FilesystemRepairAuto,
+			output:   e2fsckOutput,
+			exitCode: 1,
+			command:  "e2fsck -f -y /dev/sdb",
+			expected: &Result{
+				ExitCode: 1,
+				Passed:   true,
+				Summary: `e2fsck 1.46.4 (18-Aug-2021)
+Pass 1: Checking inodes, blocks, and sizes
+Pass 2: Checking directory structure
+Pass 3: Checking directory connectivity
+Pass 4: Checking reference counts
+Pass 5: Checking group summary information
+Free blocks count wrong (25656747, counted=25656731).
+Fix? yes
+/dev/sdb: ***** FILE SYSTEM WAS MODIFIED *****
+/dev/sdb: 11/6553600 files (0.0% non-contiguous), 557653/26214400 blocks`,
+			},
+		},
+		{
+			name:     "ext4 errors left uncorrected",
+			fsType:   "ext4",
+			mode:     diskv1.FilesystemRepairAuto,
+			output:   "e2fsck: Bad magic number in super-block while trying to open /dev/sdb\n",
+			exitCode: 8,
+			command:  "e2fsck -f -y /dev/sdb",
+			expected: &Result{ExitCode: 8, Summary: "e2fsck: Bad magic number in super-block while trying to open /dev/sdb"},
+		},
+		{
+			name:     "ext4 errors found by readonly check",
+			fsType:   "ext4",
+			mode:     diskv1.FilesystemRepairReadOnlyCheck,
+			output:   "Fix? no\n\n/dev/sdb: ********** WARNING: Filesystem still has errors **********\n",
+			exitCode: 4,
+			command:  "e2fsck -f -n /dev/sdb",
+			expected: &Result{ExitCode: 4, Summary: "Fix? no\n/dev/sdb: ********** WARNING: Filesystem still has errors **********"},
+		},
+		{
+			name:     "xfs clean",
+			fsType:   "xfs",
+			mode:     diskv1.FilesystemRepairReadOnlyCheck,
+			output:   "Phase 1 - find and verify superblock...\nNo modify flag set, skipping filesystem flush and exiting.\n",
+			command:  "xfs_repair -n /dev/sdb",
+			expected: &Result{Passed: true, Summary: "Phase 1 - find and verify superblock...\nNo modify flag set, skipping filesystem flush and exiting."},
+		},
+		{
+			name:     "xfs with dirty log",
+			fsType:   "xfs",
+			mode:     diskv1.FilesystemRepairAuto,
+			output:   "ERROR: The filesystem has valuable metadata changes in a log which needs to be replayed.\n",
+			exitCode: 2,
+			command:  "xfs_repair /dev/sdb",
+			expected: &Result{ExitCode: 2, Summary: "ERROR: The filesystem has valuable metadata changes in a log which needs to be replayed."},
+		},
+		{
+			name:    "check not run",
+			fsType:  "ext4",
+			mode:    diskv1.FilesystemRepairAuto,
+			output:  "error: no such file or directory",
+			command: "e2fsck -f -y /dev/sdb",
+			err:     "failed to check filesystem of /dev/sdb",
+		},
+		{
+			name:   "unsupported filesystem",
+			fsType: "btrfs",
+			mode:   diskv1.FilesystemRepairAuto,
+			err:    "unsupported filesystem type btrfs",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			executor := &fakeExecutor{
+				outputs:   map[string]string{tc.command: tc.output},
+				exitCodes: map[string]int{tc.command: tc.exitCode},
+			}
+			c := &checker{executor: executor}
+			result, err := c.Check("/dev/sdb", tc.fsType, tc.mode)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+			assert.Equal(t, []string{tc.command}, executor.commands)
+		})
+	}
+}
+
+func Test_summarize(t *testing.T) {
+	assert.Equal(t, "", summarize(""))
+	assert.Equal(t, "3\n4\n5\n6\n7\n8\n9\n10\n11\n12", summarize("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"))
+	long := strings.Repeat("x", summarySize+10)
+	assert.Equal(t, strings.Repeat("x", summarySize), summarize("first\n"+long+"\n"))
+}
@@ -29,6 +29,7 @@ import (
 type HarvesterhciV1beta1Interface interface {
 	RESTClient() rest.Interface
 	BlockDevicesGetter
+	DiskProvisionPoliciesGetter
 }
 
 // HarvesterhciV1beta1Client is used to interact with features provided by the harvesterhci.io group.
@@ -40,6 +41,10 @@ func (c *HarvesterhciV1beta1Client) BlockDevices(namespace string) BlockDeviceIn
 	return newBlockDevices(c, namespace)
 }
 
+func (c *HarvesterhciV1beta1Client) DiskProvisionPolicies() DiskProvisionPolicyInterface {
+	return newDiskProvisionPolicies(c)
+}
+
 // NewForConfig creates a new HarvesterhciV1beta1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -31,6 +31,7 @@ func init() {
 
 type Interface interface {
 	BlockDevice() BlockDeviceController
+	DiskProvisionPolicy() DiskProvisionPolicyController
 }
 
 func New(controllerFactory controller.SharedControllerFactory) Interface {
@@ -46,3 +47,6 @@ type version struct {
 func (c *version) BlockDevice() BlockDeviceController {
 	return NewBlockDeviceController(schema.GroupVersionKind{Group: "harvesterhci.io", Version: "v1beta1", Kind: "BlockDevice"}, "blockdevices", true, c.controllerFactory)
 }
+func (c *version) DiskProvisionPolicy() DiskProvisionPolicyController {
+	return NewDiskProvisionPolicyController(schema.GroupVersionKind{Group: "harvesterhci.io", Version: "v1beta1", Kind: "DiskProvisionPolicy"}, "diskprovisionpolicies", false, c.controllerFactory)
+}
@@ -0,0 +1,127 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	smartctlBinary = "smartctl"
+
+	// smartctl exit status bits, see the RETURN VALUES section of smartctl(8)
+	exitStatusCmdLineError = 1 << 0
+	exitStatusOpenFailed   = 1 << 1
+	exitStatusDiskFailing  = 1 << 3
+
+	// ATA SMART attribute of the count of reallocated sectors
+	ataAttributeReallocatedSectors = 5
+)
+
+// Checker checks the health of a disk
+type Checker interface {
+	Check(devPath string) (*diskv1.DeviceHealth, error)
+}
+
+type smartctlChecker struct {
+	executor *utils.Executor
+}
+
+// NewSmartctlChecker returns a Checker reading SMART attributes of SATA/SAS
+// disks and the SMART/health log of NVMe disks with `smartctl --json`. It runs
+// smartctl on the host namespace if the host `/proc` is mounted.
+func NewSmartctlChecker() (Checker, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	return &smartctlChecker{executor: executor}, nil
+}
+
+func (c *smartctlChecker) Check(devPath string) (*diskv1.DeviceHealth, error) {
+	output, exitStatus, err := c.executor.ExecuteWithExitCode(smartctlBinary, []string{"--json", "--all", devPath})
+	if err != nil {
+		return nil, err
+	}
+	return parseSmartctlOutput([]byte(output), exitStatus)
+}
+
+type smartctlOutput struct {
+	Smartctl struct {
+		Messages []struct {
+			String string `json:"string"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	SCSIGrownDefectList int64 `json:"scsi_grown_defect_list"`
+	NVMeHealthLog       *struct {
+		Temperature    int64 `json:"temperature"`
+		PercentageUsed int64 `json:"percentage_used"`
+		PowerOnHours   int64 `json:"power_on_hours"`
+		MediaErrors    int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+func parseSmartctlOutput(output []byte, exitStatus int) (*diskv1.DeviceHealth, error) {
+	var result smartctlOutput
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl output: %w", err)
+	}
+	if exitStatus&(exitStatusCmdLineError|exitStatusOpenFailed) != 0 {
+		messages := make([]string, 0, len(result.Smartctl.Messages))
+		for _, msg := range result.Smartctl.Messages {
+			messages = append(messages, msg.String)
+		}
+		return nil, fmt.Errorf("smartctl exited with status %d: %s", exitStatus, strings.Join(messages, "; "))
+	}
+
+	health := &diskv1.DeviceHealth{
+		OverallStatus:      diskv1.DeviceHealthUnknown,
+		Temperature:        result.Temperature.Current,
+		ReallocatedSectors: result.SCSIGrownDefectList,
+		PowerOnHours:       result.PowerOnTime.Hours,
+	}
+	switch {
+	case exitStatus&exitStatusDiskFailing != 0:
+		health.OverallStatus = diskv1.DeviceHealthFailed
+	case result.SmartStatus != nil && result.SmartStatus.Passed:
+		health.OverallStatus = diskv1.DeviceHealthPassed
+	case result.SmartStatus != nil:
+		health.OverallStatus = diskv1.DeviceHealthFailed
+	}
+	for _, attr := range result.ATASmartAttributes.Table {
+		if attr.ID == ataAttributeReallocatedSectors {
+			health.ReallocatedSectors = attr.Raw.Value
+		}
+	}
+	if log := result.NVMeHealthLog; log != nil {
+		health.PercentageUsed = log.PercentageUsed
+		health.MediaErrors = log.MediaErrors
+		if health.Temperature == 0 {
+			health.Temperature = log.Temperature
+		}
+		if health.PowerOnHours == 0 {
+			health.PowerOnHours = log.PowerOnHours
+		}
+	}
+	return health, nil
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+)
+
+const ataOutput = `{
+  "smartctl": {"exit_status": 0},
+  "device": {"name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+  "smart_status": {"passed": true},
+  "ata_smart_attributes": {
+    "table": [
+      {"id": 1, "name": "Raw_Read_Error_Rate", "raw": {"value": 12}},
+      {"id": 5, "name": "Reallocated_Sector_Ct", "raw": {"value": 8}}
+    ]
+  },
+  "power_on_time": {"hours": 17520},
+  "temperature": {"current": 34}
+}`
+
+const nvmeOutput = `{
+  "smartctl": {"exit_status": 0},
+  "device": {"name": "/dev/nvme0", "type": "nvme", "protocol": "NVMe"},
+  "smart_status": {"passed": true, "nvme": {"value": 0}},
+  "nvme_smart_health_information_log": {
+    "critical_warning": 0,
+    "temperature": 41,
+    "percentage_used": 3,
+    "power_on_hours": 2000,
+    "media_errors": 1
+  }
+}`
+
+const scsiFailingOutput = `{
+  "smartctl": {"exit_status": 8},
+  "device": {"name": "/dev/sdb", "type": "scsi", "protocol": "SCSI"},
+  "smart_status": {"passed": false},
+  "scsi_grown_defect_list": 120,
+  "power_on_time": {"hours": 300},
+  "temperature": {"current": 50}
+}`
+
+const virtioOutput = `{
+  "smartctl": {"exit_status": 4},
+  "device": {"name": "/dev/vda", "type": "scsi", "protocol": "SCSI"},
+  "smart_support": {"available": false}
+}`
+
+const openFailedOutput = `{
+  "smartctl": {
+    "exit_status": 2,
+    "messages": [{"string": "Smartctl open device: /dev/sdz failed: No such device", "severity": "error"}]
+  }
+}`
+
+func Test_parseSmartctlOutput(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		output     string
+		exitStatus int
+		expected   *diskv1.DeviceHealth
+		expectErr  bool
+	}{
+		{
+			name:       "ATA disk",
+			output:     ataOutput,
+			exitStatus: 0,
+			expected: &diskv1.DeviceHealth{
+				OverallStatus:      diskv1.DeviceHealthPassed,
+				Temperature:        34,
+				ReallocatedSectors: 8,
+				PowerOnHours:       17520,
+			},
+		},
+		{
+			name:       "NVMe disk",
+			output:     nvmeOutput,
+			exitStatus: 0,
+			expected: &diskv1.DeviceHealth{
+				OverallStatus:  diskv1.DeviceHealthPassed,
+				Temperature:    41,
+				PercentageUsed: 3,
+				MediaErrors:    1,
+				PowerOnHours:   2000,
+			},
+		},
+		{
+			name:       "failing SCSI disk",
+			output:     scsiFailingOutput,
+			exitStatus: 8,
+			expected: &diskv1.DeviceHealth{
+				OverallStatus:      diskv1.DeviceHealthFailed,
+				Temperature:        50,
+				ReallocatedSectors: 120,
+				PowerOnHours:       300,
+			},
+		},
+		{
+			name:       "SMART not supported",
+			output:     virtioOutput,
+			exitStatus: 4,
+			expected: &diskv1.DeviceHealth{
+				OverallStatus: diskv1.DeviceHealthUnknown,
+			},
+		},
+		{
+			name:       "device open failed",
+			output:     openFailedOutput,
+			exitStatus: 2,
+			expectErr:  true,
+		},
+		{
+			name:       "invalid output",
+			output:     "smartctl: unrecognized option '--json'",
+			exitStatus: 1,
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			health, err := parseSmartctlOutput([]byte(tc.output), tc.exitStatus)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, health)
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package lvm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	// the attribute of the temporary logical volume created by pvmove, see lvs(8)
+	lvAttrPVMove = 'p'
+)
+
+// PhysicalVolume is a LVM physical volume reported by pvs
+type PhysicalVolume struct {
+	Name      string
+	VGName    string
+	SizeBytes uint64
+	FreeBytes uint64
+	UsedBytes uint64
+}
+
+// VolumeGroup is a LVM volume group reported by vgs
+type VolumeGroup struct {
+	Name      string
+	PVCount   int
+	LVCount   int
+	SizeBytes uint64
+	FreeBytes uint64
+}
+
+// LogicalVolume is a LVM logical volume reported by lvs
+type LogicalVolume struct {
+	Name   string
+	VGName string
+	Attr   string
+}
+
+// Manager manages the LVM physical volumes and volume groups of the node
+type Manager interface {
+	// GetPV returns the physical volume on the device, or nil if the device is not a physical volume
+	GetPV(devPath string) (*PhysicalVolume, error)
+	// GetVG returns the volume group, or nil if it does not exist
+	GetVG(vgName string) (*VolumeGroup, error)
+	// ListPVs returns the physical volumes of the volume group
+	ListPVs(vgName string) ([]*PhysicalVolume, error)
+	// IsMoving returns true if pvmove is running in the volume group
+	IsMoving(vgName string) (bool, error)
+
+	// CreatePV initializes the device as a physical volume, wiping its
+	// signatures first if wipe is true
+	CreatePV(devPath string, wipe bool) error
+	// ExtendVG adds the physical volume to the volume group, which is created if not exists
+	ExtendVG(vgName, devPath string) error
+	// MovePV moves the allocated extents of the physical volume to the other
+	// physical volumes of its volume group in background
+	MovePV(devPath string) error
+	// ReduceVG removes the unused physical volume from the volume group
+	ReduceVG(vgName, devPath string) error
+	// RemoveVG removes the volume group without logical volumes
+	RemoveVG(vgName string) error
+	// RemovePV wipes the physical volume label of the device
+	RemovePV(devPath string) error
+}
+
+type executor interface {
+	Execute(cmd string, args []string) (string, error)
+}
+
+type manager struct {
+	executor executor
+}
+
+// NewManager returns a Manager running the LVM commands on the host namespace
+// if the host `/proc` is mounted.
+func NewManager() (Manager, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	return &manager{executor: executor}, nil
+}
+
+// reportArgs are the args of pvs, vgs and lvs to report sizes in bytes as json
+var reportArgs = []string{"--reportformat", "json", "--units", "b", "--nosuffix"}
+
+func (m *manager) GetPV(devPath string) (*PhysicalVolume, error) {
+	pvs, err := m.listPVs()
+	if err != nil {
+		return nil, err
+	}
+	for _, pv := range pvs {
+		if pv.Name == devPath {
+			return pv, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *manager) ListPVs(vgName string) ([]*PhysicalVolume, error) {
+	pvs, err := m.listPVs()
+	if err != nil {
+		return nil, err
+	}
+	var result []*PhysicalVolume
+	for _, pv := range pvs {
+		if pv.VGName == vgName {
+			result = append(result, pv)
+		}
+	}
+	return result, nil
+}
+
+func (m *manager) listPVs() ([]*PhysicalVolume, error) {
+	args := append([]string{"-o", "pv_name,vg_name,pv_size,pv_free,pv_used"}, reportArgs...)
+	output, err := m.executor.Execute("pvs", args)
+	if err != nil {
+		return nil, err
+	}
+	return parsePVs([]byte(output))
+}
+
+func (m *manager) GetVG(vgName string) (*VolumeGroup, error) {
+	args := append([]string{"-o", "vg_name,pv_count,lv_count,vg_size,vg_free"}, reportArgs...)
+	output, err := m.executor.Execute("vgs", args)
+	if err != nil {
+		return nil, err
+	}
+	vgs, err := parseVGs([]byte(output))
+	if err != nil {
+		return nil, err
+	}
+	for _, vg := range vgs {
+		if vg.Name == vgName {
+			return vg, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *manager) IsMoving(vgName string) (bool, error) {
+	// -a to report the hidden pvmove volumes
+	args := append([]string{"-a", "-o", "lv_name,vg_name,lv_attr"}, reportArgs...)
+	output, err := m.executor.Execute("lvs", args)
+	if err != nil {
+		return false, err
+	}
+	lvs, err := parseLVs([]byte(output))
+	if err != nil {
+		return false, err
+	}
+	for _, lv := range lvs {
+		if lv.VGName == vgName && len(lv.Attr) > 0 && lv.Attr[0] == lvAttrPVMove {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *manager) CreatePV(devPath string, wipe bool) error {
+	if wipe {
+		if _, err := m.executor.Execute("wipefs", []string{"-a", devPath}); err != nil {
+			return err
+		}
+	}
+	_, err := m.executor.Execute("pvcreate", []string{devPath})
+	return err
+}
+
+func (m *manager) ExtendVG(vgName, devPath string) error {
+	vg, err := m.GetVG(vgName)
+	if err != nil {
+		return err
+	}
+	if vg == nil {
+		_, err = m.executor.Execute("vgcreate", []string{vgName, devPath})
+	} else {
+		_, err = m.executor.Execute("vgextend", []string{vgName, devPath})
+	}
+	return err
+}
+
+func (m *manager) MovePV(devPath string) error {
+	_, err := m.executor.Execute("pvmove", []string{"-b", devPath})
+	return err
+}
+
+func (m *manager) ReduceVG(vgName, devPath string) error {
+	_, err := m.executor.Execute("vgreduce", []string{vgName, devPath})
+	return err
+}
+
+func (m *manager) RemoveVG(vgName string) error {
+	_, err := m.executor.Execute("vgremove", []string{vgName})
+	return err
+}
+
+func (m *manager) RemovePV(devPath string) error {
+	_, err := m.executor.Execute("pvremove", []string{devPath})
+	return err
+}
+
+// report is the json output of pvs, vgs and lvs with `--reportformat json`,
+// all the fields are strings.
+type report struct {
+	Report []struct {
+		PV []map[string]string `json:"pv"`
+		VG []map[string]string `json:"vg"`
+		LV []map[string]string `json:"lv"`
+	} `json:"report"`
+}
+
+func parseReport(output []byte) (*report, error) {
+	r := &report{}
+	if err := json.Unmarshal(output, r); err != nil {
+		return nil, fmt.Errorf("failed to parse LVM report: %w", err)
+	}
+	return r, nil
+}
+
+func parsePVs(output []byte) ([]*PhysicalVolume, error) {
+	r, err := parseReport(output)
+	if err != nil {
+		return nil, err
+	}
+	var pvs []*PhysicalVolume
+	for _, item := range r.Report {
+		for _, fields := range item.PV {
+			pv := &PhysicalVolume{
+				Name:   fields["pv_name"],
+				VGName: fields["vg_name"],
+			}
+			if pv.SizeBytes, err = parseBytes(fields["pv_size"]); err != nil {
+				return nil, err
+			}
+			if pv.FreeBytes, err = parseBytes(fields["pv_free"]); err != nil {
+				return nil, err
+			}
+			if pv.UsedBytes, err = parseBytes(fields["pv_used"]); err != nil {
+				return nil, err
+			}
+			pvs = append(pvs, pv)
+		}
+	}
+	return pvs, nil
+}
+
+func parseVGs(output []byte) ([]*VolumeGroup, error) {
+	r, err := parseReport(output)
+	if err != nil {
+		return nil, err
+	}
+	var vgs []*VolumeGroup
+	for _, item := range r.Report {
+		for _, fields := range item.VG {
+			vg := &VolumeGroup{Name: fields["vg_name"]}
+			if vg.PVCount, err = strconv.Atoi(fields["pv_count"]); err != nil {
+				return nil, fmt.Errorf("failed to parse pv_count of volume group %s: %w", vg.Name, err)
+			}
+			if vg.LVCount, err = strconv.Atoi(fields["lv_count"]); err != nil {
+				return nil, fmt.Errorf("failed to parse lv_count of volume group %s: %w", vg.Name, err)
+			}
+			if vg.SizeBytes, err = parseBytes(fields["vg_size"]); err != nil {
+				return nil, err
+			}
+			if vg.FreeBytes, err = parseBytes(fields["vg_free"]); err != nil {
+				return nil, err
+			}
+			vgs = append(vgs, vg)
+		}
+	}
+	return vgs, nil
+}
+
+func parseLVs(output []byte) ([]*LogicalVolume, error) {
+	r, err := parseReport(output)
+	if err != nil {
+		return nil, err
+	}
+	var lvs []*LogicalVolume
+	for _, item := range r.Report {
+		for _, fields := range item.LV {
+			lvs = append(lvs, &LogicalVolume{
+				Name:   fields["lv_name"],
+				VGName: fields["vg_name"],
+				Attr:   fields["lv_attr"],
+			})
+		}
+	}
+	return lvs, nil
+}
+
+// parseBytes parses a size reported with `--units b --nosuffix`
+func parseBytes(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse LVM size %q: %w", s, err)
+	}
+	return size, nil
+}
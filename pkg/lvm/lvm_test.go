@@ -0,0 +1,119 @@
+package lvm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pvsOutput = `  {
+      "report": [
+          {
+              "pv": [
+                  {"pv_name":"/dev/sdb", "vg_name":"vg0", "pv_size":"10733223936", "pv_free":"6438256640", "pv_used":"4294967296"},
+                  {"pv_name":"/dev/sdc", "vg_name":"vg0", "pv_size":"10733223936", "pv_free":"10733223936", "pv_used":"0"},
+                  {"pv_name":"/dev/sdd", "vg_name":"", "pv_size":"10737418240", "pv_free":"10737418240", "pv_used":"0"}
+              ]
+          }
+      ]
+  }
+`
+
+const vgsOutput = `  {
+      "report": [
+          {
+              "vg": [
+                  {"vg_name":"vg0", "pv_count":"2", "lv_count":"1", "vg_size":"21466447872", "vg_free":"17171480576"}
+              ]
+          }
+      ]
+  }
+`
+
+const lvsMovingOutput = `  {
+      "report": [
+          {
+              "lv": [
+                  {"lv_name":"data", "vg_name":"vg0", "lv_attr":"-wI-ao----"},
+                  {"lv_name":"[pvmove0]", "vg_name":"vg0", "lv_attr":"p-C-aom---"}
+              ]
+          }
+      ]
+  }
+`
+
+func Test_parsePVs(t *testing.T) {
+	pvs, err := parsePVs([]byte(pvsOutput))
+	require.NoError(t, err)
+	assert.Equal(t, []*PhysicalVolume{
+		{Name: "/dev/sdb", VGName: "vg0", SizeBytes: 10733223936, FreeBytes: 6438256640, UsedBytes: 4294967296},
+		{Name: "/dev/sdc", VGName: "vg0", SizeBytes: 10733223936, FreeBytes: 10733223936},
+		{Name: "/dev/sdd", SizeBytes: 10737418240, FreeBytes: 10737418240},
+	}, pvs)
+
+	_, err = parsePVs([]byte(`{"report":[{"pv":[{"pv_name":"/dev/sdb","pv_size":"10.00g"}]}]}`))
+	assert.Error(t, err)
+	_, err = parsePVs([]byte("  No physical volume found"))
+	assert.Error(t, err)
+}
+
+func Test_parseVGs(t *testing.T) {
+	vgs, err := parseVGs([]byte(vgsOutput))
+	require.NoError(t, err)
+	assert.Equal(t, []*VolumeGroup{
+		{Name: "vg0", PVCount: 2, LVCount: 1, SizeBytes: 21466447872, FreeBytes: 17171480576},
+	}, vgs)
+}
+
+// fakeExecutor returns the output of pvs, vgs and lvs, and records the other commands
+type fakeExecutor struct {
+	outputs  map[string]string
+	commands []string
+}
+
+func (f *fakeExecutor) Execute(cmd string, args []string) (string, error) {
+	if output, ok := f.outputs[cmd]; ok {
+		return output, nil
+	}
+	f.commands = append(f.commands, strings.Join(append([]string{cmd}, args...), " "))
+	return "", nil
+}
+
+func Test_manager(t *testing.T) {
+	executor := &fakeExecutor{outputs: map[string]string{
+		"pvs": pvsOutput,
+		"vgs": vgsOutput,
+		"lvs": lvsMovingOutput,
+	}}
+	m := &manager{executor: executor}
+
+	pv, err := m.GetPV("/dev/sdc")
+	require.NoError(t, err)
+	assert.Equal(t, "vg0", pv.VGName)
+	pv, err = m.GetPV("/dev/sde")
+	require.NoError(t, err)
+	assert.Nil(t, pv)
+
+	pvs, err := m.ListPVs("vg0")
+	require.NoError(t, err)
+	assert.Len(t, pvs, 2)
+
+	moving, err := m.IsMoving("vg0")
+	require.NoError(t, err)
+	assert.True(t, moving)
+	moving, err = m.IsMoving("vg1")
+	require.NoError(t, err)
+	assert.False(t, moving)
+
+	require.NoError(t, m.CreatePV("/dev/sdd", true))
+	require.NoError(t, m.ExtendVG("vg0", "/dev/sdd"))
+	require.NoError(t, m.ExtendVG("vg1", "/dev/sde"))
+	assert.Equal(t, []string{
+		"wipefs -a /dev/sdd",
+		"pvcreate /dev/sdd",
+		"vgextend vg0 /dev/sdd",
+		"vgcreate vg1 /dev/sde",
+	}, executor.commands)
+}
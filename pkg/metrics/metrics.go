@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+)
+
+const (
+	namespace = "ndm"
+
+	// OperationFormat is the operation label of filesystem formatting.
+	OperationFormat = "format"
+	// OperationMount is the operation label of mounting.
+	OperationMount = "mount"
+	// OperationUnmount is the operation label of unmounting.
+	OperationUnmount = "unmount"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	deviceOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "device_operations_total",
+			Help:      "Total number of format, mount and unmount operations on block devices",
+		},
+		[]string{"device", "operation", "result"},
+	)
+
+	mkfsDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mkfs_duration_seconds",
+			Help:      "Time taken to make a filesystem on a block device",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"fs_type"},
+	)
+
+	mountDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mount_duration_seconds",
+			Help:      "Time taken to mount a block device",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		},
+	)
+
+	scanDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "scanner_run_duration_seconds",
+			Help:      "Time taken by a scanner run over the block devices of the node",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		},
+	)
+
+	scanRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scanner_runs_total",
+			Help:      "Total number of scanner runs",
+		},
+		[]string{"result"},
+	)
+
+	udevEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "udev_events_total",
+			Help:      "Total number of udev events received for disks and partitions",
+		},
+		[]string{"action"},
+	)
+
+	semaphoreSaturated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "semaphore_saturated_total",
+			Help:      "Total number of disk operations requeued because the maximum concurrent count was hit",
+		},
+	)
+
+	blockDevicesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "blockdevices"),
+		"Number of block devices of the node by state and provision phase",
+		[]string{"node", "state", "provision_phase"},
+		nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		deviceOperations,
+		mkfsDuration,
+		mountDuration,
+		scanDuration,
+		scanRuns,
+		udevEvents,
+		semaphoreSaturated,
+	)
+}
+
+// Handler returns the http handler serving the metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func resultOf(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+// ObserveFormat records the result and the mkfs duration of formatting a device
+func ObserveFormat(device, fsType string, start time.Time, err error) {
+	deviceOperations.WithLabelValues(device, OperationFormat, resultOf(err)).Inc()
+	if err == nil {
+		mkfsDuration.WithLabelValues(fsType).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveMount records the result and the duration of mounting a device
+func ObserveMount(device string, start time.Time, err error) {
+	deviceOperations.WithLabelValues(device, OperationMount, resultOf(err)).Inc()
+	if err == nil {
+		mountDuration.Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveUnmount records the result of unmounting a device
+func ObserveUnmount(device string, err error) {
+	deviceOperations.WithLabelValues(device, OperationUnmount, resultOf(err)).Inc()
+}
+
+// ObserveScan records the result and the duration of a scanner run
+func ObserveScan(start time.Time, err error) {
+	scanRuns.WithLabelValues(resultOf(err)).Inc()
+	scanDuration.Observe(time.Since(start).Seconds())
+}
+
+// IncUdevEvent counts a received udev event of the given action
+func IncUdevEvent(action string) {
+	udevEvents.WithLabelValues(action).Inc()
+}
+
+// IncSemaphoreSaturated counts a disk operation rejected by a full semaphore
+func IncSemaphoreSaturated() {
+	semaphoreSaturated.Inc()
+}
+
+// blockDeviceCollector reports the block devices of the node from the cache
+// at scrape time, so the gauges never drift from the actual objects.
+type blockDeviceCollector struct {
+	nodeName  string
+	namespace string
+	cache     ctldiskv1.BlockDeviceCache
+}
+
+type blockDeviceKey struct {
+	state          string
+	provisionPhase string
+}
+
+// RegisterBlockDeviceCollector registers the gauges of the block devices of the node
+func RegisterBlockDeviceCollector(nodeName, namespace string, cache ctldiskv1.BlockDeviceCache) error {
+	return prometheus.Register(newBlockDeviceCollector(nodeName, namespace, cache))
+}
+
+func newBlockDeviceCollector(nodeName, namespace string, cache ctldiskv1.BlockDeviceCache) *blockDeviceCollector {
+	return &blockDeviceCollector{
+		nodeName:  nodeName,
+		namespace: namespace,
+		cache:     cache,
+	}
+}
+
+func (c *blockDeviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- blockDevicesDesc
+}
+
+func (c *blockDeviceCollector) Collect(ch chan<- prometheus.Metric) {
+	bds, err := c.cache.List(c.namespace, labels.SelectorFromSet(map[string]string{
+		corev1.LabelHostname: c.nodeName,
+	}))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(blockDevicesDesc, err)
+		return
+	}
+
+	counts := make(map[blockDeviceKey]int)
+	for _, bd := range bds {
+		counts[blockDeviceKey{
+			state:          string(bd.Status.State),
+			provisionPhase: string(bd.Status.ProvisionPhase),
+		}]++
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(blockDevicesDesc, prometheus.GaugeValue, float64(count),
+			c.nodeName, key.state, key.provisionPhase)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+)
+
+// fakeBlockDeviceCache only implements List, filtering by labels.
+type fakeBlockDeviceCache struct {
+	ctldiskv1.BlockDeviceCache
+	bds []*diskv1.BlockDevice
+}
+
+func (f *fakeBlockDeviceCache) List(_ string, selector labels.Selector) ([]*diskv1.BlockDevice, error) {
+	var result []*diskv1.BlockDevice
+	for _, bd := range f.bds {
+		if selector.Matches(labels.Set(bd.Labels)) {
+			result = append(result, bd)
+		}
+	}
+	return result, nil
+}
+
+func newBlockDevice(name, node string, state diskv1.BlockDeviceState, phase diskv1.BlockDeviceProvisionPhase) *diskv1.BlockDevice {
+	return &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{corev1.LabelHostname: node},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			State:          state,
+			ProvisionPhase: phase,
+		},
+	}
+}
+
+func Test_blockDeviceCollector(t *testing.T) {
+	cache := &fakeBlockDeviceCache{
+		bds: []*diskv1.BlockDevice{
+			newBlockDevice("bd1", "node1", diskv1.BlockDeviceActive, diskv1.ProvisionPhaseProvisioned),
+			newBlockDevice("bd2", "node1", diskv1.BlockDeviceActive, diskv1.ProvisionPhaseProvisioned),
+			newBlockDevice("bd3", "node1", diskv1.BlockDeviceInactive, diskv1.ProvisionPhaseUnprovisioned),
+			newBlockDevice("bd4", "node2", diskv1.BlockDeviceActive, diskv1.ProvisionPhaseProvisioned),
+		},
+	}
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(newBlockDeviceCollector("node1", "longhorn-system", cache)))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, "ndm_blockdevices", families[0].GetName())
+
+	values := make(map[string]float64)
+	for _, m := range families[0].GetMetric() {
+		labels := make(map[string]string)
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		assert.Equal(t, "node1", labels["node"])
+		values[labels["state"]+"/"+labels["provision_phase"]] = m.GetGauge().GetValue()
+	}
+	assert.Equal(t, map[string]float64{
+		"Active/Provisioned":     2,
+		"Inactive/Unprovisioned": 1,
+	}, values)
+}
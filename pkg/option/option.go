@@ -6,15 +6,38 @@ type Option struct {
 	NodeName    string
 	Threadiness int
 
-	Debug                  bool
-	Trace                  bool
-	LogFormat              string
-	ProfilerAddress        string
-	VendorFilter           string
-	PathFilter             string
-	LabelFilter            string
-	AutoProvisionFilter    string
-	RescanInterval         int64
-	MaxConcurrentOps       uint
-	InjectUdevMonitorError bool
+	Debug                   bool
+	Trace                   bool
+	LogFormat               string
+	ProfilerAddress         string
+	MetricsAddress          string
+	VendorFilter            string
+	PathFilter              string
+	LabelFilter             string
+	PartTypeFilter          string
+	SizeFilter              string
+	ModelFilter             string
+	SerialFilter            string
+	WWNFilter               string
+	BusPathFilter           string
+	StorageControllerFilter string
+	ExcludeExpression       string
+	AutoProvisionExpression string
+	AutoProvisionFilter     string
+	RescanInterval          int64
+	HealthCheckInterval     int64
+	InactiveDeviceTTL       int64
+	InactiveProvisionedTTL  int64
+	MaxConcurrentOps        uint
+	MountPathTemplate       string
+	AutoEvictUnhealthyDisk  bool
+	AutoGPTGenerate         bool
+	FilterConfigMap         string
+	InjectUdevMonitorError  bool
+
+	WebhookListenAddress string
+	WebhookTLSCertFile   string
+	WebhookTLSKeyFile    string
+
+	ExplainOutput string
 }
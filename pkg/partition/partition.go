@@ -0,0 +1,232 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	// SizeRest is the size of the partition taking the rest of the disk
+	SizeRest = "rest"
+
+	// TypeLinuxFileSystem is the GPT partition type GUID of Linux filesystem data
+	TypeLinuxFileSystem = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+
+	// alignment is the alignment of the partition sizes, sgdisk aligns the
+	// start of the partitions to 1 MiB as well
+	alignment = 1 << 20
+	// gptOverhead is the space taken by the primary and the backup GPT
+	// partition tables, and the alignment of the first partition
+	gptOverhead = 2 * alignment
+
+	// waitTimeout is how long to wait for udev to create the device nodes of
+	// the partitions
+	waitTimeout  = 30 * time.Second
+	waitInterval = time.Second
+)
+
+var guidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Partitioner creates the partitions of disks
+type Partitioner interface {
+	// Partition replaces the partition table of the disk with a GPT one of
+	// the partitions, and formats the partitions with a filesystem in spec.
+	// The disk GUID is kept if it is not empty. It returns the device paths
+	// of the partitions once udev creates them.
+	Partition(devPath, diskGUID string, sizeBytes uint64, partitions []diskv1.PartitionInfo) ([]string, error)
+}
+
+type executor interface {
+	Execute(cmd string, args []string) (string, error)
+}
+
+type partitioner struct {
+	executor executor
+	// format formats the partition, utils.MakeDiskFormatting by default
+	format func(devPath, fsType, uuid string) error
+	// exists returns true if the device node exists
+	exists      func(devPath string) bool
+	waitTimeout time.Duration
+}
+
+// NewPartitioner returns a Partitioner running sgdisk and udevadm on the host
+// namespace if the host `/proc` is mounted.
+func NewPartitioner() (Partitioner, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	return &partitioner{
+		executor:    executor,
+		format:      utils.MakeDiskFormatting,
+		exists:      deviceExists,
+		waitTimeout: waitTimeout,
+	}, nil
+}
+
+func (p *partitioner) Partition(devPath, diskGUID string, sizeBytes uint64, partitions []diskv1.PartitionInfo) ([]string, error) {
+	sizes, err := Sizes(partitions, sizeBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Create %d partitions on device %s", len(partitions), devPath)
+	if _, err := p.executor.Execute("sgdisk", []string{"--zap-all", devPath}); err != nil {
+		return nil, fmt.Errorf("failed to wipe partition table of %s: %w", devPath, err)
+	}
+	args := []string{}
+	if diskGUID != "" {
+		args = append(args, "--disk-guid="+diskGUID)
+	}
+	for i, part := range partitions {
+		number := i + 1
+		end := "0"
+		if sizes[i] > 0 {
+			end = fmt.Sprintf("+%dM", sizes[i]/alignment)
+		}
+		typeGUID := part.TypeGUID
+		if typeGUID == "" {
+			typeGUID = TypeLinuxFileSystem
+		}
+		args = append(args,
+			fmt.Sprintf("--new=%d:0:%s", number, end),
+			fmt.Sprintf("--typecode=%d:%s", number, typeGUID),
+			fmt.Sprintf("--change-name=%d:%s", number, part.Name),
+		)
+	}
+	args = append(args, devPath)
+	if _, err := p.executor.Execute("sgdisk", args); err != nil {
+		return nil, fmt.Errorf("failed to create partitions on %s: %w", devPath, err)
+	}
+
+	// sgdisk asks the kernel to reread the partition table, wait for udev to
+	// process the events of the new partitions
+	if _, err := p.executor.Execute("udevadm", []string{"settle", fmt.Sprintf("--timeout=%d", int(p.waitTimeout.Seconds()))}); err != nil {
+		logrus.Warnf("Failed to wait for udev events of %s: %v", devPath, err)
+	}
+	partPaths := make([]string, 0, len(partitions))
+	for i := range partitions {
+		partPath := DevPath(devPath, i+1)
+		if err := p.waitDevice(partPath); err != nil {
+			return nil, err
+		}
+		partPaths = append(partPaths, partPath)
+	}
+
+	for i, part := range partitions {
+		if part.FileSystem == "" {
+			continue
+		}
+		logrus.Infof("Format partition %s with %s filesystem", partPaths[i], part.FileSystem)
+		if err := p.format(partPaths[i], part.FileSystem, ""); err != nil {
+			return nil, err
+		}
+	}
+	return partPaths, nil
+}
+
+func (p *partitioner) waitDevice(devPath string) error {
+	deadline := time.Now().Add(p.waitTimeout)
+	for !p.exists(devPath) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("partition %s is not created by udev in %v", devPath, p.waitTimeout)
+		}
+		time.Sleep(waitInterval)
+	}
+	return nil
+}
+
+// IsGUID returns true if the string is a GUID, e.g. a GPT partition type
+func IsGUID(s string) bool {
+	return guidRegexp.MatchString(s)
+}
+
+func deviceExists(devPath string) bool {
+	_, err := os.Stat(devPath)
+	return err == nil
+}
+
+// DevPath returns the device path of the partition of the disk, e.g.
+// /dev/sda1 or /dev/nvme0n1p1.
+func DevPath(diskDevPath string, number int) string {
+	if last := diskDevPath[len(diskDevPath)-1]; last >= '0' && last <= '9' {
+		return fmt.Sprintf("%sp%d", diskDevPath, number)
+	}
+	return fmt.Sprintf("%s%d", diskDevPath, number)
+}
+
+// Sizes returns the sizes of the partitions in bytes, aligned down to 1 MiB,
+// or 0 for the last partition taking the rest of the disk.
+func Sizes(partitions []diskv1.PartitionInfo, diskSizeBytes uint64) ([]uint64, error) {
+	sizes := make([]uint64, 0, len(partitions))
+	names := map[string]bool{}
+	var total uint64
+	for i, part := range partitions {
+		if part.Name == "" {
+			return nil, fmt.Errorf("name of partition %d is empty", i+1)
+		}
+		if names[part.Name] {
+			return nil, fmt.Errorf("name of partition %s is duplicated", part.Name)
+		}
+		names[part.Name] = true
+		if part.TypeGUID != "" && !IsGUID(part.TypeGUID) {
+			return nil, fmt.Errorf("type GUID %s of partition %s is invalid", part.TypeGUID, part.Name)
+		}
+		if part.FileSystem != "" && !utils.IsSupportedFileSystem(part.FileSystem) {
+			return nil, fmt.Errorf("filesystem %s of partition %s is not supported", part.FileSystem, part.Name)
+		}
+
+		size, err := parseSize(part.Size, diskSizeBytes)
+		if err != nil {
+			return nil, fmt.Errorf("size of partition %s is invalid: %w", part.Name, err)
+		}
+		if size == 0 && i != len(partitions)-1 {
+			return nil, fmt.Errorf("only the last partition could take the rest of the disk, not partition %s", part.Name)
+		}
+		if size > 0 {
+			size = size / alignment * alignment
+			if size == 0 {
+				return nil, fmt.Errorf("size of partition %s is less than 1Mi", part.Name)
+			}
+		}
+		total += size
+		sizes = append(sizes, size)
+	}
+	if total+gptOverhead > diskSizeBytes {
+		return nil, fmt.Errorf("partitions of %d bytes exceed the disk of %d bytes", total, diskSizeBytes)
+	}
+	return sizes, nil
+}
+
+// parseSize parses a quantity, a percentage of the disk, or "rest" which
+// returns 0.
+func parseSize(size string, diskSizeBytes uint64) (uint64, error) {
+	if size == SizeRest {
+		return 0, nil
+	}
+	if percent, ok := strings.CutSuffix(size, "%"); ok {
+		value, err := strconv.ParseUint(percent, 10, 64)
+		if err != nil || value == 0 || value > 100 {
+			return 0, fmt.Errorf("percentage %s is not between 1%% and 100%%", size)
+		}
+		return diskSizeBytes / 100 * value, nil
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, err
+	}
+	if quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("size %s is not positive", size)
+	}
+	return uint64(quantity.Value()), nil
+}
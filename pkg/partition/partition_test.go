@@ -0,0 +1,143 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+)
+
+const gi = 1 << 30
+
+// fakeExecutor records the commands, and fails the ones in errors.
+type fakeExecutor struct {
+	commands []string
+	errors   map[string]bool
+}
+
+func (f *fakeExecutor) Execute(cmd string, args []string) (string, error) {
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	f.commands = append(f.commands, command)
+	if f.errors[command] {
+		return "", fmt.Errorf("failed to run %s", command)
+	}
+	return "", nil
+}
+
+func Test_partition(t *testing.T) {
+	executor := &fakeExecutor{}
+	var formatted []string
+	p := &partitioner{
+		executor: executor,
+		format: func(devPath, fsType, _ string) error {
+			formatted = append(formatted, devPath+":"+fsType)
+			return nil
+		},
+		exists: func(string) bool { return true },
+	}
+
+	partPaths, err := p.Partition("/dev/nvme0n1", "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e", 100*gi, []diskv1.PartitionInfo{
+		{Name: "longhorn", Size: "60%", FileSystem: "ext4"},
+		{Name: "cache", Size: "rest", TypeGUID: "A19D880F-05FC-4D3B-A006-743F0F84911E"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/nvme0n1p1", "/dev/nvme0n1p2"}, partPaths)
+	assert.Equal(t, []string{
+		"sgdisk --zap-all /dev/nvme0n1",
+		"sgdisk --disk-guid=6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e" +
+			" --new=1:0:+61440M --typecode=1:0FC63DAF-8483-4772-8E79-3D69D8477DE4 --change-name=1:longhorn" +
+			" --new=2:0:0 --typecode=2:A19D880F-05FC-4D3B-A006-743F0F84911E --change-name=2:cache /dev/nvme0n1",
+		"udevadm settle --timeout=0",
+	}, executor.commands)
+	assert.Equal(t, []string{"/dev/nvme0n1p1:ext4"}, formatted)
+}
+
+func Test_partitionNotCreated(t *testing.T) {
+	executor := &fakeExecutor{}
+	p := &partitioner{
+		executor: executor,
+		exists:   func(string) bool { return false },
+	}
+	_, err := p.Partition("/dev/sdb", "", 100*gi, []diskv1.PartitionInfo{{Name: "data", Size: "rest"}})
+	assert.Error(t, err)
+}
+
+func Test_sizes(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		partitions  []diskv1.PartitionInfo
+		expectSizes []uint64
+		expectErr   bool
+	}{
+		{
+			name:        "quantities and rest",
+			partitions:  []diskv1.PartitionInfo{{Name: "a", Size: "10Gi"}, {Name: "b", Size: "20G"}, {Name: "c", Size: "rest"}},
+			expectSizes: []uint64{10 * gi, 20000000000 / (1 << 20) * (1 << 20), 0},
+		},
+		{
+			name:        "percentages",
+			partitions:  []diskv1.PartitionInfo{{Name: "a", Size: "25%"}, {Name: "b", Size: "50%"}},
+			expectSizes: []uint64{25 * gi, 50 * gi},
+		},
+		{
+			name:       "rest is not the last",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "rest"}, {Name: "b", Size: "10Gi"}},
+			expectErr:  true,
+		},
+		{
+			name:       "exceed the disk",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "60%"}, {Name: "b", Size: "40%"}},
+			expectErr:  true,
+		},
+		{
+			name:       "invalid percentage",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "120%"}},
+			expectErr:  true,
+		},
+		{
+			name:       "invalid quantity",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "ten"}},
+			expectErr:  true,
+		},
+		{
+			name:       "less than 1Mi",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "512Ki"}},
+			expectErr:  true,
+		},
+		{
+			name:       "duplicated names",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "1Gi"}, {Name: "a", Size: "1Gi"}},
+			expectErr:  true,
+		},
+		{
+			name:       "invalid type GUID",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "1Gi", TypeGUID: "8300"}},
+			expectErr:  true,
+		},
+		{
+			name:       "unsupported filesystem",
+			partitions: []diskv1.PartitionInfo{{Name: "a", Size: "1Gi", FileSystem: "btrfs"}},
+			expectErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sizes, err := Sizes(tc.partitions, 100*gi)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectSizes, sizes)
+		})
+	}
+}
+
+func Test_devPath(t *testing.T) {
+	assert.Equal(t, "/dev/sda2", DevPath("/dev/sda", 2))
+	assert.Equal(t, "/dev/nvme0n1p1", DevPath("/dev/nvme0n1", 1))
+}
@@ -0,0 +1,118 @@
+package resize
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+var (
+	ext4BlockCountRegexp = regexp.MustCompile(`(?m)^Block count:\s+(\d+)$`)
+	ext4BlockSizeRegexp  = regexp.MustCompile(`(?m)^Block size:\s+(\d+)$`)
+	// the data section of xfs_info, e.g.
+	// data     =                       bsize=4096   blocks=262144, imaxpct=25
+	xfsDataRegexp = regexp.MustCompile(`(?m)^data\s+=\s+bsize=(\d+)\s+blocks=(\d+)`)
+)
+
+// Resizer expands the mounted filesystems of the grown devices
+type Resizer interface {
+	// FileSystemSize returns the size in bytes of the filesystem on the device
+	// mounted at the mount point.
+	FileSystemSize(devPath, mountPoint, fsType string) (uint64, error)
+	// Expand grows the filesystem on the device mounted at the mount point to
+	// fill the device online.
+	Expand(devPath, mountPoint, fsType string) error
+}
+
+type executor interface {
+	Execute(cmd string, args []string) (string, error)
+}
+
+type resizer struct {
+	executor executor
+}
+
+// NewResizer returns a Resizer running the commands on the host namespace if
+// the host `/proc` is mounted. The commands are not timed out, since growing a
+// large ext4 filesystem could take a while.
+func NewResizer() (Resizer, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	executor.SetTimeout(0)
+	return &resizer{executor: executor}, nil
+}
+
+func (r *resizer) FileSystemSize(devPath, mountPoint, fsType string) (uint64, error) {
+	switch fsType {
+	case utils.FileSystemTypeExt4:
+		out, err := r.executor.Execute("dumpe2fs", []string{"-h", devPath})
+		if err != nil {
+			return 0, fmt.Errorf("failed to read superblock of %s: %w", devPath, err)
+		}
+		return parseExt4Size(out)
+	case utils.FileSystemTypeXFS:
+		out, err := r.executor.Execute("xfs_info", []string{mountPoint})
+		if err != nil {
+			return 0, fmt.Errorf("failed to read geometry of %s: %w", mountPoint, err)
+		}
+		return parseXFSSize(out)
+	default:
+		return 0, fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+}
+
+func (r *resizer) Expand(devPath, mountPoint, fsType string) error {
+	logrus.Infof("Expand %s filesystem of device %s mounted at %s", fsType, devPath, mountPoint)
+	var err error
+	switch fsType {
+	case utils.FileSystemTypeExt4:
+		// resize2fs grows a mounted ext4 filesystem online
+		_, err = r.executor.Execute("resize2fs", []string{devPath})
+	case utils.FileSystemTypeXFS:
+		// xfs_growfs only works on the mount point
+		_, err = r.executor.Execute("xfs_growfs", []string{mountPoint})
+	default:
+		return fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to expand filesystem of %s: %w", devPath, err)
+	}
+	return nil
+}
+
+// parseExt4Size parses the size of the filesystem from the output of dumpe2fs
+func parseExt4Size(out string) (uint64, error) {
+	count := ext4BlockCountRegexp.FindStringSubmatch(out)
+	size := ext4BlockSizeRegexp.FindStringSubmatch(out)
+	if count == nil || size == nil {
+		return 0, fmt.Errorf("failed to find block count and block size in the superblock")
+	}
+	return multiply(size[1], count[1])
+}
+
+// parseXFSSize parses the size of the data section from the output of xfs_info
+func parseXFSSize(out string) (uint64, error) {
+	data := xfsDataRegexp.FindStringSubmatch(out)
+	if data == nil {
+		return 0, fmt.Errorf("failed to find data section in the geometry")
+	}
+	return multiply(data[1], data[2])
+}
+
+func multiply(blockSize, blockCount string) (uint64, error) {
+	size, err := strconv.ParseUint(blockSize, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseUint(blockCount, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return size * count, nil
+}
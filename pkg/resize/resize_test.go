@@ -0,0 +1,87 @@
+package resize
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecutor records the commands, and replies the outputs of the commands
+type fakeExecutor struct {
+	commands []string
+	outputs  map[string]string
+}
+
+func (f *fakeExecutor) Execute(cmd string, args []string) (string, error) {
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	f.commands = append(f.commands, command)
+	output := f.outputs[command]
+	if strings.HasPrefix(output, "error:") {
+		return "", fmt.Errorf("%s", output)
+	}
+	return output, nil
+}
+
+const dumpe2fsOutput = `Filesystem volume name:   <none>
+Filesystem UUID:          6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e
+Inode count:              6553600
+Block count:              26214400
+Reserved block count:     1310720
+Free blocks:              25656747
+First block:              0
+Block size:               4096
+Fragment size:            4096
+`
+
+const xfsInfoOutput = `meta-data=/dev/sdb               isize=512    agcount=4, agsize=6553600 blks
+         =                       sectsz=512   attr=2, projid32bit=1
+data     =                       bsize=4096   blocks=26214400, imaxpct=25
+         =                       sunit=0      swidth=0 blks
+naming   =version 2              bsize=4096   ascii-ci=0, ftype=1
+log      =internal log           bsize=4096   blocks=12800, version=2
+realtime =none                   extsz=4096   blocks=0, rtextents=0
+`
+
+func Test_fileSystemSize(t *testing.T) {
+	executor := &fakeExecutor{outputs: map[string]string{
+		"dumpe2fs -h /dev/sdb":                        dumpe2fsOutput,
+		"xfs_info /var/lib/harvester/extra-disks/bd1": xfsInfoOutput,
+		"dumpe2fs -h /dev/sdc":                        "error: bad magic number in super-block",
+		"xfs_info /var/lib/harvester/extra-disks/bd2": "meta-data=/dev/sdd",
+	}}
+	r := &resizer{executor: executor}
+
+	size, err := r.FileSystemSize("/dev/sdb", "/var/lib/harvester/extra-disks/bd1", "ext4")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100<<30), size)
+	size, err = r.FileSystemSize("/dev/sdb", "/var/lib/harvester/extra-disks/bd1", "xfs")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100<<30), size)
+
+	_, err = r.FileSystemSize("/dev/sdc", "/var/lib/harvester/extra-disks/bd2", "ext4")
+	assert.Error(t, err)
+	_, err = r.FileSystemSize("/dev/sdd", "/var/lib/harvester/extra-disks/bd2", "xfs")
+	assert.Error(t, err)
+	_, err = r.FileSystemSize("/dev/sdb", "/var/lib/harvester/extra-disks/bd1", "btrfs")
+	assert.Error(t, err)
+}
+
+func Test_expand(t *testing.T) {
+	executor := &fakeExecutor{outputs: map[string]string{
+		"xfs_growfs /var/lib/harvester/extra-disks/bd2": "error: not a mounted XFS filesystem",
+	}}
+	r := &resizer{executor: executor}
+
+	require.NoError(t, r.Expand("/dev/sdb", "/var/lib/harvester/extra-disks/bd1", "ext4"))
+	require.NoError(t, r.Expand("/dev/sdc", "/var/lib/harvester/extra-disks/bd1", "xfs"))
+	assert.Error(t, r.Expand("/dev/sdd", "/var/lib/harvester/extra-disks/bd2", "xfs"))
+	assert.Error(t, r.Expand("/dev/sde", "/var/lib/harvester/extra-disks/bd3", "btrfs"))
+	assert.Equal(t, []string{
+		"resize2fs /dev/sdb",
+		"xfs_growfs /var/lib/harvester/extra-disks/bd1",
+		"xfs_growfs /var/lib/harvester/extra-disks/bd2",
+	}, executor.commands)
+}
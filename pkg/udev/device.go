@@ -28,6 +28,9 @@ const (
 	UdevType          = "ID_TYPE"
 	UdevVendor        = "ID_VENDOR"
 	UdevWWN           = "ID_WWN"
+
+	// UdevMultipathDevicePath is set to "1" by the multipath udev rules on the paths of multipath devices
+	UdevMultipathDevicePath = "DM_MULTIPATH_DEVICE_PATH"
 )
 
 type Device map[string]string
@@ -67,6 +70,11 @@ func (device Device) IsPartition() bool {
 	return device[UdevDevtype] == UdevPartition
 }
 
+// IsMultipathPath check if device is claimed as a path of a multipath device
+func (device Device) IsMultipathPath() bool {
+	return device[UdevMultipathDevicePath] == "1"
+}
+
 // GetDevName returns the path of device in /dev directory
 func (device Device) GetDevName() string {
 	return device[UdevDevname]
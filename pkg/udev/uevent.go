@@ -14,6 +14,7 @@ import (
 	"github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
 	"github.com/harvester/node-disk-manager/pkg/block"
 	"github.com/harvester/node-disk-manager/pkg/controller/blockdevice"
+	"github.com/harvester/node-disk-manager/pkg/metrics"
 	"github.com/harvester/node-disk-manager/pkg/option"
 	"github.com/harvester/node-disk-manager/pkg/utils"
 )
@@ -102,6 +103,7 @@ func (u *Udev) ActionHandler(uevent netlink.UEvent) {
 	if !udevDevice.IsDisk() && !udevDevice.IsPartition() {
 		return
 	}
+	metrics.IncUdevEvent(string(uevent.Action))
 	logrus.Debugf("Prepare to handle event: %s, env: %+v", uevent.Action, uevent.Env)
 
 	var disk *block.Disk
@@ -121,6 +123,21 @@ func (u *Udev) ActionHandler(uevent netlink.UEvent) {
 		bd = blockdevice.GetPartitionBlockDevice(part, u.nodeName, u.namespace)
 	}
 
+	// multipath devices are collected by the scanner along with their paths,
+	// and only get their tables loaded on the change event
+	if udevDevice.IsMultipathPath() || disk.IsMultipathPath() || disk.IsMultipathPartition() {
+		logrus.Debugf("Skip %s event of %s, a path or partition of multipath device", uevent.Action, devPath)
+		return
+	}
+	if disk.IsMultipath() && (uevent.Action == netlink.ADD || uevent.Action == netlink.CHANGE) {
+		utils.CallerWithCondLock(u.scanner.Cond, func() any {
+			logrus.Infof("Wake up scanner with %s operation with multipath device: %s", uevent.Action, devPath)
+			u.scanner.Cond.Signal()
+			return nil
+		})
+		return
+	}
+
 	if u.scanner.ApplyExcludeFiltersForDisk(disk) {
 		return
 	}
@@ -131,12 +148,30 @@ func (u *Udev) ActionHandler(uevent netlink.UEvent) {
 
 	switch uevent.Action {
 	case netlink.ADD:
+		if bd.Name == "" && udevDevice.IsDisk() && u.scanner.GPTGenerator != nil {
+			// the scanner generates a GPT partition table for the blank disk
+			utils.CallerWithCondLock(u.scanner.Cond, func() any {
+				logrus.Infof("Wake up scanner with %s operation with non-identifiable disk: %s", netlink.ADD, devPath)
+				u.scanner.Cond.Signal()
+				return nil
+			})
+			return
+		}
 		if bd.Name == "" {
 			logrus.Infof("Skip adding non-identifiable block device %s", bd.Spec.DevPath)
 			return
 		}
 		utils.CallerWithCondLock(u.scanner.Cond, func() any {
-			autoProvisioned := udevDevice.IsDisk() && u.scanner.ApplyAutoProvisionFiltersForDisk(disk)
+			autoProvisioned := false
+			if udevDevice.IsDisk() {
+				// a matching policy takes precedence over the auto-provision filters
+				if policy := u.scanner.MatchProvisionPolicy(disk); policy != nil {
+					logrus.Infof("Apply disk provision policy %s to new device %s", policy.Name, bd.Name)
+					blockdevice.ApplyProvisionPolicy(bd, policy)
+				} else {
+					autoProvisioned = u.scanner.ApplyAutoProvisionFiltersForDisk(disk)
+				}
+			}
 			u.AddBlockDevice(bd, autoProvisioned)
 			logrus.Infof("Wake up scanner with %s operation with blockdevice: %s", netlink.ADD, bd.Name)
 			u.scanner.Cond.Signal()
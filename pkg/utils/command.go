@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"io"
 	"os/exec"
 	"path/filepath"
 	"time"
@@ -32,38 +33,120 @@ func NewExecutorWithNS(ns string) (*Executor, error) {
 	exec.namespace = ns
 
 	// test if nsenter is available
-	if _, err := execute(NSBinary, []string{"-V"}, cmdTimeoutNone); err != nil {
+	if _, err := execute(NSBinary, []string{"-V"}, nil, cmdTimeoutNone); err != nil {
 		return nil, errors.Wrap(err, "cannot find nsenter for namespace switching")
 	}
 	return exec, nil
 }
 
+// NewHostExecutor returns an Executor running commands on the host namespace
+// if the host `/proc` is mounted, or on the current namespace otherwise.
+func NewHostExecutor() (*Executor, error) {
+	isHostProcMounted, err := IsHostProcMounted()
+	if err != nil {
+		return nil, err
+	}
+	if !isHostProcMounted {
+		return NewExecutor(), nil
+	}
+	return NewExecutorWithNS(GetHostNamespacePath(HostProcPath))
+}
+
 func (exec *Executor) SetTimeout(timeout time.Duration) {
 	exec.cmdTimeout = timeout
 }
 
 func (exec *Executor) Execute(cmd string, args []string) (string, error) {
-	command := cmd
-	cmdArgs := args
-	if exec.namespace != "" {
-		cmdArgs = []string{
-			"--mount=" + filepath.Join(exec.namespace, "mnt"),
-			"--net=" + filepath.Join(exec.namespace, "net"),
-			"--ipc=" + filepath.Join(exec.namespace, "ipc"),
-			cmd,
-		}
-		command = NSBinary
-		cmdArgs = append(cmdArgs, args...)
+	command, cmdArgs := exec.commandLine(cmd, args)
+	return execute(command, cmdArgs, nil, exec.cmdTimeout)
+}
+
+// ExecuteWithStdin is like Execute, but feeds the stdin to the command. It
+// suits the secrets which should not show up in the command line, e.g. the
+// key of cryptsetup.
+func (exec *Executor) ExecuteWithStdin(cmd string, args []string, stdin []byte) (string, error) {
+	command, cmdArgs := exec.commandLine(cmd, args)
+	return execute(command, cmdArgs, stdin, exec.cmdTimeout)
+}
+
+// ExecuteWithExitCode is like Execute, but a non-zero exit code is returned
+// along with the output instead of an error. It suits the commands reporting
+// their results in the exit code bits, e.g. smartctl.
+func (exec *Executor) ExecuteWithExitCode(cmd string, args []string) (string, int, error) {
+	command, cmdArgs := exec.commandLine(cmd, args)
+	return executeWithExitCode(command, cmdArgs, exec.cmdTimeout)
+}
+
+// ExecuteCombinedWithExitCode is like ExecuteWithExitCode, but the stderr is
+// interleaved with the output. It suits the commands reporting to stderr, e.g.
+// xfs_repair.
+func (exec *Executor) ExecuteCombinedWithExitCode(cmd string, args []string) (string, int, error) {
+	command, cmdArgs := exec.commandLine(cmd, args)
+	return executeCombinedWithExitCode(command, cmdArgs, exec.cmdTimeout)
+}
+
+func (exec *Executor) commandLine(cmd string, args []string) (string, []string) {
+	if exec.namespace == "" {
+		return cmd, args
 	}
-	return execute(command, cmdArgs, exec.cmdTimeout)
+	cmdArgs := []string{
+		"--mount=" + filepath.Join(exec.namespace, "mnt"),
+		"--net=" + filepath.Join(exec.namespace, "net"),
+		"--ipc=" + filepath.Join(exec.namespace, "ipc"),
+		cmd,
+	}
+	return NSBinary, append(cmdArgs, args...)
 }
 
-func execute(command string, args []string, timeout time.Duration) (string, error) {
-	cmd := exec.Command(command, args...)
+func execute(command string, args []string, stdin []byte, timeout time.Duration) (string, error) {
+	output, stderr, err := run(command, args, stdin, timeout)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to execute: %v %v, output %s, stderr %s",
+			command, args, output, stderr)
+	}
+	return output, nil
+}
+
+func executeWithExitCode(command string, args []string, timeout time.Duration) (string, int, error) {
+	output, stderr, err := run(command, args, nil, timeout)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return output, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "failed to execute: %v %v, output %s, stderr %s",
+			command, args, output, stderr)
+	}
+	return output, 0, nil
+}
+
+func executeCombinedWithExitCode(command string, args []string, timeout time.Duration) (string, int, error) {
+	var output bytes.Buffer
+	err := start(command, args, nil, timeout, &output, &output)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return output.String(), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "failed to execute: %v %v, output %s",
+			command, args, output.String())
+	}
+	return output.String(), 0, nil
+}
 
+func run(command string, args []string, stdin []byte, timeout time.Duration) (string, string, error) {
 	var output, stderr bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &stderr
+	err := start(command, args, stdin, timeout, &output, &stderr)
+	return output.String(), stderr.String(), err
+}
+
+func start(command string, args []string, stdin []byte, timeout time.Duration, stdout, stderr io.Writer) error {
+	cmd := exec.Command(command, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	timer := time.NewTimer(cmdTimeoutNone)
 	if timeout != cmdTimeoutNone {
@@ -74,10 +157,5 @@ func execute(command string, args []string, timeout time.Duration) (string, erro
 	}
 	defer timer.Stop()
 
-	if err := cmd.Run(); err != nil {
-		return "", errors.Wrapf(err, "failed to execute: %v %v, output %s, stderr %s",
-			command, args, output.String(), stderr.String())
-	}
-
-	return output.String(), nil
+	return cmd.Run()
 }
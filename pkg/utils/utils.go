@@ -9,6 +9,7 @@ import (
 	"syscall"
 
 	"github.com/longhorn/longhorn-manager/util"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -18,6 +19,11 @@ const (
 	HostProcPath = "/host/proc"
 	// DiskRemoveTag indicates a Longhorn is pending to remove.
 	DiskRemoveTag = "harvester-ndm-disk-remove"
+
+	// FileSystemTypeExt4 is the default filesystem type used to format a device.
+	FileSystemTypeExt4 = "ext4"
+	// FileSystemTypeXFS is the XFS filesystem type.
+	FileSystemTypeXFS = "xfs"
 )
 
 var ext4MountOptions = strings.Join([]string{
@@ -27,6 +33,24 @@ var ext4MountOptions = strings.Join([]string{
 	"errors=remount-ro",
 }, ",")
 
+var xfsMountOptions = strings.Join([]string{
+	"inode64",
+}, ",")
+
+// allowedMountOptions are the mount options which could be set per device on
+// top of the default ones of each filesystem type.
+var allowedMountOptions = map[string][]string{
+	FileSystemTypeExt4: {"noatime", "nodiratime", "discard", "data=journal", "data=writeback"},
+	FileSystemTypeXFS:  {"noatime", "nodiratime", "discard", "largeio", "swalloc"},
+}
+
+// mountFlagOptions are the mount options passed as mount flags rather than
+// filesystem specific data.
+var mountFlagOptions = map[string]uintptr{
+	"noatime":    syscall.MS_NOATIME,
+	"nodiratime": syscall.MS_NODIRATIME,
+}
+
 // IsHostProcMounted checks if host's proc info `/proc` is mounted on `/host/proc`
 func IsHostProcMounted() (bool, error) {
 	_, err := os.Stat(HostProcPath)
@@ -62,20 +86,74 @@ func ContainsIgnoredCase(s []string, k string) bool {
 	return false
 }
 
+// runMkfs runs the mkfs command, it is replaced in tests
+var runMkfs = func(cmd string, args []string) error {
+	_, err := exec.Command(cmd, args...).CombinedOutput() // #nosec G204
+	return err
+}
+
+// MakeDiskFormatting formats the device with the given filesystem type.
+func MakeDiskFormatting(devPath, fsType, uuid string) error {
+	switch fsType {
+	case FileSystemTypeExt4:
+		return MakeExt4DiskFormatting(devPath, uuid)
+	case FileSystemTypeXFS:
+		return MakeXFSDiskFormatting(devPath, uuid)
+	default:
+		return fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+}
+
 func MakeExt4DiskFormatting(devPath, uuid string) error {
 	args := []string{"-F", devPath}
 	if uuid != "" {
 		args = append(args, "-U", uuid)
 	}
-	cmd := exec.Command("mkfs.ext4", args...)
-	if _, err := cmd.CombinedOutput(); err != nil {
+	if err := runMkfs("mkfs.ext4", args); err != nil {
 		return fmt.Errorf("failed to format %s. err: %v", devPath, err)
 	}
 	return nil
 }
 
-// MountDisk mounts the specified ext4 volume device to the specified path
-func MountDisk(devPath, mountPoint string) error {
+func MakeXFSDiskFormatting(devPath, uuid string) error {
+	args := []string{"-f", devPath}
+	if uuid != "" {
+		args = append(args, "-m", "uuid="+uuid)
+	}
+	if err := runMkfs("mkfs.xfs", args); err != nil {
+		return fmt.Errorf("failed to format %s. err: %v", devPath, err)
+	}
+	return nil
+}
+
+// AllowedMountOptions returns the mount options which could be set per device
+// for the given filesystem type.
+func AllowedMountOptions(fsType string) []string {
+	return allowedMountOptions[fsType]
+}
+
+// ValidateMountOptions returns an error if any of the mount options is not
+// allowed for the given filesystem type.
+func ValidateMountOptions(fsType string, opts []string) error {
+	allowed, ok := allowedMountOptions[fsType]
+	if !ok {
+		return fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+	for _, opt := range opts {
+		if !slices.Contains(allowed, opt) {
+			return fmt.Errorf("mount option %s is not allowed for %s, allowed options: %s", opt, fsType, strings.Join(allowed, ","))
+		}
+	}
+	return nil
+}
+
+// MountDisk mounts the specified volume device to the specified path with the
+// given filesystem type and extra mount options
+func MountDisk(devPath, mountPoint, fsType string, opts []string) error {
+	if err := ValidateMountOptions(fsType, opts); err != nil {
+		return err
+	}
+
 	var needMkdir bool
 	if _, err := os.Stat(mountPoint); err != nil && !os.IsNotExist(err) {
 		return err
@@ -101,10 +179,10 @@ func MountDisk(devPath, mountPoint string) error {
 	}
 
 	if isHostProcMounted {
-		return mountExt4OnHostNamespace(devPath, mountPoint, false)
+		return mountOnHostNamespace(devPath, mountPoint, fsType, opts, false)
 	}
 
-	return mountExt4(devPath, mountPoint, false)
+	return mount(devPath, mountPoint, fsType, opts, false)
 }
 
 // UmountDisk unmounts the specified volume device to the specified path
@@ -121,30 +199,65 @@ func UmountDisk(path string) error {
 	return os.NewSyscallError("umount", err)
 }
 
-func mountExt4(device, path string, readonly bool) error {
+// defaultMountOptions returns the default mount options of a filesystem type
+func defaultMountOptions(fsType string) (string, error) {
+	switch fsType {
+	case FileSystemTypeExt4:
+		return ext4MountOptions, nil
+	case FileSystemTypeXFS:
+		return xfsMountOptions, nil
+	default:
+		return "", fmt.Errorf("unsupported filesystem type %s", fsType)
+	}
+}
+
+func mount(device, path, fsType string, extraOpts []string, readonly bool) error {
+	opts, err := defaultMountOptions(fsType)
+	if err != nil {
+		return err
+	}
 	var flags uintptr
 	flags = syscall.MS_RELATIME
+	for _, opt := range extraOpts {
+		if flag, ok := mountFlagOptions[opt]; ok {
+			if flag == syscall.MS_NOATIME {
+				flags &^= syscall.MS_RELATIME
+			}
+			flags |= flag
+			continue
+		}
+		opts = opts + "," + opt
+	}
 	if readonly {
 		flags |= syscall.MS_RDONLY
 	}
-	err := syscall.Mount(device, path, "ext4", flags, ext4MountOptions)
+	err = syscall.Mount(device, path, fsType, flags, opts)
 	return os.NewSyscallError("mount", err)
 }
 
-// mountExt4OnHostNamespace provides the same functionality as mountExt4 but on host namespace.
-func mountExt4OnHostNamespace(device, path string, readonly bool) error {
+// mountOnHostNamespace provides the same functionality as mount but on host namespace.
+func mountOnHostNamespace(device, path, fsType string, extraOpts []string, readonly bool) error {
+	opts, err := defaultMountOptions(fsType)
+	if err != nil {
+		return err
+	}
 	ns := GetHostNamespacePath(util.HostProcPath)
 	executor, err := NewExecutorWithNS(ns)
 	if err != nil {
 		return err
 	}
 
-	opts := ext4MountOptions + ",relatime"
+	if !slices.Contains(extraOpts, "noatime") {
+		opts = opts + ",relatime"
+	}
+	for _, opt := range extraOpts {
+		opts = opts + "," + opt
+	}
 	if readonly {
 		opts = opts + ",ro"
 	}
 
-	_, err = executor.Execute("mount", []string{"-t", "ext4", "-o", opts, device, path})
+	_, err = executor.Execute("mount", []string{"-t", fsType, "-o", opts, device, path})
 	return err
 }
 
@@ -163,7 +276,7 @@ func IsFSCorrupted(err error) bool {
 }
 
 func IsSupportedFileSystem(fsType string) bool {
-	if fsType == "ext4" || fsType == "xfs" {
+	if fsType == FileSystemTypeExt4 || fsType == FileSystemTypeXFS {
 		return true
 	}
 	return false
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_makeDiskFormatting(t *testing.T) {
+	var commands []string
+	orig := runMkfs
+	t.Cleanup(func() { runMkfs = orig })
+	runMkfs = func(cmd string, args []string) error {
+		command := strings.Join(append([]string{cmd}, args...), " ")
+		commands = append(commands, command)
+		if strings.Contains(command, "/dev/sdc") {
+			return fmt.Errorf("exit status 1")
+		}
+		return nil
+	}
+
+	require.NoError(t, MakeDiskFormatting("/dev/sdb", FileSystemTypeExt4, "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e"))
+	require.NoError(t, MakeDiskFormatting("/dev/sdb", FileSystemTypeXFS, "6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e"))
+	require.NoError(t, MakeDiskFormatting("/dev/sdb", FileSystemTypeXFS, ""))
+	assert.ErrorContains(t, MakeDiskFormatting("/dev/sdc", FileSystemTypeXFS, ""), "failed to format /dev/sdc")
+	assert.ErrorContains(t, MakeDiskFormatting("/dev/sdb", "btrfs", ""), "unsupported filesystem type btrfs")
+	assert.Equal(t, []string{
+		"mkfs.ext4 -F /dev/sdb -U 6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e",
+		"mkfs.xfs -f /dev/sdb -m uuid=6b9c3d4e-1f2a-4b5c-8d7e-9f0a1b2c3d4e",
+		"mkfs.xfs -f /dev/sdb",
+		"mkfs.xfs -f /dev/sdc",
+	}, commands)
+}
+
+func Test_defaultMountOptions(t *testing.T) {
+	opts, err := defaultMountOptions(FileSystemTypeExt4)
+	require.NoError(t, err)
+	assert.Equal(t, "journal_checksum,journal_ioprio=0,barrier=1,errors=remount-ro", opts)
+	opts, err = defaultMountOptions(FileSystemTypeXFS)
+	require.NoError(t, err)
+	assert.Equal(t, "inode64", opts)
+	_, err = defaultMountOptions("btrfs")
+	assert.Error(t, err)
+}
+
+func Test_validateMountOptions(t *testing.T) {
+	assert.NoError(t, ValidateMountOptions(FileSystemTypeXFS, []string{"noatime", "largeio", "swalloc"}))
+	assert.Error(t, ValidateMountOptions(FileSystemTypeXFS, []string{"data=journal"}))
+	assert.NoError(t, ValidateMountOptions(FileSystemTypeExt4, []string{"data=journal"}))
+	assert.Error(t, ValidateMountOptions(FileSystemTypeExt4, []string{"largeio"}))
+	assert.Error(t, ValidateMountOptions("btrfs", nil))
+}
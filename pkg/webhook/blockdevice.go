@@ -0,0 +1,461 @@
+package webhook
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	ghwblock "github.com/jaypipes/ghw/pkg/block"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/strings/slices"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/block"
+	blockdevicev1 "github.com/harvester/node-disk-manager/pkg/controller/blockdevice"
+	"github.com/harvester/node-disk-manager/pkg/filter"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/partition"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+// blockDeviceValidator rejects the blockdevice spec transitions which the
+// controller would refuse or which would damage the node.
+type blockDeviceValidator struct {
+	cache   ctldiskv1.BlockDeviceCache
+	filters ExcludeFilterResolver
+}
+
+// ExcludeFilterResolver resolves the exclude filters of the scanner of a node
+type ExcludeFilterResolver interface {
+	ExcludeFilters(nodeName string) []*filter.Filter
+}
+
+func newBlockDeviceValidator(cache ctldiskv1.BlockDeviceCache, filters ExcludeFilterResolver) *blockDeviceValidator {
+	return &blockDeviceValidator{
+		cache:   cache,
+		filters: filters,
+	}
+}
+
+// Validate returns an error if the operation on the blockdevice is not allowed
+func (v *blockDeviceValidator) Validate(op admissionv1.Operation, oldBd, newBd *diskv1.BlockDevice) error {
+	switch op {
+	case admissionv1.Create:
+		return v.validateSpec(&diskv1.BlockDevice{}, newBd)
+	case admissionv1.Update:
+		if err := validateImmutableFields(oldBd, newBd); err != nil {
+			return err
+		}
+		return v.validateSpec(oldBd, newBd)
+	default:
+		return nil
+	}
+}
+
+func validateImmutableFields(oldBd, newBd *diskv1.BlockDevice) error {
+	if oldBd.Spec.NodeName != newBd.Spec.NodeName {
+		return fmt.Errorf("spec.nodeName of blockdevice %s is immutable", newBd.Name)
+	}
+	if oldBd.Spec.DevPath != newBd.Spec.DevPath {
+		return fmt.Errorf("spec.devPath of blockdevice %s is immutable", newBd.Name)
+	}
+	return nil
+}
+
+// validateSpec only validates the fields changed from oldBd, so the objects
+// created before the webhook are not stuck.
+func (v *blockDeviceValidator) validateSpec(oldBd, newBd *diskv1.BlockDevice) error {
+	if !slices.Equal(oldBd.Spec.Tags, newBd.Spec.Tags) && slices.Contains(newBd.Spec.Tags, utils.DiskRemoveTag) {
+		return fmt.Errorf("tag %s is reserved for unprovisioning disks", utils.DiskRemoveTag)
+	}
+
+	if !reflect.DeepEqual(oldBd.Spec.Provisioner, newBd.Spec.Provisioner) {
+		if !isUnprovisioned(oldBd) {
+			return fmt.Errorf("spec.provisioner of blockdevice %s cannot be changed until it is unprovisioned", newBd.Name)
+		}
+		if p := newBd.Spec.Provisioner; p != nil && p.Longhorn != nil && p.LVM != nil {
+			return fmt.Errorf("only one of spec.provisioner.longhorn and spec.provisioner.lvm could be set")
+		}
+	}
+
+	if oldBd.Spec.Replaces != newBd.Spec.Replaces && newBd.Spec.Replaces != "" {
+		if oldBd.Spec.Replaces != "" {
+			return fmt.Errorf("spec.replaces of blockdevice %s cannot be changed once set", newBd.Name)
+		}
+		if err := v.validateReplaces(newBd); err != nil {
+			return err
+		}
+	}
+
+	if !reflect.DeepEqual(oldBd.Spec.Wipe, newBd.Spec.Wipe) && newBd.Spec.Wipe != nil {
+		if err := v.validateWipe(oldBd, newBd); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(oldBd.Spec.Partitions, newBd.Spec.Partitions) && len(newBd.Spec.Partitions) > 0 {
+		if err := v.validatePartitions(oldBd, newBd); err != nil {
+			return err
+		}
+	}
+
+	oldFS := oldBd.Spec.FileSystem
+	if oldFS == nil {
+		oldFS = &diskv1.FilesystemInfo{}
+	}
+	newFS := newBd.Spec.FileSystem
+	if newFS == nil {
+		return nil
+	}
+
+	if !reflect.DeepEqual(oldFS.Encryption, newFS.Encryption) {
+		if err := validateEncryption(oldBd, newBd); err != nil {
+			return err
+		}
+	}
+	// the filesystem is never formatted again with another type, see forceFormat
+	// of the controller, "" is ext4 by default
+	if fileSystemType(oldFS) != fileSystemType(newFS) {
+		if status := oldBd.Status.DeviceStatus.FileSystem; status != nil && status.LastFormattedAt != nil {
+			return fmt.Errorf("spec.fileSystem.type of blockdevice %s cannot be changed once it is formatted", newBd.Name)
+		}
+	}
+	if oldFS.Repair != newFS.Repair && newFS.Repair != "" {
+		if err := validateRepair(newBd); err != nil {
+			return err
+		}
+	}
+	if newFS.Provisioned && !oldFS.Provisioned && len(newBd.Spec.Partitions) > 0 {
+		return fmt.Errorf("blockdevice %s with spec.partitions cannot be provisioned as a whole, please provision its partitions instead", newBd.Name)
+	}
+	if newFS.Provisioned && !oldFS.Provisioned && newBd.Status.Wipe != nil && newBd.Status.Wipe.Phase == diskv1.WipePhaseWiping {
+		return fmt.Errorf("blockdevice %s cannot be provisioned while it is being wiped", newBd.Name)
+	}
+
+	if newFS.ForceFormatted && !oldFS.ForceFormatted {
+		if name, excluded := v.excludedBy(newBd); excluded {
+			return fmt.Errorf("blockdevice %s is excluded by the %s and cannot be formatted", newBd.Name, name)
+		}
+	}
+
+	if (newFS.Provisioned && !oldFS.Provisioned) || (newFS.ForceFormatted && !oldFS.ForceFormatted) {
+		if err := v.validatePartitionConflicts(newBd); err != nil {
+			return err
+		}
+	}
+
+	// formatting wipes the partitions, see forceFormat of the controller, but
+	// block disks are never formatted
+	if newFS.Provisioned && !oldFS.Provisioned && newBd.Status.DeviceStatus.Partitioned {
+		if isLonghornBlockDisk(newBd) {
+			return fmt.Errorf("partitioned blockdevice %s cannot be provisioned as a block disk", newBd.Name)
+		}
+		if !newFS.ForceFormatted {
+			return fmt.Errorf("partitioned blockdevice %s cannot be provisioned without formatting, please format it or provision its partitions instead", newBd.Name)
+		}
+	}
+	return nil
+}
+
+// validatePartitionConflicts makes sure a disk and its partitions are never
+// provisioned at the same time, since formatting or wiping the disk destroys
+// the partitions.
+func (v *blockDeviceValidator) validatePartitionConflicts(bd *diskv1.BlockDevice) error {
+	switch bd.Status.DeviceStatus.Details.DeviceType {
+	case diskv1.DeviceTypeDisk:
+		for _, part := range v.partitionsOf(bd) {
+			if isProvisioned(part) {
+				return fmt.Errorf("partition %s of blockdevice %s is provisioned", part.Name, bd.Name)
+			}
+		}
+	case diskv1.DeviceTypePart:
+		if parent := v.parentOf(bd); parent != nil && isProvisioned(parent) {
+			return fmt.Errorf("parent blockdevice %s of partition %s is provisioned", parent.Name, bd.Name)
+		}
+	}
+	return nil
+}
+
+// validateReplaces makes sure the replaced device is an inactive disk of the
+// same node, which is not a LVM physical volume.
+func (v *blockDeviceValidator) validateReplaces(bd *diskv1.BlockDevice) error {
+	if bd.Spec.Replaces == bd.Name {
+		return fmt.Errorf("blockdevice %s cannot replace itself", bd.Name)
+	}
+	if !isUnprovisioned(bd) {
+		return fmt.Errorf("blockdevice %s cannot replace another one until it is unprovisioned", bd.Name)
+	}
+	replaced, err := v.cache.Get(bd.Namespace, bd.Spec.Replaces)
+	if err != nil {
+		return fmt.Errorf("failed to get blockdevice %s to replace: %w", bd.Spec.Replaces, err)
+	}
+	if replaced.Spec.NodeName != bd.Spec.NodeName {
+		return fmt.Errorf("blockdevice %s to replace is not on node %s", replaced.Name, bd.Spec.NodeName)
+	}
+	if replaced.Status.State != diskv1.BlockDeviceInactive {
+		return fmt.Errorf("blockdevice %s to replace is not inactive", replaced.Name)
+	}
+	if replaced.Status.DeviceStatus.Details.DeviceType != bd.Status.DeviceStatus.Details.DeviceType {
+		return fmt.Errorf("blockdevice %s to replace is not of device type %s", replaced.Name, bd.Status.DeviceStatus.Details.DeviceType)
+	}
+	if p := replaced.Spec.Provisioner; replaced.Status.VolumeGroup != nil || (p != nil && p.LVM != nil) {
+		return fmt.Errorf("blockdevice %s to replace is a LVM physical volume, which is not supported", replaced.Name)
+	}
+	return nil
+}
+
+// validatePartitions makes sure the disk could be partitioned, and the
+// partitions fit in it.
+func (v *blockDeviceValidator) validatePartitions(oldBd, newBd *diskv1.BlockDevice) error {
+	details := newBd.Status.DeviceStatus.Details
+	if details.DeviceType != diskv1.DeviceTypeDisk {
+		return fmt.Errorf("blockdevice %s is not a disk and cannot be partitioned", newBd.Name)
+	}
+	if details.DMUUID != "" {
+		return fmt.Errorf("partitioning multipath blockdevice %s is not supported", newBd.Name)
+	}
+	if len(oldBd.Spec.Partitions) > 0 && diskv1.DiskPartitioned.IsTrue(oldBd) {
+		return fmt.Errorf("blockdevice %s is partitioned, please remove spec.partitions first to partition it again", newBd.Name)
+	}
+	if !isUnprovisioned(oldBd) || (newBd.Spec.FileSystem != nil && newBd.Spec.FileSystem.Provisioned) {
+		return fmt.Errorf("blockdevice %s cannot be partitioned until it is unprovisioned", newBd.Name)
+	}
+	if name, excluded := v.excludedBy(newBd); excluded {
+		return fmt.Errorf("blockdevice %s is excluded by the %s and cannot be partitioned", newBd.Name, name)
+	}
+	if err := v.validatePartitionConflicts(newBd); err != nil {
+		return err
+	}
+	if size := newBd.Status.DeviceStatus.Capacity.SizeBytes; size > 0 {
+		if _, err := partition.Sizes(newBd.Spec.Partitions, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateWipe makes sure the device is unprovisioned and not excluded, and the
+// mode is supported by the device.
+func (v *blockDeviceValidator) validateWipe(oldBd, newBd *diskv1.BlockDevice) error {
+	if !isUnprovisioned(oldBd) || (newBd.Spec.FileSystem != nil && newBd.Spec.FileSystem.Provisioned) {
+		return fmt.Errorf("blockdevice %s cannot be wiped until it is unprovisioned", newBd.Name)
+	}
+	if name, excluded := v.excludedBy(newBd); excluded {
+		return fmt.Errorf("blockdevice %s is excluded by the %s and cannot be wiped", newBd.Name, name)
+	}
+	if err := v.validatePartitionConflicts(newBd); err != nil {
+		return err
+	}
+
+	details := newBd.Status.DeviceStatus.Details
+	isNVMe := details.StorageController == string(diskv1.StorageControllerNVMe)
+	switch mode := newBd.Spec.Wipe.Mode; mode {
+	case diskv1.WipeModeNVMeFormat, diskv1.WipeModeNVMeSanitize:
+		if details.DeviceType != diskv1.DeviceTypeDisk || !isNVMe {
+			return fmt.Errorf("wipe mode %s is only supported by NVMe disks", mode)
+		}
+	case diskv1.WipeModeATASecureErase:
+		if details.DeviceType != diskv1.DeviceTypeDisk || isNVMe {
+			return fmt.Errorf("wipe mode %s is only supported by ATA disks", mode)
+		}
+	}
+	return nil
+}
+
+// validateEncryption allows to set or change the encryption of a device only
+// before it is formatted, since a device is encrypted when it is formatted.
+func validateEncryption(oldBd, newBd *diskv1.BlockDevice) error {
+	if status := oldBd.Status.DeviceStatus.FileSystem; status != nil && (status.LastFormattedAt != nil || status.Encrypted) {
+		return fmt.Errorf("spec.fileSystem.encryption of blockdevice %s cannot be changed once it is formatted", newBd.Name)
+	}
+	if newBd.Spec.FileSystem.Encryption == nil {
+		return nil
+	}
+	if isLonghornBlockDisk(newBd) {
+		return fmt.Errorf("blockdevice %s provisioned as a block disk is never formatted and cannot be encrypted", newBd.Name)
+	}
+	if p := newBd.Spec.Provisioner; p != nil && p.LVM != nil {
+		return fmt.Errorf("blockdevice %s provisioned to a volume group cannot be encrypted", newBd.Name)
+	}
+	if !newBd.Spec.FileSystem.ForceFormatted {
+		return fmt.Errorf("blockdevice %s is only encrypted when it is formatted, please set spec.fileSystem.forceFormatted as well", newBd.Name)
+	}
+	return nil
+}
+
+// validateRepair allows to check only the filesystems managed by NDM which are
+// not mounted, since e2fsck and xfs_repair damage a mounted filesystem.
+func validateRepair(bd *diskv1.BlockDevice) error {
+	if isLonghornBlockDisk(bd) {
+		return fmt.Errorf("blockdevice %s provisioned as a block disk has no filesystem to check", bd.Name)
+	}
+	if p := bd.Spec.Provisioner; (p != nil && p.LVM != nil) || bd.Status.VolumeGroup != nil {
+		return fmt.Errorf("blockdevice %s provisioned to a volume group has no filesystem to check", bd.Name)
+	}
+	if status := bd.Status.DeviceStatus.FileSystem; status != nil && status.MountPoint != "" && !status.Corrupted {
+		return fmt.Errorf("blockdevice %s is mounted at %s, please unprovision it before checking its filesystem", bd.Name, status.MountPoint)
+	}
+	return nil
+}
+
+func fileSystemType(fs *diskv1.FilesystemInfo) string {
+	if fs.Type == "" {
+		return utils.FileSystemTypeExt4
+	}
+	return fs.Type
+}
+
+func isLonghornBlockDisk(bd *diskv1.BlockDevice) bool {
+	p := bd.Spec.Provisioner
+	return p != nil && p.Longhorn != nil && p.Longhorn.DiskType == diskv1.LonghornDiskTypeBlock
+}
+
+func isUnprovisioned(bd *diskv1.BlockDevice) bool {
+	phase := bd.Status.ProvisionPhase
+	return (phase == "" || phase == diskv1.ProvisionPhaseUnprovisioned) && bd.Status.VolumeGroup == nil
+}
+
+// isProvisioned returns true if the device is provisioned, or is going to be.
+func isProvisioned(bd *diskv1.BlockDevice) bool {
+	return !isUnprovisioned(bd) || (bd.Spec.FileSystem != nil && bd.Spec.FileSystem.Provisioned)
+}
+
+// excludedBy returns the name of the exclude filter of the node matching the
+// device, or the parent disk of a partition.
+func (v *blockDeviceValidator) excludedBy(bd *diskv1.BlockDevice) (string, bool) {
+	excludeFilters := v.filters.ExcludeFilters(bd.Spec.NodeName)
+	switch bd.Status.DeviceStatus.Details.DeviceType {
+	case diskv1.DeviceTypeDisk:
+		disk := blockDeviceToDisk(bd, v.partitionsOf(bd))
+		return excludedDiskBy(excludeFilters, disk)
+	case diskv1.DeviceTypePart:
+		var disk *block.Disk
+		if parent := v.parentOf(bd); parent != nil {
+			disk = blockDeviceToDisk(parent, v.partitionsOf(parent))
+			if name, excluded := excludedDiskBy(excludeFilters, disk); excluded {
+				return name, true
+			}
+		}
+		part := blockDeviceToPartition(bd, disk)
+		for _, f := range excludeFilters {
+			if f.ApplyPartFilter(part) {
+				return f.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func excludedDiskBy(excludeFilters []*filter.Filter, disk *block.Disk) (string, bool) {
+	for _, f := range excludeFilters {
+		if f.ApplyDiskFilter(disk) {
+			return f.Name, true
+		}
+	}
+	return "", false
+}
+
+func (v *blockDeviceValidator) parentOf(part *diskv1.BlockDevice) *diskv1.BlockDevice {
+	parentName := part.Labels[blockdevicev1.ParentDeviceLabel]
+	if parentName == "" {
+		return nil
+	}
+	parent, err := v.cache.Get(part.Namespace, parentName)
+	if err != nil {
+		return nil
+	}
+	return parent
+}
+
+func (v *blockDeviceValidator) partitionsOf(disk *diskv1.BlockDevice) []*diskv1.BlockDevice {
+	parts, err := v.cache.List(disk.Namespace, labels.SelectorFromSet(map[string]string{
+		corev1.LabelHostname:            disk.Spec.NodeName,
+		blockdevicev1.ParentDeviceLabel: disk.Name,
+	}))
+	if err != nil {
+		return nil
+	}
+	return parts
+}
+
+// blockDeviceToDisk rebuilds the disk seen by the scanner from the status of
+// the blockdevice, so the exclude filters could be applied on it.
+func blockDeviceToDisk(bd *diskv1.BlockDevice, parts []*diskv1.BlockDevice) *block.Disk {
+	details := bd.Status.DeviceStatus.Details
+	disk := &block.Disk{
+		Name:              strings.TrimPrefix(bd.Status.DeviceStatus.DevPath, "/dev/"),
+		Label:             details.Label,
+		SizeBytes:         bd.Status.DeviceStatus.Capacity.SizeBytes,
+		DriveType:         driveType(details.DriveType),
+		StorageController: storageController(details.StorageController),
+		BusPath:           details.BusPath,
+		Vendor:            details.Vendor,
+		Model:             details.Model,
+		SerialNumber:      details.SerialNumber,
+		WWN:               details.WWN,
+	}
+	if fs := bd.Status.DeviceStatus.FileSystem; fs != nil {
+		disk.FileSystemInfo = block.FileSystemInfo{
+			Type:       fs.Type,
+			IsReadOnly: fs.IsReadOnly,
+			MountPoint: fs.MountPoint,
+		}
+	}
+	for _, part := range parts {
+		disk.Partitions = append(disk.Partitions, blockDeviceToPartition(part, disk))
+	}
+	return disk
+}
+
+func blockDeviceToPartition(bd *diskv1.BlockDevice, disk *block.Disk) *block.Partition {
+	details := bd.Status.DeviceStatus.Details
+	part := &block.Partition{
+		Disk:              disk,
+		Name:              strings.TrimPrefix(bd.Status.DeviceStatus.DevPath, "/dev/"),
+		Label:             details.Label,
+		SizeBytes:         bd.Status.DeviceStatus.Capacity.SizeBytes,
+		UUID:              details.PartUUID,
+		FsUUID:            details.UUID,
+		PartType:          details.PartType,
+		DriveType:         driveType(details.DriveType),
+		StorageController: storageController(details.StorageController),
+	}
+	if fs := bd.Status.DeviceStatus.FileSystem; fs != nil {
+		part.FileSystemInfo = block.FileSystemInfo{
+			Type:       fs.Type,
+			IsReadOnly: fs.IsReadOnly,
+			MountPoint: fs.MountPoint,
+		}
+	}
+	return part
+}
+
+func driveType(s string) ghwblock.DriveType {
+	for _, t := range []ghwblock.DriveType{
+		ghwblock.DRIVE_TYPE_HDD,
+		ghwblock.DRIVE_TYPE_FDD,
+		ghwblock.DRIVE_TYPE_ODD,
+		ghwblock.DRIVE_TYPE_SSD,
+	} {
+		if t.String() == s {
+			return t
+		}
+	}
+	return ghwblock.DRIVE_TYPE_UNKNOWN
+}
+
+func storageController(s string) ghwblock.StorageController {
+	for _, c := range []ghwblock.StorageController{
+		ghwblock.STORAGE_CONTROLLER_IDE,
+		ghwblock.STORAGE_CONTROLLER_SCSI,
+		ghwblock.STORAGE_CONTROLLER_NVME,
+		ghwblock.STORAGE_CONTROLLER_VIRTIO,
+		ghwblock.STORAGE_CONTROLLER_MMC,
+	} {
+		if c.String() == s {
+			return c
+		}
+	}
+	return ghwblock.STORAGE_CONTROLLER_UNKNOWN
+}
@@ -0,0 +1,868 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	blockdevicev1 "github.com/harvester/node-disk-manager/pkg/controller/blockdevice"
+	"github.com/harvester/node-disk-manager/pkg/filter"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	testNamespace = "longhorn-system"
+	testNode      = "node1"
+)
+
+// fakeBlockDeviceCache only implements Get and List over a fixed set of blockdevices.
+type fakeBlockDeviceCache struct {
+	ctldiskv1.BlockDeviceCache
+	bds []*diskv1.BlockDevice
+}
+
+func (f *fakeBlockDeviceCache) Get(_, name string) (*diskv1.BlockDevice, error) {
+	for _, bd := range f.bds {
+		if bd.Name == name {
+			return bd, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "harvesterhci.io", Resource: "blockdevices"}, name)
+}
+
+func (f *fakeBlockDeviceCache) List(_ string, selector labels.Selector) ([]*diskv1.BlockDevice, error) {
+	var result []*diskv1.BlockDevice
+	for _, bd := range f.bds {
+		if selector.Matches(labels.Set(bd.Labels)) {
+			result = append(result, bd)
+		}
+	}
+	return result, nil
+}
+
+// fakeFilterResolver resolves the default filters, or the ones of the node
+type fakeFilterResolver struct {
+	defaults []*filter.Filter
+	nodes    map[string][]*filter.Filter
+}
+
+func (f *fakeFilterResolver) ExcludeFilters(nodeName string) []*filter.Filter {
+	if filters, ok := f.nodes[nodeName]; ok {
+		return filters
+	}
+	return f.defaults
+}
+
+func newDisk(name, devPath, vendor string) *diskv1.BlockDevice {
+	return &diskv1.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				corev1.LabelHostname:          testNode,
+				blockdevicev1.DeviceTypeLabel: string(diskv1.DeviceTypeDisk),
+			},
+		},
+		Spec: diskv1.BlockDeviceSpec{
+			NodeName:   testNode,
+			DevPath:    devPath,
+			FileSystem: &diskv1.FilesystemInfo{},
+		},
+		Status: diskv1.BlockDeviceStatus{
+			DeviceStatus: diskv1.DeviceStatus{
+				DevPath: devPath,
+				Details: diskv1.DeviceDetails{
+					DeviceType: diskv1.DeviceTypeDisk,
+					DriveType:  "HDD",
+					Vendor:     vendor,
+				},
+				FileSystem: &diskv1.FilesystemStatus{},
+			},
+		},
+	}
+}
+
+func newPartition(name, devPath, parent, mountPoint string) *diskv1.BlockDevice {
+	bd := newDisk(name, devPath, "")
+	bd.Labels[blockdevicev1.DeviceTypeLabel] = string(diskv1.DeviceTypePart)
+	bd.Labels[blockdevicev1.ParentDeviceLabel] = parent
+	bd.Status.DeviceStatus.Details.DeviceType = diskv1.DeviceTypePart
+	bd.Status.DeviceStatus.FileSystem.MountPoint = mountPoint
+	return bd
+}
+
+func newTestValidator(bds ...*diskv1.BlockDevice) *blockDeviceValidator {
+	return newBlockDeviceValidator(
+		&fakeBlockDeviceCache{bds: bds},
+		&fakeFilterResolver{
+			defaults: filter.SetExcludeFilters("longhorn", "", "", ""),
+			nodes:    map[string][]*filter.Filter{"node2": filter.SetExcludeFilters("longhorn,QEMU", "", "", "")},
+		},
+	)
+}
+
+func Test_blockDeviceValidator(t *testing.T) {
+	longhornDisk := newDisk("longhorn-disk", "/dev/sdb", "longhorn")
+	longhornPart := newPartition("longhorn-part", "/dev/sdb1", "longhorn-disk", "")
+	inactiveDisk := newDisk("inactive-disk", "/dev/sdc", "")
+	inactiveDisk.Status.State = diskv1.BlockDeviceInactive
+	inactiveLVMDisk := newDisk("inactive-lvm-disk", "/dev/sdd", "")
+	inactiveLVMDisk.Status.State = diskv1.BlockDeviceInactive
+	inactiveLVMDisk.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+	sharedDisk := newDisk("shared-disk", "/dev/sde", "")
+	sharedDisk.Status.DeviceStatus.Partitioned = true
+	provisionedPart := newPartition("provisioned-part", "/dev/sde1", "shared-disk", "/var/lib/harvester/extra-disks/provisioned-part")
+	provisionedPart.Spec.FileSystem.Provisioned = true
+	provisionedPart.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+	freePart := newPartition("free-part", "/dev/sde2", "shared-disk", "")
+	provisionedDisk := newDisk("provisioned-disk", "/dev/sdf", "")
+	provisionedDisk.Spec.FileSystem.Provisioned = true
+	provisionedDisk.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+	stalePart := newPartition("stale-part", "/dev/sdf1", "provisioned-disk", "")
+	qemuDiskOfNode2 := newDisk("qemu-disk", "/dev/sdg", "QEMU")
+	qemuDiskOfNode2.Spec.NodeName = "node2"
+	validator := newTestValidator(longhornDisk, longhornPart, inactiveDisk, inactiveLVMDisk, sharedDisk, provisionedPart, freePart, provisionedDisk, stalePart)
+
+	var testCases = []struct {
+		name      string
+		op        admissionv1.Operation
+		oldBd     *diskv1.BlockDevice
+		mutate    func(bd *diskv1.BlockDevice)
+		expectErr bool
+	}{
+		{
+			name:   "create a disk",
+			op:     admissionv1.Create,
+			mutate: func(_ *diskv1.BlockDevice) {},
+		},
+		{
+			name: "create with the reserved tag",
+			op:   admissionv1.Create,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Tags = []string{"ssd", utils.DiskRemoveTag}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "add the reserved tag",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Tags = []string{utils.DiskRemoveTag}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "change nodeName",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.NodeName = "node2"
+			},
+			expectErr: true,
+		},
+		{
+			name:  "change devPath",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.DevPath = "/dev/sdc"
+			},
+			expectErr: true,
+		},
+		{
+			name:  "format a disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+		},
+		{
+			name:  "format the root filesystem",
+			op:    admissionv1.Update,
+			oldBd: newPartition("root", "/dev/sda3", "", "/"),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "format an excluded disk",
+			op:    admissionv1.Update,
+			oldBd: longhornDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "format a partition of an excluded disk",
+			op:    admissionv1.Update,
+			oldBd: longhornPart,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "format a disk excluded by the filters of its node",
+			op:    admissionv1.Update,
+			oldBd: qemuDiskOfNode2,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "format a disk excluded by the filters of another node",
+			op:    admissionv1.Update,
+			oldBd: newDisk("qemu-disk", "/dev/sdg", "QEMU"),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+		},
+		{
+			name: "provision a partitioned disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Status.DeviceStatus.Partitioned = true
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Provisioned = true
+			},
+			expectErr: true,
+		},
+		{
+			name: "format and provision a partitioned disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Status.DeviceStatus.Partitioned = true
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+		},
+		{
+			name:  "set the LVM provisioner",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{LVM: &diskv1.LVMProvisionerInfo{VgName: "vg0"}}
+				bd.Spec.FileSystem.Provisioned = true
+			},
+		},
+		{
+			name:  "set both provisioners",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{
+					Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock},
+					LVM:      &diskv1.LVMProvisionerInfo{VgName: "vg0"},
+				}
+			},
+			expectErr: true,
+		},
+		{
+			name: "provision a partitioned disk as block disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Status.DeviceStatus.Partitioned = true
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock}}
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+			expectErr: true,
+		},
+		{
+			name: "change the provisioner of a provisioned device",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{LVM: &diskv1.LVMProvisionerInfo{VgName: "vg0"}}
+			},
+			expectErr: true,
+		},
+		{
+			name: "change the volume group of a device being removed from it",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{LVM: &diskv1.LVMProvisionerInfo{VgName: "vg0"}}
+				bd.Status.ProvisionPhase = diskv1.ProvisionPhaseUnprovisioning
+				bd.Status.VolumeGroup = &diskv1.VolumeGroupStatus{Name: "vg0"}
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Provisioner.LVM.VgName = "vg1"
+			},
+			expectErr: true,
+		},
+		{
+			name: "update the status of an existing device",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "longhorn")
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Status.DeviceStatus.Partitioned = true
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Status.State = diskv1.BlockDeviceInactive
+			},
+		},
+		{
+			name:  "replace an inactive disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Replaces = "inactive-disk"
+			},
+		},
+		{
+			name:  "replace an active disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Replaces = "longhorn-disk"
+			},
+			expectErr: true,
+		},
+		{
+			name:  "replace a missing disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Replaces = "missing-disk"
+			},
+			expectErr: true,
+		},
+		{
+			name:  "replace a LVM physical volume",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Replaces = "inactive-lvm-disk"
+			},
+			expectErr: true,
+		},
+		{
+			name: "replace with a provisioned disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Replaces = "inactive-disk"
+			},
+			expectErr: true,
+		},
+		{
+			name: "change the replaced disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.Replaces = "inactive-disk"
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Replaces = "inactive-lvm-disk"
+			},
+			expectErr: true,
+		},
+		{
+			name:  "provision a free partition",
+			op:    admissionv1.Update,
+			oldBd: freePart,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+		},
+		{
+			name:  "format a disk with a provisioned partition",
+			op:    admissionv1.Update,
+			oldBd: sharedDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "wipe a disk with a provisioned partition",
+			op:    admissionv1.Update,
+			oldBd: sharedDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeWipefs}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "wipe a disk with a provisioned partition and no spec.fileSystem",
+			op:    admissionv1.Update,
+			oldBd: sharedDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem = nil
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeWipefs}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "partition a disk with a provisioned partition and no spec.fileSystem",
+			op:    admissionv1.Update,
+			oldBd: sharedDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem = nil
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "data", Size: "rest"}}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "provision a partition of a provisioned disk",
+			op:    admissionv1.Update,
+			oldBd: stalePart,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+			expectErr: true,
+		},
+		{
+			name: "partition a disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/nvme0n1", "")
+				bd.Status.DeviceStatus.Capacity.SizeBytes = 100 << 30
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "longhorn", Size: "60%", FileSystem: "ext4"}, {Name: "cache", Size: "rest"}}
+			},
+		},
+		{
+			name: "partition a disk with too large partitions",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/nvme0n1", "")
+				bd.Status.DeviceStatus.Capacity.SizeBytes = 100 << 30
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "longhorn", Size: "80Gi"}, {Name: "cache", Size: "30Gi"}}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "partition a partition",
+			op:    admissionv1.Update,
+			oldBd: freePart,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "data", Size: "rest"}}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "partition a disk with a provisioned partition",
+			op:    admissionv1.Update,
+			oldBd: sharedDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "data", Size: "rest"}}
+			},
+			expectErr: true,
+		},
+		{
+			name: "change the partitions of a partitioned disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/nvme0n1", "")
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "data", Size: "rest"}}
+				diskv1.DiskPartitioned.SetStatusBool(bd, true)
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "longhorn", Size: "50%"}, {Name: "cache", Size: "rest"}}
+			},
+			expectErr: true,
+		},
+		{
+			name: "provision a disk with partitions",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/nvme0n1", "")
+				bd.Spec.Partitions = []diskv1.PartitionInfo{{Name: "data", Size: "rest"}}
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "wipe a disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeZero}
+			},
+		},
+		{
+			name: "wipe a provisioned disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Status.ProvisionPhase = diskv1.ProvisionPhaseProvisioned
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeWipefs}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "wipe an excluded disk",
+			op:    admissionv1.Update,
+			oldBd: longhornDisk,
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeWipefs}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "sanitize a SCSI disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeNVMeSanitize}
+			},
+			expectErr: true,
+		},
+		{
+			name: "sanitize a NVMe disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/nvme0n1", "")
+				bd.Status.DeviceStatus.Details.StorageController = string(diskv1.StorageControllerNVMe)
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeNVMeSanitize}
+			},
+		},
+		{
+			name:  "secure erase a partition",
+			op:    admissionv1.Update,
+			oldBd: newPartition("part", "/dev/sda1", "", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeATASecureErase}
+			},
+			expectErr: true,
+		},
+		{
+			name: "provision a disk being wiped",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.Wipe = &diskv1.WipeInfo{Mode: diskv1.WipeModeZero}
+				bd.Status.Wipe = &diskv1.WipeStatus{Mode: diskv1.WipeModeZero, Phase: diskv1.WipePhaseWiping}
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Provisioned = true
+			},
+			expectErr: true,
+		},
+		{
+			name:  "encrypt a disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Spec.FileSystem.Encryption = &diskv1.EncryptionInfo{SecretName: "disk-key"}
+			},
+		},
+		{
+			name:  "encrypt a disk without formatting",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Provisioned = true
+				bd.Spec.FileSystem.Encryption = &diskv1.EncryptionInfo{SecretName: "disk-key"}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "encrypt a block disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Encryption = &diskv1.EncryptionInfo{SecretName: "disk-key"}
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock}}
+			},
+			expectErr: true,
+		},
+		{
+			name:  "change the filesystem type of a disk not formatted",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Type = "xfs"
+			},
+		},
+		{
+			name: "change the filesystem type of a formatted disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Status.DeviceStatus.FileSystem.LastFormattedAt = &metav1.Time{Time: time.Now()}
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Type = "xfs"
+			},
+			expectErr: true,
+		},
+		{
+			name: "default the filesystem type of a formatted disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Status.DeviceStatus.FileSystem.LastFormattedAt = &metav1.Time{Time: time.Now()}
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Type = "ext4"
+			},
+		},
+		{
+			name: "repair a corrupted disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Status.DeviceStatus.FileSystem.Corrupted = true
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Repair = diskv1.FilesystemRepairAuto
+			},
+		},
+		{
+			name: "check a mounted disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Status.DeviceStatus.FileSystem.MountPoint = "/var/lib/harvester/extra-disks/disk"
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Repair = diskv1.FilesystemRepairReadOnlyCheck
+			},
+			expectErr: true,
+		},
+		{
+			name:  "check a block disk",
+			op:    admissionv1.Update,
+			oldBd: newDisk("disk", "/dev/sda", ""),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Repair = diskv1.FilesystemRepairReadOnlyCheck
+				bd.Spec.Provisioner = &diskv1.ProvisionerInfo{Longhorn: &diskv1.LonghornProvisionerInfo{DiskType: diskv1.LonghornDiskTypeBlock}}
+			},
+			expectErr: true,
+		},
+		{
+			name: "change the encryption of a formatted disk",
+			op:   admissionv1.Update,
+			oldBd: func() *diskv1.BlockDevice {
+				bd := newDisk("disk", "/dev/sda", "")
+				bd.Spec.FileSystem.ForceFormatted = true
+				bd.Spec.FileSystem.Encryption = &diskv1.EncryptionInfo{SecretName: "disk-key"}
+				bd.Status.DeviceStatus.FileSystem.LastFormattedAt = &metav1.Time{Time: time.Now()}
+				bd.Status.DeviceStatus.FileSystem.Encrypted = true
+				return bd
+			}(),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.Encryption = nil
+			},
+			expectErr: true,
+		},
+		{
+			name:  "delete",
+			op:    admissionv1.Delete,
+			oldBd: newPartition("root", "/dev/sda3", "", "/"),
+			mutate: func(bd *diskv1.BlockDevice) {
+				bd.Spec.FileSystem.ForceFormatted = true
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var newBd *diskv1.BlockDevice
+			if tc.oldBd != nil {
+				newBd = tc.oldBd.DeepCopy()
+			} else {
+				newBd = newDisk("disk", "/dev/sda", "")
+			}
+			tc.mutate(newBd)
+
+			err := validator.Validate(tc.op, tc.oldBd, newBd)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_excludedBy(t *testing.T) {
+	smallDisk := newDisk("small-disk", "/dev/sdb", "")
+	smallDisk.Status.DeviceStatus.Capacity.SizeBytes = 32 << 30
+	serialDisk := newDisk("serial-disk", "/dev/sdc", "")
+	serialDisk.Status.DeviceStatus.Details.SerialNumber = "S3EVNX0K123456"
+	virtioDisk := newDisk("virtio-disk", "/dev/vda", "")
+	virtioDisk.Status.DeviceStatus.Details.StorageController = "virtio"
+	efiDisk := newDisk("efi-disk", "/dev/sdd", "")
+	efiDisk.Status.DeviceStatus.Partitioned = true
+	efiPart := newPartition("efi-part", "/dev/sdd1", "efi-disk", "")
+	efiPart.Status.DeviceStatus.Details.PartType = "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"
+	dataPart := newPartition("data-part", "/dev/sdd2", "efi-disk", "")
+	largeDisk := newDisk("large-disk", "/dev/sde", "")
+	largeDisk.Status.DeviceStatus.Capacity.SizeBytes = 1 << 40
+	largeDisk.Status.DeviceStatus.Details.StorageController = "SCSI"
+
+	config := filter.Config{
+		PartTypeFilter:          "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		SizeFilter:              "-64Gi",
+		SerialFilter:            "S3EVNX0K*",
+		StorageControllerFilter: "virtio",
+	}
+	excludeFilters, err := config.ExcludeFilters()
+	require.NoError(t, err)
+	validator := newBlockDeviceValidator(
+		&fakeBlockDeviceCache{bds: []*diskv1.BlockDevice{efiDisk, efiPart, dataPart}},
+		&fakeFilterResolver{defaults: excludeFilters},
+	)
+
+	for _, tc := range []struct {
+		bd       *diskv1.BlockDevice
+		expected string
+	}{
+		{bd: smallDisk, expected: "size filter"},
+		{bd: serialDisk, expected: "serial number filter"},
+		{bd: virtioDisk, expected: "storage controller filter"},
+		{bd: efiPart, expected: "parttype filter"},
+		// the disk is excluded by its EFI system partition
+		{bd: efiDisk, expected: "parttype filter"},
+		{bd: dataPart, expected: "parttype filter"},
+		{bd: largeDisk},
+	} {
+		name, excluded := validator.excludedBy(tc.bd)
+		assert.Equal(t, tc.expected != "", excluded, tc.bd.Name)
+		assert.Equal(t, tc.expected, name, tc.bd.Name)
+	}
+}
+
+func Test_excludedByExpression(t *testing.T) {
+	bootDisk := newDisk("boot-disk", "/dev/sdb", "QEMU")
+	bootDisk.Status.DeviceStatus.Capacity.SizeBytes = 32 << 30
+	bootDisk.Status.DeviceStatus.Details.Label = "COS_OEM"
+	dataDisk := newDisk("data-disk", "/dev/sdc", "QEMU")
+	dataDisk.Status.DeviceStatus.Capacity.SizeBytes = 1 << 40
+	nvmeDisk := newDisk("nvme-disk", "/dev/nvme0n1", "")
+	nvmeDisk.Status.DeviceStatus.Capacity.SizeBytes = 32 << 30
+	nvmeDisk.Status.DeviceStatus.Details.StorageController = "NVMe"
+	nvmeDisk.Status.DeviceStatus.Details.SerialNumber = "S3EVNX0K123456"
+
+	config := filter.Config{ExcludeExpression: `(vendor == "QEMU" && size < 64Gi && label.matches("COS_*")) || (storageController == "NVMe" && serial.matches("S3EVNX0K*"))`}
+	excludeFilters, err := config.ExcludeFilters()
+	require.NoError(t, err)
+	validator := newBlockDeviceValidator(&fakeBlockDeviceCache{}, &fakeFilterResolver{defaults: excludeFilters})
+
+	_, excluded := validator.excludedBy(bootDisk)
+	assert.True(t, excluded)
+	_, excluded = validator.excludedBy(dataDisk)
+	assert.False(t, excluded)
+	_, excluded = validator.excludedBy(nvmeDisk)
+	assert.True(t, excluded)
+}
+
+func Test_handleBlockDeviceValidation(t *testing.T) {
+	s := &Server{validator: newTestValidator()}
+	oldBd := newDisk("disk", "/dev/sda", "")
+	newBd := oldBd.DeepCopy()
+	newBd.Spec.DevPath = "/dev/sdb"
+	oldRaw, err := json.Marshal(oldBd)
+	require.NoError(t, err)
+	newRaw, err := json.Marshal(newBd)
+	require.NoError(t, err)
+
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid-1",
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: newRaw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		},
+	}
+	body, err := json.Marshal(review)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	s.handleBlockDeviceValidation(recorder, httptest.NewRequest(http.MethodPost, BlockDeviceValidationPath, bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	result := admissionv1.AdmissionReview{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	require.NotNil(t, result.Response)
+	assert.Equal(t, "AdmissionReview", result.Kind)
+	assert.Equal(t, review.Request.UID, result.Response.UID)
+	assert.False(t, result.Response.Allowed)
+	assert.Contains(t, result.Response.Result.Message, "spec.devPath")
+
+	recorder = httptest.NewRecorder()
+	s.handleBlockDeviceValidation(recorder, httptest.NewRequest(http.MethodPost, BlockDeviceValidationPath, bytes.NewReader([]byte("{"))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
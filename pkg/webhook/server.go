@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	ctldiskv1 "github.com/harvester/node-disk-manager/pkg/generated/controllers/harvesterhci.io/v1beta1"
+)
+
+const (
+	// BlockDeviceValidationPath is the path of the validating webhook of blockdevices
+	BlockDeviceValidationPath = "/v1/webhook/validation/blockdevices"
+
+	// maxRequestBytes is the limit of the admission review body, the same as the apiserver's
+	maxRequestBytes = 3 * 1024 * 1024
+)
+
+// Server serves the admission webhooks of NDM over TLS
+type Server struct {
+	addr      string
+	certFile  string
+	keyFile   string
+	validator *blockDeviceValidator
+}
+
+func NewServer(addr, certFile, keyFile string, cache ctldiskv1.BlockDeviceCache, filters ExcludeFilterResolver) *Server {
+	return &Server{
+		addr:      addr,
+		certFile:  certFile,
+		keyFile:   keyFile,
+		validator: newBlockDeviceValidator(cache, filters),
+	}
+}
+
+// ListenAndServe serves the webhooks until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(BlockDeviceValidationPath, s.handleBlockDeviceValidation)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logrus.Errorf("failed to shutdown webhook server: %s", err.Error())
+		}
+	}()
+
+	logrus.Infof("Webhook server is listening on %s", s.addr)
+	if err := server.ListenAndServeTLS(s.certFile, s.keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleBlockDeviceValidation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(review); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode admission review: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "admission review without request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = s.reviewBlockDevice(review.Request)
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		logrus.Errorf("failed to encode admission review: %s", err.Error())
+	}
+}
+
+func (s *Server) reviewBlockDevice(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	var oldBd, newBd *diskv1.BlockDevice
+	var err error
+	if len(req.Object.Raw) > 0 {
+		if newBd, err = decodeBlockDevice(req.Object.Raw); err != nil {
+			return deny(resp, http.StatusBadRequest, metav1.StatusReasonBadRequest, err)
+		}
+	}
+	if len(req.OldObject.Raw) > 0 {
+		if oldBd, err = decodeBlockDevice(req.OldObject.Raw); err != nil {
+			return deny(resp, http.StatusBadRequest, metav1.StatusReasonBadRequest, err)
+		}
+	}
+
+	if err := s.validator.Validate(req.Operation, oldBd, newBd); err != nil {
+		logrus.Infof("Deny %s of blockdevice %s/%s: %s", req.Operation, req.Namespace, req.Name, err.Error())
+		return deny(resp, http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, err)
+	}
+	return resp
+}
+
+func decodeBlockDevice(raw []byte) (*diskv1.BlockDevice, error) {
+	bd := &diskv1.BlockDevice{}
+	if err := json.Unmarshal(raw, bd); err != nil {
+		return nil, fmt.Errorf("failed to decode blockdevice: %w", err)
+	}
+	return bd, nil
+}
+
+func deny(resp *admissionv1.AdmissionResponse, code int32, reason metav1.StatusReason, err error) *admissionv1.AdmissionResponse {
+	resp.Allowed = false
+	resp.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  reason,
+		Message: err.Error(),
+	}
+	return resp
+}
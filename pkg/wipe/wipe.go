@@ -0,0 +1,235 @@
+package wipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/harvester/node-disk-manager/pkg/utils"
+)
+
+const (
+	// zeroChunkSize is the size of the writes of zeroing a device
+	zeroChunkSize = 4 << 20
+
+	// sanitizePollInterval is how often the NVMe sanitize log is polled
+	sanitizePollInterval = 10 * time.Second
+
+	// the sanitize status of the NVMe sanitize log, see the NVMe spec
+	sanitizeStatusMask       = 0x7
+	sanitizeStatusNeverRun   = 0x0
+	sanitizeStatusCompleted  = 0x1
+	sanitizeStatusInProgress = 0x2
+	sanitizeStatusFailed     = 0x3
+	// sanitizeProgressDone is the sanitize progress of a completed sanitize,
+	// the progress is reported as a numerator of 65536
+	sanitizeProgressDone = 65536
+
+	// the dummy password of the ATA security erase, the security is disabled
+	// once the disk is erased
+	ataSecurityPassword = "NULL"
+)
+
+// ProgressFunc receives the progress of a wipe in percentage
+type ProgressFunc func(percent int32)
+
+// Wiper wipes the data of devices
+type Wiper interface {
+	// Wipe wipes the data of the device in the mode, it blocks until the
+	// wipe completes and reports the progress if possible
+	Wipe(devPath string, mode diskv1.WipeMode, progress ProgressFunc) error
+}
+
+type executor interface {
+	Execute(cmd string, args []string) (string, error)
+}
+
+type wiper struct {
+	executor executor
+	// pollInterval is the interval of polling the NVMe sanitize log
+	pollInterval time.Duration
+}
+
+// NewWiper returns a Wiper running the commands on the host namespace if the
+// host `/proc` is mounted. The commands are not timed out, since the wipe of a
+// large disk takes hours.
+func NewWiper() (Wiper, error) {
+	executor, err := utils.NewHostExecutor()
+	if err != nil {
+		return nil, err
+	}
+	executor.SetTimeout(0)
+	return &wiper{executor: executor, pollInterval: sanitizePollInterval}, nil
+}
+
+func (w *wiper) Wipe(devPath string, mode diskv1.WipeMode, progress ProgressFunc) error {
+	logrus.Infof("Wipe device %s with mode %s", devPath, mode)
+	switch mode {
+	case diskv1.WipeModeWipefs:
+		_, err := w.executor.Execute("wipefs", []string{"--all", "--force", devPath})
+		return err
+	case diskv1.WipeModeDiscard:
+		_, err := w.executor.Execute("blkdiscard", []string{devPath})
+		return err
+	case diskv1.WipeModeZero:
+		return zeroDevice(devPath, progress)
+	case diskv1.WipeModeNVMeFormat:
+		_, err := w.executor.Execute("nvme", []string{"format", devPath, "--ses=1", "--force"})
+		return err
+	case diskv1.WipeModeNVMeSanitize:
+		return w.sanitize(devPath, progress)
+	case diskv1.WipeModeATASecureErase:
+		return w.ataSecureErase(devPath)
+	default:
+		return fmt.Errorf("unsupported wipe mode %s", mode)
+	}
+}
+
+// zeroDevice overwrites the device with zeros. The device is opened
+// exclusively, so it fails if the device is mounted or in use.
+func zeroDevice(devPath string, progress ProgressFunc) error {
+	f, err := os.OpenFile(devPath, os.O_WRONLY|syscall.O_EXCL, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s exclusively: %w", devPath, err)
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to get size of %s: %w", devPath, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	zeros := make([]byte, zeroChunkSize)
+	var written int64
+	var lastPercent int32
+	for written < size {
+		chunk := zeros
+		if remaining := size - written; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := f.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to zero %s at offset %d: %w", devPath, written, err)
+		}
+		if percent := int32(written * 100 / size); percent != lastPercent {
+			lastPercent = percent
+			progress(percent)
+		}
+	}
+	return f.Sync()
+}
+
+// sanitize starts the block erase sanitize of the NVMe disk, and waits for it
+// by polling the sanitize log, since the sanitize runs in background.
+func (w *wiper) sanitize(devPath string, progress ProgressFunc) error {
+	if _, err := w.executor.Execute("nvme", []string{"sanitize", devPath, "--sanact=2"}); err != nil {
+		return err
+	}
+	for {
+		output, err := w.executor.Execute("nvme", []string{"sanitize-log", devPath, "--output-format=json"})
+		if err != nil {
+			return err
+		}
+		status, sprog, err := parseSanitizeLog([]byte(output))
+		if err != nil {
+			return err
+		}
+		switch status & sanitizeStatusMask {
+		case sanitizeStatusCompleted:
+			progress(100)
+			return nil
+		case sanitizeStatusFailed:
+			return fmt.Errorf("sanitize of %s failed, sanitize status %#x", devPath, status)
+		case sanitizeStatusNeverRun:
+			return fmt.Errorf("sanitize of %s is not started", devPath)
+		case sanitizeStatusInProgress:
+			progress(int32(sprog * 100 / sanitizeProgressDone))
+		}
+		time.Sleep(w.pollInterval)
+	}
+}
+
+type sanitizeLog struct {
+	SProg *int64 `json:"sprog"`
+	SStat *int64 `json:"sstat"`
+}
+
+// parseSanitizeLog returns the sanitize status and progress of the sanitize
+// log, which is keyed by the device name in the output of recent nvme-cli.
+func parseSanitizeLog(output []byte) (int64, int64, error) {
+	var log sanitizeLog
+	if err := json.Unmarshal(output, &log); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse sanitize log: %w", err)
+	}
+	if log.SStat == nil {
+		var logs map[string]sanitizeLog
+		if err := json.Unmarshal(output, &logs); err != nil {
+			return 0, 0, fmt.Errorf("failed to parse sanitize log: %w", err)
+		}
+		for _, l := range logs {
+			if l.SStat != nil {
+				log = l
+				break
+			}
+		}
+	}
+	if log.SStat == nil {
+		return 0, 0, fmt.Errorf("sanitize status is not found in sanitize log")
+	}
+	var sprog int64
+	if log.SProg != nil {
+		sprog = *log.SProg
+	}
+	return *log.SStat, sprog, nil
+}
+
+// ataSecureErase sets a password to enable the security of the ATA disk, and
+// erases it with the password, which blocks until the erase completes.
+func (w *wiper) ataSecureErase(devPath string) error {
+	output, err := w.executor.Execute("hdparm", []string{"-I", devPath})
+	if err != nil {
+		return err
+	}
+	if isSecurityFrozen(output) {
+		return fmt.Errorf("security of %s is frozen, which is usually unfrozen by suspending or hot plugging the disk", devPath)
+	}
+	if _, err := w.executor.Execute("hdparm", []string{"--user-master", "u", "--security-set-pass", ataSecurityPassword, devPath}); err != nil {
+		return err
+	}
+	_, err = w.executor.Execute("hdparm", []string{"--user-master", "u", "--security-erase", ataSecurityPassword, devPath})
+	return err
+}
+
+// isSecurityFrozen returns true if the security section in the output of
+// `hdparm -I` reports frozen, rather than "not frozen".
+func isSecurityFrozen(output string) bool {
+	inSecurity := false
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Security:") {
+			inSecurity = true
+			continue
+		}
+		if !inSecurity {
+			continue
+		}
+		if line != "" && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			// the next section
+			return false
+		}
+		if strings.TrimSpace(line) == "frozen" {
+			return true
+		}
+	}
+	return false
+}
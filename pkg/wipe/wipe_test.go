@@ -0,0 +1,182 @@
+package wipe
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	diskv1 "github.com/harvester/node-disk-manager/pkg/apis/harvesterhci.io/v1beta1"
+)
+
+// fakeExecutor records the commands, and replies the outputs of the commands
+// in order.
+type fakeExecutor struct {
+	commands []string
+	outputs  map[string][]string
+}
+
+func (f *fakeExecutor) Execute(cmd string, args []string) (string, error) {
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	f.commands = append(f.commands, command)
+	outputs := f.outputs[command]
+	if len(outputs) == 0 {
+		return "", nil
+	}
+	f.outputs[command] = outputs[1:]
+	if strings.HasPrefix(outputs[0], "error:") {
+		return "", fmt.Errorf("%s", outputs[0])
+	}
+	return outputs[0], nil
+}
+
+const hdparmOutput = `
+/dev/sdb:
+
+ATA device, with non-removable media
+	Model Number:       SAMSUNG SSD
+Security:
+	Master password revision code = 65534
+		supported
+	not	enabled
+	not	locked
+	%s
+	not	expired: security count
+		supported: enhanced erase
+Logical Unit WWN Device Identifier: 5002538e40a1b2c3
+`
+
+func Test_wipe(t *testing.T) {
+	var testCases = []struct {
+		name           string
+		mode           diskv1.WipeMode
+		outputs        map[string][]string
+		expectCommands []string
+		expectProgress []int32
+		expectErr      bool
+	}{
+		{
+			name:           "wipefs",
+			mode:           diskv1.WipeModeWipefs,
+			expectCommands: []string{"wipefs --all --force /dev/sdb"},
+		},
+		{
+			name:           "discard",
+			mode:           diskv1.WipeModeDiscard,
+			expectCommands: []string{"blkdiscard /dev/sdb"},
+		},
+		{
+			name:           "NVMe format",
+			mode:           diskv1.WipeModeNVMeFormat,
+			expectCommands: []string{"nvme format /dev/sdb --ses=1 --force"},
+		},
+		{
+			name: "NVMe sanitize",
+			mode: diskv1.WipeModeNVMeSanitize,
+			outputs: map[string][]string{
+				"nvme sanitize-log /dev/sdb --output-format=json": {
+					`{"sprog":32768,"sstat":2}`,
+					`{"nvme0n1":{"sprog":65535,"sstat":257}}`,
+				},
+			},
+			expectCommands: []string{
+				"nvme sanitize /dev/sdb --sanact=2",
+				"nvme sanitize-log /dev/sdb --output-format=json",
+				"nvme sanitize-log /dev/sdb --output-format=json",
+			},
+			expectProgress: []int32{50, 100},
+		},
+		{
+			name: "NVMe sanitize failed",
+			mode: diskv1.WipeModeNVMeSanitize,
+			outputs: map[string][]string{
+				"nvme sanitize-log /dev/sdb --output-format=json": {`{"sprog":0,"sstat":3}`},
+			},
+			expectCommands: []string{
+				"nvme sanitize /dev/sdb --sanact=2",
+				"nvme sanitize-log /dev/sdb --output-format=json",
+			},
+			expectErr: true,
+		},
+		{
+			name: "ATA secure erase",
+			mode: diskv1.WipeModeATASecureErase,
+			outputs: map[string][]string{
+				"hdparm -I /dev/sdb": {fmt.Sprintf(hdparmOutput, "not\tfrozen")},
+			},
+			expectCommands: []string{
+				"hdparm -I /dev/sdb",
+				"hdparm --user-master u --security-set-pass NULL /dev/sdb",
+				"hdparm --user-master u --security-erase NULL /dev/sdb",
+			},
+		},
+		{
+			name: "ATA secure erase of a frozen disk",
+			mode: diskv1.WipeModeATASecureErase,
+			outputs: map[string][]string{
+				"hdparm -I /dev/sdb": {fmt.Sprintf(hdparmOutput, "\tfrozen")},
+			},
+			expectCommands: []string{"hdparm -I /dev/sdb"},
+			expectErr:      true,
+		},
+		{
+			name:      "unknown mode",
+			mode:      diskv1.WipeMode("shred"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			executor := &fakeExecutor{outputs: tc.outputs}
+			w := &wiper{executor: executor}
+			var progress []int32
+			err := w.Wipe("/dev/sdb", tc.mode, func(percent int32) {
+				progress = append(progress, percent)
+			})
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectCommands, executor.commands)
+			assert.Equal(t, tc.expectProgress, progress)
+		})
+	}
+}
+
+func Test_zeroDevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk")
+	data := make([]byte, 2*zeroChunkSize+1024)
+	for i := range data {
+		data[i] = 0xff
+	}
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	var progress []int32
+	require.NoError(t, zeroDevice(path, func(percent int32) {
+		progress = append(progress, percent)
+	}))
+
+	zeroed, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, len(data)), zeroed)
+	require.NotEmpty(t, progress)
+	assert.Equal(t, int32(100), progress[len(progress)-1])
+}
+
+func Test_parseSanitizeLog(t *testing.T) {
+	status, sprog, err := parseSanitizeLog([]byte(`{"nvme0n1":{"sprog":16384,"sstat":2,"scdw10":2}}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), status)
+	assert.Equal(t, int64(16384), sprog)
+
+	_, _, err = parseSanitizeLog([]byte(`{"nvme0n1":{}}`))
+	assert.Error(t, err)
+	_, _, err = parseSanitizeLog([]byte("not json"))
+	assert.Error(t, err)
+}